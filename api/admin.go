@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+)
+
+// userResponse is a user as listed by /admin/users
+type userResponse struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Handler for listing the users and their roles. Admin only, see the route table.
+func (api *API) listUsersHandler(writer http.ResponseWriter, request *http.Request) {
+	users, err := api.storage.ListUsers(request.Context())
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]userResponse, 0, len(users))
+	for _, user := range users {
+		response = append(response, userResponse{Username: user.Username, Role: user.Role})
+	}
+	writeJSON(writer, response)
+}
+
+// Handler for resetting the history of the user in the path. Admin only, see the route table.
+func (api *API) adminResetHandler(writer http.ResponseWriter, request *http.Request) {
+	username := request.PathValue("username")
+
+	// Unknown users get 404 instead of silently resetting nothing
+	_, err := api.storage.GetUser(request.Context(), username)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = api.storage.ResetHistory(request.Context(), username)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+	writer.WriteHeader(http.StatusOK)
+}
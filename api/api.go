@@ -2,6 +2,7 @@ package api
 
 import (
 	"log"
+	"net/http"
 	"overengineered_calculator/calculator"
 	"overengineered_calculator/storage"
 	"time"
@@ -10,27 +11,76 @@ import (
 type API struct {
 	calculator *calculator.Calculator
 	storage    storage.Storage
+	keys       *KeySet        // Keys that sign and verify the tokens
+	passwords  PasswordPolicy // Strength of the passwords of new users
+	logins     *loginThrottle // Failed logins per account and client IP
 }
 
-func NewAPI(calc *calculator.Calculator, storage storage.Storage) *API {
-	return &API{
+// Option configures an API created by NewAPI, e.g. WithKeySet
+type Option func(api *API)
+
+// WithKeySet sets the keys of the tokens. Without it, a random key is used, see defaultKeySet.
+func WithKeySet(keys *KeySet) Option {
+	return func(api *API) {
+		api.keys = keys
+	}
+}
+
+func NewAPI(calc *calculator.Calculator, storage storage.Storage, options ...Option) *API {
+	api := &API{
 		calculator: calc,
 		storage:    storage,
+		keys:       defaultKeySet(),
+		passwords:  DefaultPasswordPolicy,
+		logins:     newLoginThrottle(),
+	}
+	for _, option := range options {
+		option(api)
 	}
+	return api
 }
 
 // saveToHistory saves the operation and its result to the history.
-func (api *API) saveToHistory(operation string, operand1, operand2, result float64) {
+func (api *API) saveToHistory(request *http.Request, operation string, operand1, operand2, result float64) {
 
-	entry := storage.HistoryEntry{
+	api.saveEntryToHistory(request, storage.HistoryEntry{
 		Operation: operation,
 		Operand1:  operand1,
 		Operand2:  operand2,
 		Result:    result,
-		Timestamp: time.Now(),
-	}
+	})
+}
+
+// saveUnaryToHistory saves a unary operation and its result to the history.
+// The angle mode is only recorded for trigonometric operations.
+func (api *API) saveUnaryToHistory(request *http.Request, operation string, operand, result float64, angleMode calculator.AngleMode) {
+
+	api.saveEntryToHistory(request, storage.HistoryEntry{
+		Operation: operation,
+		Operand1:  operand,
+		Result:    result,
+		AngleMode: string(angleMode),
+	})
+}
+
+// saveExpressionToHistory saves an evaluated infix expression and its result to the history.
+func (api *API) saveExpressionToHistory(request *http.Request, expression string, result float64) {
+
+	api.saveEntryToHistory(request, storage.HistoryEntry{
+		Operation:  "Evaluate",
+		Expression: expression,
+		Result:     result,
+	})
+}
+
+// saveEntryToHistory timestamps the entry and saves it to the history of the authenticated user.
+// Failing to save is logged but does not fail the calculation.
+func (api *API) saveEntryToHistory(request *http.Request, entry storage.HistoryEntry) {
+
+	entry.Owner, _ = UserFromContext(request.Context())
+	entry.Timestamp = time.Now()
 
-	err := api.storage.SaveOperation(entry)
+	err := api.storage.SaveOperation(request.Context(), entry)
 	if err != nil {
 		log.Printf("Failed to save history: %v", err)
 	}
@@ -1,12 +1,34 @@
 package api
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"overengineered_calculator/calculator"
 	"overengineered_calculator/storage"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // Function to set up LocalStorage for unit tests
@@ -17,6 +39,42 @@ func testSetup() *API {
 	return api
 }
 
+// Function to create a request as if authenticated by the middleware
+func requestAsUser(method string, target string, username string) *http.Request {
+	request := httptest.NewRequest(method, target, nil)
+	return request.WithContext(ContextWithUser(request.Context(), username))
+}
+
+// Function to create a token accepted by the APIs created without WithKeySet
+func generateJWT(username string) (string, error) {
+	return defaultKeySet().generateJWT(username, storage.RoleUser)
+}
+
+// Function to check that the response is problem details with the given code and detail
+func expectProblem(t *testing.T, responseRecorder *httptest.ResponseRecorder, code string, detail string) problemDetails {
+	t.Helper()
+
+	if contentType := responseRecorder.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Fatalf("expected Content-Type application/problem+json, got %q", contentType)
+	}
+
+	var problem problemDetails
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&problem); err != nil {
+		t.Fatalf("could not decode problem details: %v", err)
+	}
+	if problem.Status != responseRecorder.Code || problem.Title != http.StatusText(responseRecorder.Code) {
+		t.Errorf("expected status %d and title %q, got %d and %q",
+			responseRecorder.Code, http.StatusText(responseRecorder.Code), problem.Status, problem.Title)
+	}
+	if problem.Code != code {
+		t.Errorf("expected code %q, got %q", code, problem.Code)
+	}
+	if problem.Detail != detail {
+		t.Errorf("expected detail %q, got %q", detail, problem.Detail)
+	}
+	return problem
+}
+
 // TestAddHandler checks the addition handler with the two operands:
 // operand1 = 10, operand2 = 5. The response should be 15.
 func TestAddHandler(t *testing.T) {
@@ -25,7 +83,7 @@ func TestAddHandler(t *testing.T) {
 	request := httptest.NewRequest("GET", "/add?operand1=10&operand2=5", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.addHandler(responseRecorder, request)
+	api.operationHandler("Add")(responseRecorder, request)
 
 	// Check the status code
 	if responseRecorder.Code != http.StatusOK {
@@ -53,19 +111,15 @@ func TestAddHandlerWithInvalidOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/add?operand1=invalid&operand2=5", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.addHandler(responseRecorder, request)
+	api.operationHandler("Add")(responseRecorder, request)
 
 	// Check for bad status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
 }
 
 // TestAddHandlerWithMissingOperands checks the addition handler with missing operands.
@@ -76,19 +130,15 @@ func TestAddHandlerWithMissingOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/add?operand1=10", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.addHandler(responseRecorder, request)
+	api.operationHandler("Add")(responseRecorder, request)
 
 	// Check for the bad request status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
 }
 
 // TestSubtractHandler checks the subtraction handler with the two operands:
@@ -99,7 +149,7 @@ func TestSubtractHandler(t *testing.T) {
 	request := httptest.NewRequest("GET", "/subtract?operand1=10&operand2=5", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.subtractHandler(responseRecorder, request)
+	api.operationHandler("Subtract")(responseRecorder, request)
 
 	// Check the status code
 	if responseRecorder.Code != http.StatusOK {
@@ -127,19 +177,15 @@ func TestSubtractHandlerWithInvalidOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/subtract?operand1=10&operand2=invalid", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.subtractHandler(responseRecorder, request)
+	api.operationHandler("Subtract")(responseRecorder, request)
 
 	// Check bad status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
 }
 
 // TestSubtractHandlerWithMissingOperands checks the subtract handler with missing operands.
@@ -150,19 +196,15 @@ func TestSubtractHandlerWithMissingOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/subtract?operand1=10", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.subtractHandler(responseRecorder, request)
+	api.operationHandler("Subtract")(responseRecorder, request)
 
 	// Check for the bad request status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
 }
 
 // TestMultiplyHandler checks the multiplication handler with the two operands:
@@ -173,7 +215,7 @@ func TestMultiplyHandler(t *testing.T) {
 	request := httptest.NewRequest("GET", "/multiply?operand1=10&operand2=5", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.multiplyHandler(responseRecorder, request)
+	api.operationHandler("Multiply")(responseRecorder, request)
 
 	// Check the status code
 	if responseRecorder.Code != http.StatusOK {
@@ -201,19 +243,15 @@ func TestMultiplyHandlerWithInvalidOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/multiply?operand1=invalid&operand2=45", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.multiplyHandler(responseRecorder, request)
+	api.operationHandler("Multiply")(responseRecorder, request)
 
 	// Check bad status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
 }
 
 // TestMultiplyHandlerWithMissingOperands checks the multiply handler with missing operands.
@@ -224,19 +262,15 @@ func TestMultiplyHandlerWithMissingOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/multiply?operand2=10", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.multiplyHandler(responseRecorder, request)
+	api.operationHandler("Multiply")(responseRecorder, request)
 
 	// Check for the bad request status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
 }
 
 // TestDivideHandler checks the division handler with the two operands:
@@ -247,7 +281,7 @@ func TestDivideHandler(t *testing.T) {
 	request := httptest.NewRequest("GET", "/divide?operand1=10&operand2=5", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.divideHandler(responseRecorder, request)
+	api.operationHandler("Divide")(responseRecorder, request)
 
 	// Check the status code
 	if responseRecorder.Code != http.StatusOK {
@@ -275,19 +309,15 @@ func TestDivideHandlerWithInvalidOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/subtract?operand1=invalid&operand2=45", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.divideHandler(responseRecorder, request)
+	api.operationHandler("Divide")(responseRecorder, request)
 
 	// Check bad status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
 }
 
 // TestDivideHandlerWithMissingOperands checks the divide handler with missing operands.
@@ -298,19 +328,15 @@ func TestDivideHandlerWithMissingOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/divide?operand2=10", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.divideHandler(responseRecorder, request)
+	api.operationHandler("Divide")(responseRecorder, request)
 
 	// Check for the bad request status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
 }
 
 // TestDivideHandlerWithInvalidOperands checks the divide handler with division by zero:
@@ -321,19 +347,15 @@ func TestDivideHandlerWithDivisionByZero(t *testing.T) {
 	request := httptest.NewRequest("GET", "/multiply?operand1=10&operand2=0", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.divideHandler(responseRecorder, request)
+	api.operationHandler("Divide")(responseRecorder, request)
 
 	// Check status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "cannot divide by zero\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "divide_by_zero", "cannot divide by zero")
 }
 
 // TestModuloHandler checks the modulo handler with the two operands:
@@ -344,7 +366,7 @@ func TestModuloHandler(t *testing.T) {
 	request := httptest.NewRequest("GET", "/modulo?operand1=11&operand2=5", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.moduloHandler(responseRecorder, request)
+	api.operationHandler("Modulo")(responseRecorder, request)
 
 	// Check the status code
 	if responseRecorder.Code != http.StatusOK {
@@ -372,19 +394,15 @@ func TestModuloHandlerWithInvalidOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/modulo?operand1=45&operand2=invalid", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.moduloHandler(responseRecorder, request)
+	api.operationHandler("Modulo")(responseRecorder, request)
 
 	// Check bad status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
 }
 
 // TestModuloHandlerWithMissingOperands checks the modulo handler with missing operands.
@@ -395,19 +413,15 @@ func TestModuloHandlerWithMissingOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/modulo?operand1=45", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.moduloHandler(responseRecorder, request)
+	api.operationHandler("Modulo")(responseRecorder, request)
 
 	// Check for bad status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
 }
 
 // TestModuloHandlerWithDivisionByZero checks the modulo handler with division by zero:
@@ -418,19 +432,15 @@ func TestModuloHandlerWithModuloByZero(t *testing.T) {
 	request := httptest.NewRequest("GET", "/modulo?operand1=45&operand2=0", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.moduloHandler(responseRecorder, request)
+	api.operationHandler("Modulo")(responseRecorder, request)
 
 	// Check status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "cannot modulo by zero\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
-	}
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "modulo_by_zero", "cannot modulo by zero")
 }
 
 // TestPowerHandler checks the power handler with the two operands:
@@ -441,7 +451,7 @@ func TestPowerHandler(t *testing.T) {
 	request := httptest.NewRequest("GET", "/power?operand1=2&operand2=3", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.powerHandler(responseRecorder, request)
+	api.operationHandler("Power")(responseRecorder, request)
 
 	// Check the status code
 	if responseRecorder.Code != http.StatusOK {
@@ -469,17 +479,2451 @@ func TestPowerHandlerWithInvalidOperands(t *testing.T) {
 	request := httptest.NewRequest("GET", "/power?operand1=invalid&operand2=3", nil)
 	responseRecorder := httptest.NewRecorder()
 
-	api.powerHandler(responseRecorder, request)
+	api.operationHandler("Power")(responseRecorder, request)
 
 	// Check for bad status code
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
 	}
 
-	// Check error message is returned
-	expectedError := "invalid operands\n"
-	actualError := responseRecorder.Body.String()
-	if actualError != expectedError {
-		t.Fatalf("expected %v, got %v", expectedError, actualError)
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operands")
+}
+
+// TestEvaluateHandler checks the evaluate handler with the expression (3 + 4) * 2.
+// The "+" is URL encoded as %2B. The response should be 14.
+func TestEvaluateHandler(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/evaluate?expression=(3%2B4)*2", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.evaluateHandler(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"result":14}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+// TestEvaluateHandlerWithParseError checks that a malformed expression returns 400 with the column.
+func TestEvaluateHandlerWithParseError(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/evaluate?expression=(3*4", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.evaluateHandler(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+
+	// Check the problem details are returned
+	problem := expectProblem(t, responseRecorder, "parse_error", "expected \")\" at column 5")
+	if problem.Column != 5 {
+		t.Errorf("expected column 5, got %d", problem.Column)
+	}
+}
+
+// TestEvaluateHandlerWithDivisionByZero checks that division by zero inside an expression returns 400.
+func TestEvaluateHandlerWithDivisionByZero(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/evaluate?expression=1/(2-2)", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.evaluateHandler(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "divide_by_zero", "cannot divide by zero")
+}
+
+// TestAddHandlerDecimalPrecision checks that precision=decimal returns the exact sum 0.1 + 0.2 = 0.3 as a string.
+func TestAddHandlerDecimalPrecision(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/add?operand1=0.1&operand2=0.2&precision=decimal&digits=50", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Add")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"result":"0.3"}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+// TestDivideHandlerDecimalPrecisionByZero checks that decimal division by zero returns 400.
+func TestDivideHandlerDecimalPrecisionByZero(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/divide?operand1=1&operand2=0&precision=decimal", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Divide")(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "divide_by_zero", "cannot divide by zero")
+}
+
+// TestMultiplyHandlerDecimalPrecisionSavesExactHistory checks that the exact strings are stored in the history.
+func TestMultiplyHandlerDecimalPrecisionSavesExactHistory(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/multiply?operand1=123456789012345678901234567890&operand2=3&precision=decimal&digits=50", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Multiply")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	history, err := api.storage.GetHistory(context.Background(), "")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	entry := history[0]
+	if entry.Mode != "decimal" || entry.ExactResult != "370370367037037036703703703670" {
+		t.Fatalf("expected exact decimal result, got %+v", entry)
+	}
+}
+
+// TestAddHandlerWithInvalidPrecision checks that an unknown precision mode returns 400.
+func TestAddHandlerWithInvalidPrecision(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/add?operand1=1&operand2=2&precision=quad", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Add")(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+}
+
+// TestAddHandlerRationalPrecision checks that 1/3 + 1/6 returns the reduced fraction 1/2 and its decimal value.
+func TestAddHandlerRationalPrecision(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/add?operand1=1/3&operand2=1/6&precision=rational", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Add")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"decimal":"0.5","result":"1/2"}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+// TestModuloHandlerRationalPrecisionByZero checks that rational modulo by zero returns 400.
+func TestModuloHandlerRationalPrecisionByZero(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/modulo?operand1=1/2&operand2=0&precision=rational", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Modulo")(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "modulo_by_zero", "cannot modulo by zero")
+}
+
+// TestParseOperandFractionTooLong checks that fractions used as float64 operands are bounded like rational operands.
+func TestParseOperandFractionTooLong(t *testing.T) {
+	if _, err := parseOperand("1/" + strings.Repeat("3", calculator.MaxRationalOperandLength)); err == nil {
+		t.Fatalf("expected an error, got nil")
+	}
+	if operand, err := parseOperand("1/4"); err != nil || operand != 0.25 {
+		t.Fatalf("expected 0.25, got %v (%v)", operand, err)
+	}
+}
+
+// TestAddHandlerRationalPrecisionOperandTooLarge checks that an operand expanding to millions of digits returns 400.
+func TestAddHandlerRationalPrecisionOperandTooLarge(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/add?operand1=1e999999&operand2=1e-999999&precision=rational", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Add")(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "out_of_range", "result is out of range")
+}
+
+// TestMultiplyHandlerWithFractionOperands checks that fractions are accepted as float64 operands:
+// operand1 = 3/4, operand2 = 2. The response should be 1.5.
+func TestMultiplyHandlerWithFractionOperands(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/multiply?operand1=3/4&operand2=2", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Multiply")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"result":1.5}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+// TestMultiplyHandlerComplexOperands checks that complex operands are detected automatically:
+// operand1 = 1+2i, operand2 = 3-i. The response should be 5+5i.
+func TestMultiplyHandlerComplexOperands(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/multiply?operand1=1%2B2i&operand2=3-1i", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Multiply")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"result":"5+5i"}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+// TestPowerHandlerComplexPrecision checks that a negative base with a fractional exponent is
+// well defined in complex mode: (-4)^0.5 = 2i.
+func TestPowerHandlerComplexPrecision(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/power?operand1=-4&operand2=0.5&precision=complex", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Power")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// The real part is only zero up to floating point imprecision, so check the imaginary part
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if !strings.HasSuffix(actual, `+2i"}`) {
+		t.Fatalf("expected result with imaginary part 2i, got %v", actual)
+	}
+}
+
+// TestSqrtHandlerComplexHistory checks the complex square root of -4 and that the complex result is kept in the history.
+func TestSqrtHandlerComplexHistory(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/sqrt?operand=-4&precision=complex", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Sqrt")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"result":"0+2i"}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+
+	history, err := api.storage.GetHistory(context.Background(), "")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if history[0].Mode != "complex" || history[0].ExactOperand1 != "-4" || history[0].ExactResult != "0+2i" {
+		t.Fatalf("expected complex history entry, got %+v", history[0])
+	}
+}
+
+// TestAbsHandlerComplex checks the modulus of 3+4i (with the "+" decoded as a space). The response should be 5.
+func TestAbsHandlerComplex(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/abs?operand=3+4i", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Abs")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"result":"5"}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+// TestModuloHandlerComplexOperands checks that modulo, which is undefined for complex numbers, returns 400.
+func TestModuloHandlerComplexOperands(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/modulo?operand1=3%2B4i&operand2=2", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Modulo")(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+}
+
+// TestSqrtHandlerWithNegativeOperand checks that the real square root of -4 is a domain error.
+func TestSqrtHandlerWithNegativeOperand(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/sqrt?operand=-4", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Sqrt")(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "domain_error", "sqrt is undefined for -4: operand must not be negative")
+}
+
+// TestLnHandler checks the natural logarithm handler with operand = 1. The response should be 0.
+func TestLnHandler(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/ln?operand=1", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Ln")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"result":0}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+// TestLnHandlerWithNegativeOperand checks that the logarithm of a negative number returns 400.
+func TestLnHandlerWithNegativeOperand(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/ln?operand=-1", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Ln")(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "domain_error", "ln is undefined for -1: operand must be positive")
+}
+
+// TestLnHandlerWithMissingOperand checks that a missing operand returns 400.
+func TestLnHandlerWithMissingOperand(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/ln", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Ln")(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+
+	// Check the problem details are returned
+	expectProblem(t, responseRecorder, "invalid_operand", "invalid operand")
+}
+
+// TestSinHandlerDegrees checks the sine handler in degree mode with operand = 90. The response should be 1.
+func TestSinHandlerDegrees(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/sin?operand=90&angle=degrees", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Sin")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"result":1}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+// TestSinHandlerWithInvalidAngleMode checks that an unknown angle mode returns 400.
+func TestSinHandlerWithInvalidAngleMode(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/sin?operand=90&angle=gradians", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Sin")(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", responseRecorder.Code)
+	}
+}
+
+// TestFactorialHandler checks the factorial handler with operand = 5. The response should be 120.
+func TestFactorialHandler(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/factorial?operand=5", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationHandler("Factorial")(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"result":120}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+// TestOperationsHandler checks that the registered operations are listed with their metadata.
+func TestOperationsHandler(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/operations", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.operationsHandler(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the first operation directly from the response body
+	expected := `[{"name":"Add","route":"/add","symbol":"+","arity":2,"description":"Adds two numbers","canFail":false,"usesAngle":false,"precisions":["float","decimal","rational","complex"]},`
+	actual := responseRecorder.Body.String()
+	if !strings.HasPrefix(actual, expected) {
+		t.Fatalf("expected prefix %v, got %v", expected, actual)
+	}
+}
+
+// TestRegisterRoutesServesCustomOperation checks that an operation registered on the calculator
+// is mounted by RegisterRoutes and served like the built-in operations.
+func TestRegisterRoutesServesCustomOperation(t *testing.T) {
+	api := testSetup()
+
+	err := api.calculator.Registry().Register(calculator.Operation{
+		Name:   "Average",
+		Symbol: "avg",
+		Arity:  calculator.Binary,
+		Function: calculator.BinaryFunction(func(a, b float64) float64 {
+			return (a + b) / 2
+		}),
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	token, err := generateJWT("tester")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	request := httptest.NewRequest("GET", "/average?operand1=3&operand2=6", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	responseRecorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	// Check the result directly from the response body
+	expected := `{"result":4.5}`
+	actual := strings.TrimSpace(responseRecorder.Body.String())
+	if actual != expected {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+
+	// The history formatter reads the symbol from the registry as well
+	history, _ := api.storage.GetHistory(context.Background(), "tester")
+	formatted := api.formatHistoryEntry(history[0])
+	if formatted.Formatted != "3 avg 6 = 4.5" {
+		t.Fatalf("expected 3 avg 6 = 4.5, got %v", formatted.Formatted)
+	}
+}
+
+// TestHistoryHandlerFormatsEntries checks that /history includes the symbol and formatted calculation.
+func TestHistoryHandlerFormatsEntries(t *testing.T) {
+	api := testSetup()
+
+	api.operationHandler("Subtract")(httptest.NewRecorder(), requestAsUser("GET", "/subtract?operand1=10&operand2=4", "alice"))
+	api.operationHandler("Sin")(httptest.NewRecorder(), requestAsUser("GET", "/sin?operand=90&angle=degrees", "alice"))
+
+	request := requestAsUser("GET", "/history", "alice")
+	responseRecorder := httptest.NewRecorder()
+
+	api.historyHandler(responseRecorder, request)
+
+	// Check the status code
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	body := responseRecorder.Body.String()
+	for _, expected := range []string{`"Symbol":"-","Formatted":"10 - 4 = 6"`, `"Formatted":"sin(90) = 1 (degrees)"`} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %v in %v", expected, body)
+		}
+	}
+}
+
+// Function to send a request through the registered routes with a JWT for the given user
+func serveAsUser(t *testing.T, mux *http.ServeMux, method string, target string, username string) *httptest.ResponseRecorder {
+	return serveAsRole(t, mux, method, target, username, storage.RoleUser)
+}
+
+// Function to send a request through the registered routes with a JWT for the given user and role
+func serveAsRole(t *testing.T, mux *http.ServeMux, method string, target string, username string, role string) *httptest.ResponseRecorder {
+	token, err := defaultKeySet().generateJWT(username, role)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	request := httptest.NewRequest(method, target, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	responseRecorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+// TestHistoryIsolatedBetweenUsers checks that two users only see and reset their own history.
+func TestHistoryIsolatedBetweenUsers(t *testing.T) {
+	api := testSetup()
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	serveAsUser(t, mux, "GET", "/add?operand1=1&operand2=2", "alice")
+	serveAsUser(t, mux, "GET", "/multiply?operand1=3&operand2=4", "bob")
+
+	// Alice only sees her own calculation
+	responseRecorder := serveAsUser(t, mux, "GET", "/history", "alice")
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+	body := responseRecorder.Body.String()
+	if !strings.Contains(body, `"Owner":"alice"`) || strings.Contains(body, "bob") {
+		t.Fatalf("expected only alice's history, got %v", body)
+	}
+
+	// Bob resets his history, which leaves alice's history intact
+	responseRecorder = serveAsUser(t, mux, "POST", "/history/reset", "bob")
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	history, err := api.storage.GetHistory(context.Background(), "alice")
+	if err != nil || len(history) != 1 {
+		t.Fatalf("expected alice's history to be kept, got %+v (%v)", history, err)
+	}
+	if history, err := api.storage.GetHistory(context.Background(), "bob"); err != nil || len(history) != 0 {
+		t.Fatalf("expected bob's history to be reset, got %+v (%v)", history, err)
+	}
+}
+
+// TestHistoryHandlerWithoutUser checks that the history cannot be read without an authenticated user.
+func TestHistoryHandlerWithoutUser(t *testing.T) {
+	api := testSetup()
+
+	request := httptest.NewRequest("GET", "/history", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	api.historyHandler(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+	}
+}
+
+// Storage whose history operations block until the context is done, like a database that does not respond
+type blockingHistoryStorage struct {
+	storage.Storage
+}
+
+func (blocking blockingHistoryStorage) QueryHistory(ctx context.Context, query storage.HistoryQuery) (storage.HistoryPage, error) {
+	<-ctx.Done()
+	return storage.HistoryPage{}, ctx.Err()
+}
+
+// TestHistoryHandlerTimeout checks that a storage operation exceeding its deadline returns 504.
+func TestHistoryHandlerTimeout(t *testing.T) {
+	slowStorage := storage.WithDeadlines(blockingHistoryStorage{storage.NewLocalStorage()}, storage.Deadlines{GetHistory: 10 * time.Millisecond})
+	api := NewAPI(calculator.NewCalculator(), slowStorage)
+
+	request := requestAsUser("GET", "/history", "alice")
+	responseRecorder := httptest.NewRecorder()
+
+	api.historyHandler(responseRecorder, request)
+
+	// Check status code
+	if responseRecorder.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status 504, got %d", responseRecorder.Code)
+	}
+}
+
+// TestHistoryHandlerPassesRequestContext checks that cancelling the request, e.g. when the client disconnects,
+// cancels the storage operation instead of waiting for its deadline.
+func TestHistoryHandlerPassesRequestContext(t *testing.T) {
+	api := NewAPI(calculator.NewCalculator(), blockingHistoryStorage{storage.NewLocalStorage()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request := requestAsUser("GET", "/history", "alice").WithContext(ContextWithUser(ctx, "alice"))
+	responseRecorder := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		api.historyHandler(responseRecorder, request)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the handler to return after the request was cancelled")
+	}
+}
+
+// TestRegisterHandlerDuplicateUser checks that registering an existing username returns 409.
+func TestRegisterHandlerDuplicateUser(t *testing.T) {
+	api := testSetup()
+
+	for i, expected := range []int{http.StatusCreated, http.StatusConflict} {
+		request := httptest.NewRequest("POST", "/register", strings.NewReader(`{"username":"alice","password":"correct horse"}`))
+		responseRecorder := httptest.NewRecorder()
+
+		api.registerHandler(responseRecorder, request)
+
+		if responseRecorder.Code != expected {
+			t.Fatalf("registration %d: expected status %d, got %d", i+1, expected, responseRecorder.Code)
+		}
+		if expected == http.StatusConflict {
+			expectProblem(t, responseRecorder, "user_exists", "user already exists")
+		}
+	}
+}
+
+// TestLoginHandlerInvalidCredentials checks that a wrong password and an unknown user get the same 401 problem.
+func TestLoginHandlerInvalidCredentials(t *testing.T) {
+	api := testSetup()
+	api.storage.RegisterUser(context.Background(), "alice", "secret")
+
+	for _, body := range []string{
+		`{"username":"alice","password":"wrong"}`,
+		`{"username":"bob","password":"secret"}`,
+	} {
+		request := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+		responseRecorder := httptest.NewRecorder()
+
+		api.loginHandler(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+		}
+		expectProblem(t, responseRecorder, "invalid_credentials", "invalid credentials")
+	}
+}
+
+// Function to decode a page returned by /history
+func decodeHistoryPage(t *testing.T, responseRecorder *httptest.ResponseRecorder) historyPageResponse {
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", responseRecorder.Code, responseRecorder.Body.String())
+	}
+
+	var page historyPageResponse
+	err := json.NewDecoder(responseRecorder.Body).Decode(&page)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	return page
+}
+
+// TestHistoryHandlerPagination checks that the history can be read page by page with the returned token.
+func TestHistoryHandlerPagination(t *testing.T) {
+	api := testSetup()
+	for i := 1; i <= 5; i++ {
+		api.operationHandler("Add")(httptest.NewRecorder(), requestAsUser("GET", fmt.Sprintf("/add?operand1=%d&operand2=0", i), "alice"))
+	}
+
+	var results []float64
+	target := "/history?limit=2"
+	for pages := 1; ; pages++ {
+		responseRecorder := httptest.NewRecorder()
+		api.historyHandler(responseRecorder, requestAsUser("GET", target, "alice"))
+		page := decodeHistoryPage(t, responseRecorder)
+
+		for _, entry := range page.Entries {
+			results = append(results, entry.Result)
+		}
+		if page.NextPageToken == "" {
+			if pages != 3 {
+				t.Fatalf("expected 3 pages, got %d", pages)
+			}
+			break
+		}
+		target = "/history?limit=2&pageToken=" + url.QueryEscape(page.NextPageToken)
+	}
+
+	// Newest first
+	if fmt.Sprint(results) != "[5 4 3 2 1]" {
+		t.Fatalf("expected [5 4 3 2 1], got %v", results)
+	}
+}
+
+// TestHistoryHandlerFiltersAndSorts checks the operation and result filters together with sorting by result.
+func TestHistoryHandlerFiltersAndSorts(t *testing.T) {
+	api := testSetup()
+	api.operationHandler("Add")(httptest.NewRecorder(), requestAsUser("GET", "/add?operand1=5&operand2=5", "alice"))
+	api.operationHandler("Multiply")(httptest.NewRecorder(), requestAsUser("GET", "/multiply?operand1=3&operand2=3", "alice"))
+	api.operationHandler("Add")(httptest.NewRecorder(), requestAsUser("GET", "/add?operand1=1&operand2=1", "alice"))
+	api.operationHandler("Subtract")(httptest.NewRecorder(), requestAsUser("GET", "/subtract?operand1=1&operand2=1", "alice"))
+
+	responseRecorder := httptest.NewRecorder()
+	api.historyHandler(responseRecorder, requestAsUser("GET", "/history?operation=add,multiply&minResult=1&sort=result&order=asc", "alice"))
+	page := decodeHistoryPage(t, responseRecorder)
+
+	var formatted []string
+	for _, entry := range page.Entries {
+		formatted = append(formatted, entry.Formatted)
+	}
+	expected := "[1 + 1 = 2 3 * 3 = 9 5 + 5 = 10]"
+	if fmt.Sprint(formatted) != expected {
+		t.Fatalf("expected %v, got %v", expected, formatted)
+	}
+}
+
+// TestHistoryHandlerInvalidParameters checks that invalid pagination, filter and sort parameters return 400.
+func TestHistoryHandlerInvalidParameters(t *testing.T) {
+	api := testSetup()
+
+	for _, target := range []string{
+		"/history?limit=0",
+		"/history?limit=abc",
+		"/history?from=yesterday",
+		"/history?maxResult=big",
+		"/history?sort=operation",
+		"/history?order=random",
+		"/history?pageToken=invalid",
+	} {
+		responseRecorder := httptest.NewRecorder()
+		api.historyHandler(responseRecorder, requestAsUser("GET", target, "alice"))
+
+		if responseRecorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", target, responseRecorder.Code)
+		}
+	}
+}
+
+// Function to save a few calculations for alice to export
+func exportTestSetup() *API {
+	api := testSetup()
+	api.operationHandler("Add")(httptest.NewRecorder(), requestAsUser("GET", "/add?operand1=1&operand2=2", "alice"))
+	api.operationHandler("Sqrt")(httptest.NewRecorder(), requestAsUser("GET", "/sqrt?operand=9", "alice"))
+	api.operationHandler("Divide")(httptest.NewRecorder(), requestAsUser("GET", "/divide?operand1=1&operand2=4&precision=rational", "alice"))
+	api.operationHandler("Add")(httptest.NewRecorder(), requestAsUser("GET", "/add?operand1=5&operand2=5", "bob"))
+	return api
+}
+
+// TestExportHandlerCSV checks the columns and rows of a CSV export, which is the default format.
+func TestExportHandlerCSV(t *testing.T) {
+	api := exportTestSetup()
+
+	responseRecorder := httptest.NewRecorder()
+	api.exportHandler(responseRecorder, requestAsUser("GET", "/history/export?order=asc", "alice"))
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", responseRecorder.Code, responseRecorder.Body.String())
+	}
+	if contentType := responseRecorder.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Fatalf("expected text/csv, got %v", contentType)
+	}
+
+	records, err := csv.NewReader(responseRecorder.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected a header and 3 rows, got %v", records)
+	}
+	if strings.Join(records[0], ",") != "timestamp,operation,symbol,operand1,operand2,result,expression,mode,angleMode" {
+		t.Fatalf("unexpected header %v", records[0])
+	}
+
+	if _, err := time.Parse(time.RFC3339, records[1][0]); err != nil {
+		t.Fatalf("expected an RFC 3339 timestamp, got %v", records[1][0])
+	}
+	expected := [][]string{{"Add", "+", "1", "2", "3"}, {"Sqrt", "sqrt", "9", "", "3"}, {"Divide", "/", "1", "4", "1/4"}}
+	for i, row := range expected {
+		if fmt.Sprint(records[i+1][1:6]) != fmt.Sprint(row) {
+			t.Errorf("row %d: expected %v, got %v", i+1, row, records[i+1][1:6])
+		}
+	}
+}
+
+// TestExportHandlerNDJSON checks that each entry is a JSON object with numbers kept as numbers.
+func TestExportHandlerNDJSON(t *testing.T) {
+	api := exportTestSetup()
+
+	request := requestAsUser("GET", "/history/export?operation=add", "alice")
+	request.Header.Set("Accept", "application/x-ndjson")
+	responseRecorder := httptest.NewRecorder()
+	api.exportHandler(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", responseRecorder.Code, responseRecorder.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(responseRecorder.Body.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %v", lines)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if entry["operation"] != "Add" || entry["symbol"] != "+" || entry["operand1"] != 1.0 || entry["result"] != 3.0 {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+}
+
+// TestExportHandlerXLSX checks that the XLSX export is a zip package with the rows in its worksheet.
+func TestExportHandlerXLSX(t *testing.T) {
+	api := exportTestSetup()
+
+	responseRecorder := httptest.NewRecorder()
+	api.exportHandler(responseRecorder, requestAsUser("GET", "/history/export?format=xlsx&operation=divide", "alice"))
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", responseRecorder.Code, responseRecorder.Body.String())
+	}
+	if disposition := responseRecorder.Header().Get("Content-Disposition"); disposition != "attachment; filename=history.xlsx" {
+		t.Fatalf("unexpected Content-Disposition %v", disposition)
+	}
+
+	body := responseRecorder.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	var sheet string
+	for _, file := range archive.File {
+		if file.Name == "xl/worksheets/sheet1.xml" {
+			reader, err := file.Open()
+			if err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			content, _ := io.ReadAll(reader)
+			reader.Close()
+			sheet = string(content)
+		}
+	}
+
+	for _, cell := range []string{
+		`<c r="A1" t="inlineStr"><is><t>timestamp</t></is></c>`,
+		`<c r="D2"><v>1</v></c>`,
+		`<c r="F2" t="inlineStr"><is><t>1/4</t></is></c>`,
+	} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("expected worksheet to contain %s, got %s", cell, sheet)
+		}
+	}
+}
+
+// TestExportHandlerStreamsPages checks that an export longer than a storage page contains every entry once.
+func TestExportHandlerStreamsPages(t *testing.T) {
+	defer func(pageSize int) { exportPageSize = pageSize }(exportPageSize)
+	exportPageSize = 2
+
+	api := testSetup()
+	for i := 1; i <= 5; i++ {
+		api.operationHandler("Add")(httptest.NewRecorder(), requestAsUser("GET", fmt.Sprintf("/add?operand1=%d&operand2=0", i), "alice"))
+	}
+
+	responseRecorder := httptest.NewRecorder()
+	api.exportHandler(responseRecorder, requestAsUser("GET", "/history/export?format=csv", "alice"))
+
+	records, err := csv.NewReader(responseRecorder.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	var results []string
+	for _, record := range records[1:] {
+		results = append(results, record[5])
+	}
+	if fmt.Sprint(results) != "[5 4 3 2 1]" {
+		t.Fatalf("expected [5 4 3 2 1], got %v", results)
+	}
+}
+
+// TestExportHandlerNegotiation checks the format chosen for the Accept header, and 406 for unsupported formats.
+func TestExportHandlerNegotiation(t *testing.T) {
+	api := testSetup()
+
+	for _, test := range []struct {
+		target      string
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"/history/export", "*/*", http.StatusOK, "text/csv"},
+		{"/history/export", "application/json, application/x-ndjson;q=0.5", http.StatusOK, "application/x-ndjson"},
+		{"/history/export", "text/csv;q=0.2, application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"/history/export", "application/pdf", http.StatusNotAcceptable, ""},
+		{"/history/export?format=pdf", "", http.StatusNotAcceptable, ""},
+		{"/history/export?format=csv&limit=0", "", http.StatusBadRequest, ""},
+	} {
+		request := requestAsUser("GET", test.target, "alice")
+		request.Header.Set("Accept", test.accept)
+		responseRecorder := httptest.NewRecorder()
+		api.exportHandler(responseRecorder, request)
+
+		if responseRecorder.Code != test.status {
+			t.Errorf("%s (%s): expected status %d, got %d", test.target, test.accept, test.status, responseRecorder.Code)
+		}
+		if test.contentType != "" && responseRecorder.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%s (%s): expected %s, got %s", test.target, test.accept, test.contentType, responseRecorder.Header().Get("Content-Type"))
+		}
+	}
+}
+
+// Function to export the history of alice in the given format, oldest first so an import keeps the order
+func exportHistory(t *testing.T, api *API, format string) string {
+	responseRecorder := httptest.NewRecorder()
+	api.exportHandler(responseRecorder, requestAsUser("GET", "/history/export?order=asc&format="+format, "alice"))
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", responseRecorder.Code, responseRecorder.Body.String())
+	}
+	return responseRecorder.Body.String()
+}
+
+// Function to import a file into the history of alice and decode the summary
+func importHistory(t *testing.T, api *API, target string, contentType string, body string) importResponse {
+	request := requestAsUser("POST", target, "alice")
+	request.Body = io.NopCloser(strings.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	responseRecorder := httptest.NewRecorder()
+
+	api.importHandler(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", responseRecorder.Code, responseRecorder.Body.String())
+	}
+	var response importResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	return response
+}
+
+// TestImportHandlerRoundTrip checks that an export in every mode imports into an empty history, and that
+// importing it again only finds duplicates.
+func TestImportHandlerRoundTrip(t *testing.T) {
+	source := exportTestSetup()
+	source.operationHandler("Add")(httptest.NewRecorder(), requestAsUser("GET", "/add?operand1=0.1&operand2=0.2&precision=decimal&digits=10", "alice"))
+	source.operationHandler("Multiply")(httptest.NewRecorder(), requestAsUser("GET", "/multiply?operand1=1%2B2i&operand2=3-1i", "alice"))
+	source.operationHandler("Sin")(httptest.NewRecorder(), requestAsUser("GET", "/sin?operand=30&angle=degrees", "alice"))
+	source.evaluateHandler(httptest.NewRecorder(), requestAsUser("GET", "/evaluate?expression=(3%2B4)*2", "alice"))
+
+	for _, format := range []struct{ name, contentType string }{{"csv", "text/csv"}, {"ndjson", "application/x-ndjson"}} {
+		exported := exportHistory(t, source, format.name)
+		target := testSetup()
+
+		response := importHistory(t, target, "/history/import", format.contentType, exported)
+		if response.Imported != 7 || response.Rejected != 0 || response.Duplicates != 0 {
+			t.Fatalf("%s: expected 7 imported rows, got %+v", format.name, response)
+		}
+		if reexported := exportHistory(t, target, format.name); reexported != exported {
+			t.Fatalf("%s: expected the same export after importing, got\n%s\ninstead of\n%s", format.name, reexported, exported)
+		}
+
+		response = importHistory(t, target, "/history/import", format.contentType, exported)
+		if response.Imported != 0 || response.Duplicates != 7 {
+			t.Fatalf("%s: expected 7 duplicates, got %+v", format.name, response)
+		}
+	}
+}
+
+// TestImportHandlerMismatchedResult checks that rows with a wrong result are rejected, or imported and flagged.
+func TestImportHandlerMismatchedResult(t *testing.T) {
+	file := "timestamp,operation,symbol,operand1,operand2,result,expression,mode,angleMode\n" +
+		"2024-01-02T03:04:05Z,Add,+,1,2,4,,,\n" +
+		"2024-01-02T03:04:06Z,Divide,/,1,3,1/4,,rational,\n" +
+		"2024-01-02T03:04:07Z,Add,+,1,2,3,,,\n" +
+		"yesterday,Add,+,1,2,3,,,\n" +
+		"2024-01-02T03:04:08Z,Teleport,,1,2,3,,,\n"
+
+	api := testSetup()
+	response := importHistory(t, api, "/history/import", "text/csv", file)
+	if response.Imported != 1 || response.Rejected != 4 || response.Flagged != 0 {
+		t.Fatalf("expected 1 imported and 4 rejected rows, got %+v", response)
+	}
+	var lines, codes []string
+	for _, problem := range response.Problems {
+		lines = append(lines, fmt.Sprint(problem.Line))
+		codes = append(codes, problem.Code)
+	}
+	if strings.Join(lines, " ") != "2 3 5 6" {
+		t.Fatalf("expected problems on lines 2 3 5 6, got %+v", response.Problems)
+	}
+	if strings.Join(codes, " ") != "result_mismatch result_mismatch invalid_parameter unknown_operation" {
+		t.Errorf("expected the codes of the problems, got %+v", response.Problems)
+	}
+
+	api = testSetup()
+	response = importHistory(t, api, "/history/import?mismatch=flag", "text/csv", file)
+	if response.Imported != 3 || response.Flagged != 2 || response.Rejected != 2 {
+		t.Fatalf("expected 3 imported rows of which 2 flagged, got %+v", response)
+	}
+
+	// Flagged rows keep their stored result
+	history, _ := api.storage.GetHistory(context.Background(), "alice")
+	results := map[string]bool{}
+	for _, entry := range history {
+		results[formatHistoryNumber(entry.Result, entry.ExactResult, "")] = true
+	}
+	if !results["4"] || !results["1/4"] {
+		t.Fatalf("expected the stored results 4 and 1/4, got %+v", history)
+	}
+}
+
+// TestImportHandlerInvalidRequests checks the status codes of imports that cannot be read at all.
+func TestImportHandlerInvalidRequests(t *testing.T) {
+	api := testSetup()
+
+	for _, test := range []struct {
+		target      string
+		contentType string
+		status      int
+	}{
+		{"/history/import", "application/pdf", http.StatusUnsupportedMediaType},
+		{"/history/import?format=xlsx", "", http.StatusUnsupportedMediaType},
+		{"/history/import?mismatch=ignore", "text/csv", http.StatusBadRequest},
+	} {
+		request := requestAsUser("POST", test.target, "alice")
+		request.Body = io.NopCloser(strings.NewReader(""))
+		request.Header.Set("Content-Type", test.contentType)
+		responseRecorder := httptest.NewRecorder()
+
+		api.importHandler(responseRecorder, request)
+
+		if responseRecorder.Code != test.status {
+			t.Errorf("%s (%s): expected status %d, got %d", test.target, test.contentType, test.status, responseRecorder.Code)
+		}
+	}
+}
+
+// TestVerifyHandlerReportsMismatches checks that entries whose stored result differs from the current
+// calculator are reported, and that the tolerance accepts small differences.
+func TestVerifyHandlerReportsMismatches(t *testing.T) {
+	api := testSetup()
+	api.operationHandler("Add")(httptest.NewRecorder(), requestAsUser("GET", "/add?operand1=1&operand2=2", "alice"))
+	api.operationHandler("Divide")(httptest.NewRecorder(), requestAsUser("GET", "/divide?operand1=1&operand2=3&precision=rational", "alice"))
+
+	// Results as an older, less precise calculator could have stored them
+	ctx := context.Background()
+	api.storage.SaveOperation(ctx, storage.HistoryEntry{Owner: "alice", Operation: "Multiply", Operand1: 2, Operand2: 3, Result: 6.001, Timestamp: time.Now()})
+	api.storage.SaveOperation(ctx, storage.HistoryEntry{Owner: "alice", Operation: "Sqrt", Operand1: 2, Result: 1.4142, Timestamp: time.Now()})
+	api.storage.SaveOperation(ctx, storage.HistoryEntry{Owner: "alice", Operation: "Teleport", Operand1: 1, Timestamp: time.Now()})
+
+	for _, test := range []struct {
+		target   string
+		expected []string
+	}{
+		{"/history/verify", []string{"Teleport(1, 0) = 0: unknown operation", "sqrt(2) = 1.4142: 1.4142135623730951", "2 * 3 = 6.001: 6"}},
+		{"/history/verify?tolerance=0.01", []string{"Teleport(1, 0) = 0: unknown operation"}},
+		{"/history/verify?tolerance=0.01&operation=add,divide", nil},
+	} {
+		responseRecorder := httptest.NewRecorder()
+		api.verifyHandler(responseRecorder, requestAsUser("GET", test.target, "alice"))
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", test.target, responseRecorder.Code, responseRecorder.Body.String())
+		}
+
+		var report VerifyReport
+		if err := json.NewDecoder(responseRecorder.Body).Decode(&report); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+
+		var mismatches []string
+		for _, mismatch := range report.Mismatches {
+			mismatches = append(mismatches, mismatch.Formatted+": "+mismatch.Recomputed+mismatch.Error)
+		}
+		if report.Mismatched != len(test.expected) || fmt.Sprint(mismatches) != fmt.Sprint(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.target, test.expected, mismatches)
+		}
+	}
+}
+
+// TestVerifyHandlerInvalidTolerance checks that a negative or malformed tolerance returns 400.
+func TestVerifyHandlerInvalidTolerance(t *testing.T) {
+	api := testSetup()
+
+	for _, target := range []string{"/history/verify?tolerance=-1", "/history/verify?tolerance=abc"} {
+		responseRecorder := httptest.NewRecorder()
+		api.verifyHandler(responseRecorder, requestAsUser("GET", target, "alice"))
+
+		if responseRecorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", target, responseRecorder.Code)
+		}
+	}
+}
+
+// Storage that counts the writes of history entries
+type countingStorage struct {
+	storage.Storage
+	writes int
+}
+
+func (counting *countingStorage) SaveOperation(ctx context.Context, entry storage.HistoryEntry) error {
+	counting.writes++
+	return counting.Storage.SaveOperation(ctx, entry)
+}
+
+func (counting *countingStorage) SaveOperations(ctx context.Context, entries []storage.HistoryEntry) error {
+	counting.writes++
+	return counting.Storage.SaveOperations(ctx, entries)
+}
+
+// Function to send a JSON body to a route of the API as an authenticated user
+func serveJSONAsUser(t *testing.T, api *API, method string, target string, body string, username string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	token, err := generateJWT(username)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Content-Type", "application/json")
+	responseRecorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+// TestBatchHandler checks that every item gets its result or error in order, and that the history
+// of the successful items is saved in a single write.
+func TestBatchHandler(t *testing.T) {
+	counting := &countingStorage{Storage: storage.NewLocalStorage()}
+	api := NewAPI(calculator.NewCalculator(), counting)
+
+	responseRecorder := serveJSONAsUser(t, api, "POST", "/batch", `[
+		{"operation": "add", "operand1": 1, "operand2": 2},
+		{"operation": "divide", "operand1": 1, "operand2": 0},
+		{"operation": "sqrt", "operand1": "16"},
+		{"operation": "add", "operand1": "0.1", "operand2": "0.2", "precision": "decimal"},
+		{"operation": "divide", "operand1": "1/3", "operand2": "2", "precision": "rational"},
+		{"operation": "multiply", "operand1": "1+2i", "operand2": "3-1i"},
+		{"operation": "sin", "operand1": 90, "angle": "degrees"},
+		{"operation": "evaluate", "expression": "(3 + 4) * 2"},
+		{"operation": "teleport", "operand1": 1, "operand2": 2},
+		{"operation": "add", "operand1": 1}
+	]`, "alice")
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", responseRecorder.Code, responseRecorder.Body.String())
+	}
+
+	var results []map[string]interface{}
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&results); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expected := []string{"3", "error", "4", "0.3", "1/6", "5+5i", "1", "14", "error", "error"}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %v", len(expected), results)
+	}
+	for i, result := range results {
+		actual := fmt.Sprint(result["result"])
+		if _, failed := result["error"]; failed {
+			actual = "error"
+		}
+		if actual != expected[i] {
+			t.Errorf("item %d: expected %v, got %v", i, expected[i], result)
+		}
+	}
+	for i, code := range map[int]string{1: "divide_by_zero", 8: "unknown_operation", 9: "invalid_operand"} {
+		if results[i]["code"] != code {
+			t.Errorf("item %d: expected code %q, got %v", i, code, results[i])
+		}
+	}
+	if results[4]["decimal"] != "0.16666666666666666667" {
+		t.Errorf("expected the decimal approximation of 1/6, got %v", results[4])
+	}
+
+	if counting.writes != 1 {
+		t.Errorf("expected 1 write to the storage, got %d", counting.writes)
+	}
+	history, _ := counting.GetHistory(context.Background(), "alice")
+	if len(history) != 7 {
+		t.Fatalf("expected 7 history entries, got %+v", history)
+	}
+}
+
+// TestBatchHandlerInvalidRequests checks the status codes of batches that cannot be evaluated at all.
+func TestBatchHandlerInvalidRequests(t *testing.T) {
+	api := testSetup()
+
+	tooMany := "[" + strings.Repeat(`{"operation": "add", "operand1": 1, "operand2": 2},`, maxBatchItems) + `{"operation": "add", "operand1": 1, "operand2": 2}]`
+	for _, test := range []struct {
+		method string
+		body   string
+		status int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", `{"operation": "add"}`, http.StatusBadRequest},
+		{"POST", `[{"operation": "add", "operand1": true}]`, http.StatusBadRequest},
+		{"POST", tooMany, http.StatusRequestEntityTooLarge},
+	} {
+		responseRecorder := serveJSONAsUser(t, api, test.method, "/batch", test.body, "alice")
+
+		if responseRecorder.Code != test.status {
+			t.Errorf("%s %.40s: expected status %d, got %d", test.method, test.body, test.status, responseRecorder.Code)
+		}
+	}
+}
+
+// TestCalculationWithJSONBody checks that calculations accept their parameters as a JSON body on POST.
+func TestCalculationWithJSONBody(t *testing.T) {
+	api := testSetup()
+
+	for _, test := range []struct {
+		target   string
+		body     string
+		expected string
+	}{
+		{"/add", `{"operand1": 3, "operand2": 4}`, `{"result":7}`},
+		{"/add", `{"operand1": 0.1, "operand2": "0.2", "precision": "decimal"}`, `{"result":"0.3"}`},
+		{"/sin", `{"operand": 90, "angle": "degrees"}`, `{"result":1}`},
+		{"/multiply?operand1=2", `{"operand2": 5}`, `{"result":10}`},
+		{"/evaluate", `{"expression": "(3 + 4) * 2"}`, `{"result":14}`},
+	} {
+		responseRecorder := serveJSONAsUser(t, api, "POST", test.target, test.body, "alice")
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Errorf("%s %s: expected status 200, got %d: %s", test.target, test.body, responseRecorder.Code, responseRecorder.Body.String())
+			continue
+		}
+		if strings.TrimSpace(responseRecorder.Body.String()) != test.expected {
+			t.Errorf("%s %s: expected %s, got %s", test.target, test.body, test.expected, responseRecorder.Body.String())
+		}
+	}
+}
+
+// TestCalculationWithInvalidJSONBody checks that malformed, oversized and non-JSON bodies are rejected.
+func TestCalculationWithInvalidJSONBody(t *testing.T) {
+	api := testSetup()
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+	token, _ := generateJWT("alice")
+
+	for _, test := range []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		{"text/plain", `{"operand1": 3, "operand2": 4}`, http.StatusUnsupportedMediaType},
+		{"application/json", `[3, 4]`, http.StatusBadRequest},
+		{"application/json", `{"operand1": 3, "operand3": 4}`, http.StatusBadRequest},
+		{"application/json", `{"operand1": true, "operand2": 4}`, http.StatusBadRequest},
+		{"application/json", `{"operand1": "` + strings.Repeat("1", maxJSONBodyBytes) + `"}`, http.StatusRequestEntityTooLarge},
+	} {
+		request := httptest.NewRequest("POST", "/add", strings.NewReader(test.body))
+		request.Header.Set("Authorization", "Bearer "+token)
+		request.Header.Set("Content-Type", test.contentType)
+		responseRecorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != test.status {
+			t.Errorf("%s %.40s: expected status %d, got %d", test.contentType, test.body, test.status, responseRecorder.Code)
+		}
+	}
+}
+
+// TestRoutesRejectUnsupportedMethods checks that routes answer other methods with 405 and list the allowed ones.
+func TestRoutesRejectUnsupportedMethods(t *testing.T) {
+	api := testSetup()
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	for _, test := range []struct {
+		method string
+		target string
+		allow  string
+	}{
+		{"DELETE", "/add", "GET, POST, HEAD"},
+		{"PUT", "/evaluate", "GET, POST, HEAD"},
+		{"GET", "/login", "POST"},
+		{"GET", "/register", "POST"},
+		{"POST", "/operations", "GET, HEAD"},
+		{"GET", "/history/reset", "POST"},
+		{"POST", "/history", "GET, HEAD"},
+		{"GET", "/batch", "POST"},
+	} {
+		responseRecorder := serveAsUser(t, mux, test.method, test.target, "alice")
+
+		if responseRecorder.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected status 405, got %d", test.method, test.target, responseRecorder.Code)
+		}
+		if allow := responseRecorder.Header().Get("Allow"); allow != test.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", test.method, test.target, test.allow, allow)
+		}
+		expectProblem(t, responseRecorder, "method_not_allowed", "method not allowed")
+	}
+}
+
+// TestLoginRequiresJSON checks that credentials must be sent as JSON.
+func TestLoginRequiresJSON(t *testing.T) {
+	api := testSetup()
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	request := httptest.NewRequest("POST", "/login", strings.NewReader("username=alice&password=secret"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected status 415, got %d", responseRecorder.Code)
+	}
+}
+
+// recordingMux records the patterns registered by registerRoutes and passes them on to a ServeMux
+type recordingMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (mux *recordingMux) Handle(pattern string, handler http.Handler) {
+	mux.patterns = append(mux.patterns, pattern)
+	mux.ServeMux.Handle(pattern, handler)
+}
+
+// TestOpenAPIDescribesEveryRoute checks that /v1/openapi.json describes every registered route with the methods
+// it answers, and that the routes requiring a token declare the bearer scheme. Unprefixed aliases are described
+// by the document of V1 as well.
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	calc := calculator.NewCalculator()
+	calc.Registry().Register(calculator.Operation{
+		Name: "Hypot", Symbol: "hypot", Arity: calculator.Binary,
+		Function: calculator.BinaryFunction(math.Hypot),
+	})
+	api := NewAPI(calc, storage.NewLocalStorage())
+	mux := &recordingMux{ServeMux: http.NewServeMux()}
+	api.registerRoutes(mux)
+
+	responseRecorder := serveAsUser(t, mux.ServeMux, "GET", "/v1/openapi.json", "alice")
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+	var document struct {
+		OpenAPI string
+		Servers []struct{ URL string }
+		Paths   map[string]map[string]struct {
+			Security []map[string][]string
+		}
+		Components struct {
+			SecuritySchemes map[string]interface{}
+		}
+	}
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&document); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if !strings.HasPrefix(document.OpenAPI, "3.") {
+		t.Errorf("expected an OpenAPI 3 document, got version %q", document.OpenAPI)
+	}
+	if len(document.Servers) != 1 || document.Servers[0].URL != "/v1" {
+		t.Errorf("expected the server /v1, got %+v", document.Servers)
+	}
+	if _, found := document.Components.SecuritySchemes["bearerAuth"]; !found {
+		t.Errorf("expected the bearerAuth security scheme, got %v", document.Components.SecuritySchemes)
+	}
+	if _, found := document.Paths["/hypot"]; !found {
+		t.Errorf("expected the custom operation /hypot in the document")
+	}
+	paths := make(map[string]bool)
+	for _, pattern := range mux.patterns {
+		paths[strings.TrimPrefix(pattern, "/v1")] = true
+	}
+	if len(document.Paths) != len(paths) {
+		t.Errorf("expected %d paths, got %d", len(paths), len(document.Paths))
+	}
+
+	for _, pattern := range mux.patterns {
+		path, found := document.Paths[strings.TrimPrefix(pattern, "/v1")]
+		if !found {
+			t.Errorf("registered route %s is missing from the document", pattern)
+			continue
+		}
+
+		// The Allow header of an unsupported method lists the methods the route answers
+		request := httptest.NewRequest("TRACE", pattern, nil)
+		unsupported := httptest.NewRecorder()
+		mux.ServeHTTP(unsupported, request)
+		var methods []string
+		for _, method := range strings.Split(unsupported.Header().Get("Allow"), ", ") {
+			if method != http.MethodHead {
+				methods = append(methods, method)
+			}
+		}
+		if len(path) != len(methods) {
+			t.Errorf("%s: expected the methods %v, got %d methods", pattern, methods, len(path))
+		}
+
+		// Routes that reject requests without a token must declare the security scheme
+		unauthorized := httptest.NewRecorder()
+		mux.ServeHTTP(unauthorized, httptest.NewRequest(methods[0], pattern, nil))
+		for _, method := range methods {
+			operation, found := path[strings.ToLower(method)]
+			if !found {
+				t.Errorf("%s: method %s is missing from the document", pattern, method)
+				continue
+			}
+			secured := len(operation.Security) > 0
+			if secured != (unauthorized.Code == http.StatusUnauthorized) {
+				t.Errorf("%s %s: expected security %v, got status %d without a token", method, pattern, secured, unauthorized.Code)
+			}
+		}
+	}
+}
+
+// TestVersionedRoutes checks that versions are served side by side under their prefix, and that only the
+// unprefixed aliases of V1 are marked as deprecated.
+func TestVersionedRoutes(t *testing.T) {
+	api := testSetup()
+	v2 := Version{Name: "v2", routes: func(api *API) []route {
+		return []route{{
+			path: "/add", methods: []string{http.MethodGet}, auth: true,
+			handler: func(writer http.ResponseWriter, request *http.Request) {
+				writeJSON(writer, map[string]string{"version": "v2"})
+			},
+		}}
+	}}
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux, V1, v2)
+
+	for _, test := range []struct {
+		target     string
+		body       string
+		deprecated bool
+	}{
+		{"/v1/add?operand1=1&operand2=2", `{"result":3}`, false},
+		{"/add?operand1=1&operand2=2", `{"result":3}`, true},
+		{"/v2/add?operand1=1&operand2=2", `{"version":"v2"}`, false},
+	} {
+		responseRecorder := serveAsUser(t, mux, "GET", test.target, "alice")
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", test.target, responseRecorder.Code)
+		}
+		if body := strings.TrimSpace(responseRecorder.Body.String()); body != test.body {
+			t.Errorf("%s: expected %s, got %s", test.target, test.body, body)
+		}
+
+		header := responseRecorder.Header()
+		if deprecated := header.Get("Deprecation") != ""; deprecated != test.deprecated {
+			t.Errorf("%s: expected deprecated %v, got headers %v", test.target, test.deprecated, header)
+		}
+		if !test.deprecated {
+			continue
+		}
+		if deprecation := header.Get("Deprecation"); deprecation != fmt.Sprintf("@%d", legacyDeprecated.Unix()) {
+			t.Errorf("expected Deprecation @%d, got %q", legacyDeprecated.Unix(), deprecation)
+		}
+		if sunset, err := http.ParseTime(header.Get("Sunset")); err != nil || !sunset.Equal(legacySunset) {
+			t.Errorf("expected Sunset %v, got %q", legacySunset, header.Get("Sunset"))
+		}
+		if link := header.Get("Link"); link != `</v1/add>; rel="successor-version"` {
+			t.Errorf("expected a link to /v1/add, got %q", link)
+		}
+	}
+
+	// Each version only serves and describes its own routes
+	if responseRecorder := serveAsUser(t, mux, "GET", "/v2/subtract?operand1=1&operand2=2", "alice"); responseRecorder.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a route missing in v2, got %d", responseRecorder.Code)
+	}
+	var document openAPIDocument
+	if err := json.NewDecoder(serveAsUser(t, mux, "GET", "/v2/openapi.json", "alice").Body).Decode(&document); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(document.Paths) != 3 || document.Servers[0].URL != "/v2" {
+		t.Errorf("expected /add, /openapi.json and the root routes under /v2, got %v and %v", document.Paths, document.Servers)
+	}
+}
+
+// Function to write PEM encoded keys and a key file listing them into a temporary directory, returning its path
+func writeKeyFile(t *testing.T, pemFiles map[string][]byte, keyFile string) string {
+	directory := t.TempDir()
+	for name, data := range pemFiles {
+		if err := os.WriteFile(filepath.Join(directory, name), data, 0600); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+	}
+	path := filepath.Join(directory, "keys.json")
+	if err := os.WriteFile(path, []byte(keyFile), 0600); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	return path
+}
+
+// Function to PEM encode a private key as PKCS #8 and its public key as PKIX
+func encodeKeyPair(t *testing.T, private interface{}, public interface{}) ([]byte, []byte) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+}
+
+// Function to send a request with the given token through the registered routes
+func serveWithToken(mux *http.ServeMux, target string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("GET", target, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	responseRecorder := httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+// TestKeyRotation checks that tokens of a rotated key stay valid while new tokens are signed with the new key,
+// and that tokens of unknown keys or with the algorithm of another key are rejected.
+func TestKeyRotation(t *testing.T) {
+	secret := bytes.Repeat([]byte("s"), minHMACSecretBytes)
+	oldKeys, err := NewHMACKeySet(secret)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	oldToken, err := oldKeys.generateJWT("alice", storage.RoleUser)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	privatePEM, _ := encodeKeyPair(t, edPrivate, edPublic)
+	path := writeKeyFile(t, map[string][]byte{"ed25519.pem": privatePEM}, fmt.Sprintf(`{
+		"signingKey": "2026-10",
+		"keys": [
+			{"kid": "2026-10", "alg": "EdDSA", "privateKeyFile": "ed25519.pem"},
+			{"kid": "default", "alg": "HS256", "secret": %q}
+		]
+	}`, base64.StdEncoding.EncodeToString(secret)))
+
+	keys, err := LoadKeySet(path)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	api := NewAPI(calculator.NewCalculator(), storage.NewLocalStorage(), WithKeySet(keys))
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	// New tokens are signed with the new key
+	api.storage.RegisterUser(context.Background(), "alice", "secret")
+	request := httptest.NewRequest("POST", "/v1/login", strings.NewReader(`{"username":"alice","password":"secret"}`))
+	request.Header.Set("Content-Type", "application/json")
+	responseRecorder := httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, request)
+
+	var response tokenResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	newToken := strings.TrimPrefix(response.Token, "Bearer ")
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &claims{})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if parsed.Header["kid"] != "2026-10" || parsed.Method.Alg() != "EdDSA" {
+		t.Errorf("expected an EdDSA token of key 2026-10, got %v", parsed.Header)
+	}
+
+	for _, token := range []string{oldToken, newToken} {
+		if responseRecorder := serveWithToken(mux, "/v1/add?operand1=1&operand2=2", token); responseRecorder.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", responseRecorder.Code)
+		}
+	}
+
+	// A token of another secret, and an HS256 token claiming the EdDSA key, are rejected
+	unknownKeys, _ := NewHMACKeySet(bytes.Repeat([]byte("x"), minHMACSecretBytes))
+	unknownToken, _ := unknownKeys.generateJWT("alice", storage.RoleUser)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims{
+		Username:         "alice",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	forged.Header["kid"] = "2026-10"
+	forgedToken, _ := forged.SignedString([]byte(edPublic))
+
+	for _, token := range []string{unknownToken, forgedToken} {
+		responseRecorder := serveWithToken(mux, "/v1/add?operand1=1&operand2=2", token)
+		if responseRecorder.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+		}
+		expectProblem(t, responseRecorder, "invalid_token", "invalid token")
+	}
+}
+
+// TestJWKSHandler checks that the JWKS lists the public keys of the RS256 and EdDSA keys but not HS256 secrets.
+func TestJWKSHandler(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	rsaPEM, _ := encodeKeyPair(t, rsaPrivate, &rsaPrivate.PublicKey)
+	_, edPEM := encodeKeyPair(t, edPrivate, edPublic)
+	path := writeKeyFile(t, map[string][]byte{"rsa.pem": rsaPEM, "ed25519.pub.pem": edPEM}, fmt.Sprintf(`{
+		"signingKey": "rsa",
+		"keys": [
+			{"kid": "rsa", "alg": "RS256", "privateKeyFile": "rsa.pem"},
+			{"kid": "ed", "alg": "EdDSA", "publicKeyFile": "ed25519.pub.pem"},
+			{"kid": "hmac", "alg": "HS256", "secret": %q}
+		]
+	}`, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("s"), minHMACSecretBytes))))
+
+	keys, err := LoadKeySet(path)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	api := NewAPI(calculator.NewCalculator(), storage.NewLocalStorage(), WithKeySet(keys))
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	responseRecorder := httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	var response struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(response.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %v", response.Keys)
+	}
+	ed, rsaKey := response.Keys[0], response.Keys[1]
+	if ed.ID != "ed" || ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.X != base64.RawURLEncoding.EncodeToString(edPublic) {
+		t.Errorf("expected the Ed25519 public key, got %+v", ed)
+	}
+	if rsaKey.ID != "rsa" || rsaKey.KeyType != "RSA" || rsaKey.Algorithm != "RS256" ||
+		rsaKey.N != base64.RawURLEncoding.EncodeToString(rsaPrivate.N.Bytes()) || rsaKey.E != "AQAB" {
+		t.Errorf("expected the RSA public key, got %+v", rsaKey)
+	}
+
+	// Tokens of the RSA key are accepted
+	token, err := keys.generateJWT("alice", storage.RoleUser)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if responseRecorder := serveWithToken(mux, "/v1/add?operand1=1&operand2=2", token); responseRecorder.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", responseRecorder.Code)
+	}
+}
+
+// TestLoadKeySetInvalid checks that invalid key files and secrets are rejected when the server starts.
+func TestLoadKeySetInvalid(t *testing.T) {
+	if _, err := NewHMACKeySet([]byte("short")); err == nil {
+		t.Errorf("expected an error for a short secret, got nil")
+	}
+
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	_, publicPEM := encodeKeyPair(t, edPrivate, edPrivate.Public())
+	pemFiles := map[string][]byte{"ed25519.pub.pem": publicPEM}
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("s"), minHMACSecretBytes))
+
+	for _, keyFile := range []string{
+		`{"signingKey": "a", "keys": [{"kid": "a", "alg": "HS256", "secret": "c2hvcnQ="}]}`,
+		`{"signingKey": "a", "keys": [{"kid": "a", "alg": "none"}]}`,
+		`{"signingKey": "a", "keys": [{"kid": "a", "alg": "EdDSA", "publicKeyFile": "ed25519.pub.pem"}]}`,
+		`{"signingKey": "a", "keys": [{"kid": "a", "alg": "EdDSA", "privateKeyFile": "missing.pem"}]}`,
+		fmt.Sprintf(`{"signingKey": "b", "keys": [{"kid": "a", "alg": "HS256", "secret": %q}]}`, secret),
+		fmt.Sprintf(`{"signingKey": "a", "keys": [{"kid": "a", "alg": "HS256", "secret": %q}, {"kid": "a", "alg": "HS256", "secret": %q}]}`, secret, secret),
+		fmt.Sprintf(`{"signingKey": "", "keys": [{"kid": "", "alg": "HS256", "secret": %q}]}`, secret),
+	} {
+		if _, err := LoadKeySet(writeKeyFile(t, pemFiles, keyFile)); err == nil {
+			t.Errorf("expected an error for %s, got nil", keyFile)
+		}
+	}
+}
+
+// Function to post a JSON body through the registered routes, with a bearer token if one is given
+func postJSON(mux *http.ServeMux, target string, body string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", target, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", token)
+	}
+	responseRecorder := httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+// Function to decode the tokens of a response of /login or /token/refresh
+func decodeTokens(t *testing.T, responseRecorder *httptest.ResponseRecorder) tokenResponse {
+	t.Helper()
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", responseRecorder.Code, responseRecorder.Body.String())
+	}
+	var tokens tokenResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&tokens); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	return tokens
+}
+
+// Function to log in as alice through the registered routes of a new API
+func loginTestSetup(t *testing.T) (*API, *http.ServeMux, tokenResponse) {
+	api := testSetup()
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+	api.storage.RegisterUser(context.Background(), "alice", "secret")
+
+	tokens := decodeTokens(t, postJSON(mux, "/v1/login", `{"username":"alice","password":"secret"}`, ""))
+	if tokens.RefreshToken == "" || tokens.ExpiresIn != int(accessTokenLifetime/time.Second) {
+		t.Fatalf("expected a refresh token and expiresIn %v, got %+v", accessTokenLifetime, tokens)
+	}
+	return api, mux, tokens
+}
+
+// TestRefreshToken checks that a refresh token is exchanged once for new tokens that both work.
+func TestRefreshToken(t *testing.T) {
+	_, mux, tokens := loginTestSetup(t)
+
+	refreshed := decodeTokens(t, postJSON(mux, "/v1/token/refresh", fmt.Sprintf(`{"refreshToken":%q}`, tokens.RefreshToken), ""))
+	if refreshed.RefreshToken == tokens.RefreshToken || refreshed.Token == tokens.Token {
+		t.Errorf("expected new tokens, got %+v", refreshed)
+	}
+
+	request := httptest.NewRequest("GET", "/v1/add?operand1=1&operand2=2", nil)
+	request.Header.Set("Authorization", refreshed.Token)
+	responseRecorder := httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", responseRecorder.Code)
+	}
+
+	decodeTokens(t, postJSON(mux, "/v1/token/refresh", fmt.Sprintf(`{"refreshToken":%q}`, refreshed.RefreshToken), ""))
+}
+
+// TestRefreshTokenReused checks that using a refresh token twice revokes every refresh token of its session.
+func TestRefreshTokenReused(t *testing.T) {
+	_, mux, tokens := loginTestSetup(t)
+	reused := fmt.Sprintf(`{"refreshToken":%q}`, tokens.RefreshToken)
+	refreshed := decodeTokens(t, postJSON(mux, "/v1/token/refresh", reused, ""))
+
+	responseRecorder := postJSON(mux, "/v1/token/refresh", reused, "")
+	if responseRecorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+	}
+	expectProblem(t, responseRecorder, "invalid_refresh_token", errRefreshTokenReused.message)
+
+	// The refresh token issued before the reuse is revoked as well
+	responseRecorder = postJSON(mux, "/v1/token/refresh", fmt.Sprintf(`{"refreshToken":%q}`, refreshed.RefreshToken), "")
+	if responseRecorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+	}
+	expectProblem(t, responseRecorder, "invalid_refresh_token", "invalid refresh token")
+}
+
+// TestRefreshTokenExpired checks that expired and unknown refresh tokens are rejected.
+func TestRefreshTokenExpired(t *testing.T) {
+	api, mux, _ := loginTestSetup(t)
+	api.storage.SaveRefreshToken(context.Background(), storage.RefreshToken{
+		ID:        refreshTokenID("expired"),
+		Family:    "family",
+		Owner:     "alice",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+
+	for _, test := range []struct {
+		refreshToken string
+		detail       string
+	}{
+		{"expired", "refresh token has expired"},
+		{"unknown", "invalid refresh token"},
+	} {
+		responseRecorder := postJSON(mux, "/v1/token/refresh", fmt.Sprintf(`{"refreshToken":%q}`, test.refreshToken), "")
+		if responseRecorder.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected status 401, got %d", test.refreshToken, responseRecorder.Code)
+		}
+		expectProblem(t, responseRecorder, "invalid_refresh_token", test.detail)
+	}
+}
+
+// TestLogout checks that logout revokes the access token and the refresh tokens of the session.
+func TestLogout(t *testing.T) {
+	_, mux, tokens := loginTestSetup(t)
+
+	responseRecorder := postJSON(mux, "/v1/logout", fmt.Sprintf(`{"refreshToken":%q}`, tokens.RefreshToken), tokens.Token)
+	if responseRecorder.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", responseRecorder.Code)
+	}
+
+	request := httptest.NewRequest("GET", "/v1/add?operand1=1&operand2=2", nil)
+	request.Header.Set("Authorization", tokens.Token)
+	responseRecorder = httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+	}
+	expectProblem(t, responseRecorder, "token_revoked", "token has been revoked")
+
+	responseRecorder = postJSON(mux, "/v1/token/refresh", fmt.Sprintf(`{"refreshToken":%q}`, tokens.RefreshToken), "")
+	if responseRecorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+	}
+	expectProblem(t, responseRecorder, "invalid_refresh_token", "invalid refresh token")
+}
+
+// TestLogoutWithRefreshTokenOfAnotherUser checks that logging out with the refresh token of another user is rejected
+// without side effects: the session of the other user and the access token of the caller keep working.
+func TestLogoutWithRefreshTokenOfAnotherUser(t *testing.T) {
+	api, mux, aliceTokens := loginTestSetup(t)
+	api.storage.RegisterUser(context.Background(), "bob", "secret")
+	bobTokens := decodeTokens(t, postJSON(mux, "/v1/login", `{"username":"bob","password":"secret"}`, ""))
+
+	responseRecorder := postJSON(mux, "/v1/logout", fmt.Sprintf(`{"refreshToken":%q}`, aliceTokens.RefreshToken), bobTokens.Token)
+	if responseRecorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+	}
+	expectProblem(t, responseRecorder, "invalid_refresh_token", "invalid refresh token")
+
+	decodeTokens(t, postJSON(mux, "/v1/token/refresh", fmt.Sprintf(`{"refreshToken":%q}`, aliceTokens.RefreshToken), ""))
+
+	request := httptest.NewRequest("GET", "/v1/add?operand1=1&operand2=2", nil)
+	request.Header.Set("Authorization", bobTokens.Token)
+	responseRecorder = httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+}
+
+// TestLogoutWithoutBody checks that logout without a refresh token only revokes the access token.
+func TestLogoutWithoutBody(t *testing.T) {
+	_, mux, tokens := loginTestSetup(t)
+
+	request := httptest.NewRequest("POST", "/v1/logout", nil)
+	request.Header.Set("Authorization", tokens.Token)
+	responseRecorder := httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", responseRecorder.Code)
+	}
+
+	decodeTokens(t, postJSON(mux, "/v1/token/refresh", fmt.Sprintf(`{"refreshToken":%q}`, tokens.RefreshToken), ""))
+}
+
+// TestExpiredAccessToken checks that an expired access token is rejected.
+func TestExpiredAccessToken(t *testing.T) {
+	api := testSetup()
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims{
+		Username:         "alice",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))},
+	})
+	expired.Header["kid"] = api.keys.signing.id
+	token, err := expired.SignedString(api.keys.signing.private)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	responseRecorder := serveWithToken(mux, "/v1/add?operand1=1&operand2=2", token)
+	if responseRecorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+	}
+	expectProblem(t, responseRecorder, "invalid_token", "invalid token")
+}
+
+// TestReadOnlyRole checks that read-only users can read their history but not calculate or reset it.
+func TestReadOnlyRole(t *testing.T) {
+	api := testSetup()
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	for _, test := range []struct {
+		method string
+		target string
+		status int
+	}{
+		{"GET", "/v1/history", http.StatusOK},
+		{"GET", "/v1/history/verify", http.StatusOK},
+		{"GET", "/v1/operations", http.StatusOK},
+		{"GET", "/v1/add?operand1=1&operand2=2", http.StatusForbidden},
+		{"GET", "/v1/evaluate?expression=1", http.StatusForbidden},
+		{"POST", "/v1/history/reset", http.StatusForbidden},
+		{"GET", "/v1/admin/users", http.StatusForbidden},
+	} {
+		responseRecorder := serveAsRole(t, mux, test.method, test.target, "alice", storage.RoleReadOnly)
+		if responseRecorder.Code != test.status {
+			t.Fatalf("%s %s: expected status %d, got %d", test.method, test.target, test.status, responseRecorder.Code)
+		}
+		if test.status == http.StatusForbidden {
+			expectProblem(t, responseRecorder, "forbidden", "the read-only role is not allowed to do this")
+		}
+	}
+}
+
+// TestAdminRoutes checks that only admins list the users and reset the history of another user.
+func TestAdminRoutes(t *testing.T) {
+	api := testSetup()
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+	api.storage.RegisterUser(context.Background(), "alice", "secret")
+	api.storage.RegisterUser(context.Background(), "bob", "secret")
+	api.storage.SetUserRole(context.Background(), "alice", storage.RoleAdmin)
+	serveAsUser(t, mux, "GET", "/v1/add?operand1=1&operand2=2", "bob")
+
+	// Regular users are forbidden
+	for _, test := range []struct{ method, target string }{
+		{"GET", "/v1/admin/users"},
+		{"POST", "/v1/admin/users/bob/history/reset"},
+	} {
+		responseRecorder := serveAsUser(t, mux, test.method, test.target, "bob")
+		if responseRecorder.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected status 403, got %d", test.target, responseRecorder.Code)
+		}
+		expectProblem(t, responseRecorder, "forbidden", "the user role is not allowed to do this")
+	}
+
+	responseRecorder := serveAsRole(t, mux, "GET", "/v1/admin/users", "alice", storage.RoleAdmin)
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+	if body := strings.TrimSpace(responseRecorder.Body.String()); body != `[{"username":"alice","role":"admin"},{"username":"bob","role":"user"}]` {
+		t.Errorf("expected alice and bob with their roles, got %s", body)
+	}
+
+	responseRecorder = serveAsRole(t, mux, "POST", "/v1/admin/users/bob/history/reset", "alice", storage.RoleAdmin)
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+	if history, _ := api.storage.GetHistory(context.Background(), "bob"); len(history) != 0 {
+		t.Errorf("expected the history of bob to be reset, got %v", history)
+	}
+
+	responseRecorder = serveAsRole(t, mux, "POST", "/v1/admin/users/nobody/history/reset", "alice", storage.RoleAdmin)
+	if responseRecorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", responseRecorder.Code)
+	}
+	expectProblem(t, responseRecorder, "not_found", "user not found")
+}
+
+// TestTokensCarryRole checks that login puts the role of the user in the token, and a refresh the changed role.
+func TestTokensCarryRole(t *testing.T) {
+	api, mux, tokens := loginTestSetup(t)
+
+	roleOf := func(token string) string {
+		claims, err := api.keys.verifyJWT(strings.TrimPrefix(token, "Bearer "))
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		return claims.Role
+	}
+	if role := roleOf(tokens.Token); role != storage.RoleUser {
+		t.Errorf("expected the user role, got %q", role)
+	}
+
+	api.storage.SetUserRole(context.Background(), "alice", storage.RoleReadOnly)
+	refreshed := decodeTokens(t, postJSON(mux, "/v1/token/refresh", fmt.Sprintf(`{"refreshToken":%q}`, tokens.RefreshToken), ""))
+	if role := roleOf(refreshed.Token); role != storage.RoleReadOnly {
+		t.Errorf("expected the read-only role, got %q", role)
+	}
+}
+
+// Function to send a request through the registered routes with an API key
+func serveWithAPIKey(mux *http.ServeMux, method string, target string, key string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, nil)
+	request.Header.Set(apiKeyHeader, key)
+	responseRecorder := httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+// Function to create an API key of alice with the scopes through the registered routes
+func createTestAPIKey(t *testing.T, mux *http.ServeMux, token string, scopes string) newAPIKeyResponse {
+	t.Helper()
+	responseRecorder := postJSON(mux, "/v1/api-keys", fmt.Sprintf(`{"name":"nightly","scopes":%s}`, scopes), token)
+	if responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", responseRecorder.Code, responseRecorder.Body.String())
+	}
+	var key newAPIKeyResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&key); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	return key
+}
+
+// TestAPIKeys checks that an API key acts as its owner without logging in, is listed with its last use, and is
+// rejected once revoked.
+func TestAPIKeys(t *testing.T) {
+	api, mux, tokens := loginTestSetup(t)
+
+	key := createTestAPIKey(t, mux, tokens.Token, `["calculate","history:read","calculate"]`)
+	if !strings.HasPrefix(key.Key, apiKeyPrefix+key.ID+".") || key.LastUsedAt != nil {
+		t.Fatalf("expected a new key with the ID %s, got %+v", key.ID, key)
+	}
+	if fmt.Sprint(key.Scopes) != "[calculate history:read]" {
+		t.Errorf("expected the scopes calculate and history:read, got %v", key.Scopes)
+	}
+
+	// Only the hash of the secret is stored
+	stored, err := api.storage.GetAPIKey(context.Background(), key.ID)
+	if err != nil || strings.Contains(key.Key, stored.Hash) || stored.Owner != "alice" {
+		t.Fatalf("expected the hashed key of alice, got %+v, %v", stored, err)
+	}
+
+	responseRecorder := serveWithAPIKey(mux, "GET", "/v1/add?operand1=1&operand2=2", key.Key)
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+	if history, _ := api.storage.GetHistory(context.Background(), "alice"); len(history) != 1 {
+		t.Errorf("expected the calculation in the history of alice, got %v", history)
+	}
+
+	request := httptest.NewRequest("GET", "/v1/api-keys", nil)
+	request.Header.Set("Authorization", tokens.Token)
+	responseRecorder = httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, request)
+	var keys []apiKeyResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&keys); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(keys) != 1 || keys[0].ID != key.ID || keys[0].LastUsedAt == nil {
+		t.Fatalf("expected the used key %s, got %+v", key.ID, keys)
+	}
+	if strings.Contains(responseRecorder.Body.String(), key.Key) {
+		t.Errorf("expected the list not to contain the key")
+	}
+
+	// The key cannot be revoked by another user
+	responseRecorder = serveAsUser(t, mux, "DELETE", "/v1/api-keys/"+key.ID, "bob")
+	if responseRecorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", responseRecorder.Code)
+	}
+
+	request = httptest.NewRequest("DELETE", "/v1/api-keys/"+key.ID, nil)
+	request.Header.Set("Authorization", tokens.Token)
+	responseRecorder = httptest.NewRecorder()
+	mux.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", responseRecorder.Code)
+	}
+
+	responseRecorder = serveWithAPIKey(mux, "GET", "/v1/add?operand1=1&operand2=2", key.Key)
+	if responseRecorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+	}
+	expectProblem(t, responseRecorder, "invalid_api_key", "invalid API key")
+}
+
+// TestAPIKeyScopes checks that an API key only calls the routes of its scopes, and cannot manage API keys.
+func TestAPIKeyScopes(t *testing.T) {
+	_, mux, tokens := loginTestSetup(t)
+	key := createTestAPIKey(t, mux, tokens.Token, `["history:read"]`)
+
+	for _, test := range []struct {
+		method string
+		target string
+		status int
+		detail string
+	}{
+		{"GET", "/v1/history", http.StatusOK, ""},
+		{"GET", "/v1/history/export?format=csv", http.StatusOK, ""},
+		{"GET", "/v1/add?operand1=1&operand2=2", http.StatusForbidden, "the API key does not have the calculate scope"},
+		{"POST", "/v1/history/reset", http.StatusForbidden, "the API key does not have the history:write scope"},
+		{"GET", "/v1/api-keys", http.StatusForbidden, "API keys cannot be used for this route"},
+		{"POST", "/v1/logout", http.StatusForbidden, "API keys cannot be used for this route"},
+	} {
+		responseRecorder := serveWithAPIKey(mux, test.method, test.target, key.Key)
+		if responseRecorder.Code != test.status {
+			t.Fatalf("%s %s: expected status %d, got %d", test.method, test.target, test.status, responseRecorder.Code)
+		}
+		if test.status == http.StatusForbidden {
+			expectProblem(t, responseRecorder, "insufficient_scope", test.detail)
+		}
+	}
+}
+
+// TestInvalidAPIKeys checks that malformed and wrong keys are rejected, and that invalid scopes cannot be requested.
+func TestInvalidAPIKeys(t *testing.T) {
+	_, mux, tokens := loginTestSetup(t)
+	key := createTestAPIKey(t, mux, tokens.Token, `["calculate"]`)
+
+	for _, invalid := range []string{"nonsense", apiKeyPrefix + key.ID, key.Key + "x", apiKeyPrefix + "unknown.secret"} {
+		responseRecorder := serveWithAPIKey(mux, "GET", "/v1/add?operand1=1&operand2=2", invalid)
+		if responseRecorder.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected status 401, got %d", invalid, responseRecorder.Code)
+		}
+		expectProblem(t, responseRecorder, "invalid_api_key", "invalid API key")
+	}
+
+	for _, body := range []string{`{"name":"","scopes":["calculate"]}`, `{"name":"nightly","scopes":[]}`, `{"name":"nightly","scopes":["admin"]}`} {
+		responseRecorder := postJSON(mux, "/v1/api-keys", body, tokens.Token)
+		if responseRecorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d", body, responseRecorder.Code)
+		}
+	}
+}
+
+// TestAPIKeyUsesCurrentRole checks that an API key acts with the current role of its owner, so demoting the owner
+// limits their keys immediately.
+func TestAPIKeyUsesCurrentRole(t *testing.T) {
+	api, mux, tokens := loginTestSetup(t)
+	key := createTestAPIKey(t, mux, tokens.Token, `["calculate"]`)
+
+	api.storage.SetUserRole(context.Background(), "alice", storage.RoleReadOnly)
+	responseRecorder := serveWithAPIKey(mux, "GET", "/v1/add?operand1=1&operand2=2", key.Key)
+	if responseRecorder.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", responseRecorder.Code)
+	}
+	expectProblem(t, responseRecorder, "forbidden", "the read-only role is not allowed to do this")
+}
+
+// TestPasswordPolicy checks that registration rejects passwords that do not satisfy the configured policy.
+func TestPasswordPolicy(t *testing.T) {
+	api := NewAPI(calculator.NewCalculator(), storage.NewLocalStorage(),
+		WithPasswordPolicy(PasswordPolicy{MinLength: 10, RequireUpper: true, RequireDigit: true}))
+
+	for _, test := range []struct {
+		username string
+		password string
+		detail   string
+	}{
+		{"alice", "", "password is required"},
+		{"alice", "Short1", "password must be at least 10 characters"},
+		{"alice", strings.Repeat("Long1", 15), "password must be at most 72 bytes"},
+		{"Alice12345", "aLICE12345", "password must not be the username"},
+		{"alice", "lowercase123", "password must contain an upper case letter"},
+		{"alice", "NoDigitsHere", "password must contain a digit"},
+		{"alice", "Correct horse 1", ""},
+	} {
+		body := fmt.Sprintf(`{"username":%q,"password":%q}`, test.username, test.password)
+		responseRecorder := httptest.NewRecorder()
+		api.registerHandler(responseRecorder, httptest.NewRequest("POST", "/register", strings.NewReader(body)))
+
+		if test.detail == "" {
+			if responseRecorder.Code != http.StatusCreated {
+				t.Fatalf("%q: expected status 201, got %d", test.password, responseRecorder.Code)
+			}
+			continue
+		}
+		if responseRecorder.Code != http.StatusBadRequest {
+			t.Fatalf("%q: expected status 400, got %d", test.password, responseRecorder.Code)
+		}
+		expectProblem(t, responseRecorder, "weak_password", test.detail)
+	}
+}
+
+// Function to log in through the login handler from the client IP
+func loginFrom(api *API, username string, password string, ip string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", "/login", strings.NewReader(fmt.Sprintf(`{"username":%q,"password":%q}`, username, password)))
+	request.RemoteAddr = ip + ":1234"
+	responseRecorder := httptest.NewRecorder()
+	api.loginHandler(responseRecorder, request)
+	return responseRecorder
+}
+
+// TestLoginLockout checks that an account is locked after repeated failed logins, with a lockout that doubles with
+// every further failure, and that unknown users are locked out the same way.
+func TestLoginLockout(t *testing.T) {
+	api := testSetup()
+	api.storage.RegisterUser(context.Background(), "alice", "secret")
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	api.logins.now = func() time.Time { return now }
+
+	for _, username := range []string{"alice", "nobody"} {
+		for attempt := 1; attempt <= accountLockoutThreshold; attempt++ {
+			responseRecorder := loginFrom(api, username, "wrong", fmt.Sprintf("192.0.2.%d", attempt))
+			if responseRecorder.Code != http.StatusUnauthorized {
+				t.Fatalf("%s attempt %d: expected status 401, got %d", username, attempt, responseRecorder.Code)
+			}
+		}
+
+		// Even the right password is rejected while locked, from any client IP
+		responseRecorder := loginFrom(api, username, "secret", "198.51.100.1")
+		if responseRecorder.Code != http.StatusTooManyRequests {
+			t.Fatalf("%s: expected status 429, got %d", username, responseRecorder.Code)
+		}
+		if retryAfter := responseRecorder.Header().Get("Retry-After"); retryAfter != "30" {
+			t.Errorf("%s: expected Retry-After 30, got %q", username, retryAfter)
+		}
+		expectProblem(t, responseRecorder, "too_many_logins", "too many failed logins, try again later")
+	}
+
+	// The next failure doubles the lockout
+	now = now.Add(lockoutBaseDelay)
+	loginFrom(api, "alice", "wrong", "192.0.2.1")
+	responseRecorder := loginFrom(api, "alice", "secret", "192.0.2.1")
+	if retryAfter := responseRecorder.Header().Get("Retry-After"); responseRecorder.Code != http.StatusTooManyRequests || retryAfter != "60" {
+		t.Fatalf("expected status 429 with Retry-After 60, got %d with %q", responseRecorder.Code, retryAfter)
+	}
+
+	// A successful login after the lockout resets the counter of the account
+	now = now.Add(2 * lockoutBaseDelay)
+	if responseRecorder := loginFrom(api, "alice", "secret", "192.0.2.1"); responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+	if responseRecorder := loginFrom(api, "alice", "wrong", "192.0.2.1"); responseRecorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", responseRecorder.Code)
+	}
+}
+
+// TestLoginLockoutPerIP checks that a client IP guessing the passwords of many accounts is locked out, while other
+// clients can still log in.
+func TestLoginLockoutPerIP(t *testing.T) {
+	api := testSetup()
+	api.storage.RegisterUser(context.Background(), "alice", "secret")
+
+	for attempt := 1; attempt <= ipLockoutThreshold; attempt++ {
+		responseRecorder := loginFrom(api, fmt.Sprintf("user%d", attempt), "wrong", "203.0.113.7")
+		if responseRecorder.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status 401, got %d", attempt, responseRecorder.Code)
+		}
+	}
+
+	if responseRecorder := loginFrom(api, "alice", "secret", "203.0.113.7"); responseRecorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", responseRecorder.Code)
+	}
+	if responseRecorder := loginFrom(api, "alice", "secret", "203.0.113.8"); responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", responseRecorder.Code)
+	}
+}
+
+// TestDuplicateRouteMethodPanics checks that two routes with the same path and method are refused instead of one
+// silently replacing the other.
+func TestDuplicateRouteMethodPanics(t *testing.T) {
+	api := testSetup()
+	routes := []route{
+		{path: "/login", methods: []string{http.MethodPost}, handler: api.loginHandler},
+		{path: "/login", methods: []string{http.MethodGet, http.MethodPost}, handler: api.operationsHandler},
+	}
+
+	defer func() {
+		if recovered := recover(); recovered == nil {
+			t.Fatalf("expected a panic for POST /login registered twice")
+		}
+	}()
+	api.pathHandler(routes, "/login")
+}
+
+// slowAuthenticationStorage takes as long as bcrypt to check a password, so parallel logins overlap
+type slowAuthenticationStorage struct {
+	storage.Storage
+}
+
+func (slow slowAuthenticationStorage) AuthenticateUser(ctx context.Context, username string, password string) error {
+	time.Sleep(50 * time.Millisecond)
+	return slow.Storage.AuthenticateUser(ctx, username, password)
+}
+
+// TestLoginLockoutConcurrent checks that guesses sent in parallel are locked out like sequential ones, instead of
+// all passing the lockout check before the first failure is counted.
+func TestLoginLockoutConcurrent(t *testing.T) {
+	const guesses = 50
+	api := NewAPI(calculator.NewCalculator(), slowAuthenticationStorage{storage.NewLocalStorage()})
+	api.storage.RegisterUser(context.Background(), "alice", "secret")
+
+	var wait sync.WaitGroup
+	statuses := make(chan int, guesses)
+	for guess := 0; guess < guesses; guess++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			statuses <- loginFrom(api, "alice", "wrong", fmt.Sprintf("192.0.2.%d", guess)).Code
+		}()
+	}
+	wait.Wait()
+	close(statuses)
+
+	checked := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusUnauthorized:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("expected status 401 or 429, got %d", status)
+		}
+	}
+	if checked != accountLockoutThreshold {
+		t.Errorf("expected %d passwords to be checked, got %d", accountLockoutThreshold, checked)
+	}
+}
+
+// Storage whose SaveOperations fails after a number of successful writes
+type failingBatchStorage struct {
+	storage.Storage
+	successes int
+}
+
+func (failing *failingBatchStorage) SaveOperations(ctx context.Context, entries []storage.HistoryEntry) error {
+	if failing.successes == 0 {
+		return errors.New("disk full")
+	}
+	failing.successes--
+	return failing.Storage.SaveOperations(ctx, entries)
+}
+
+// Function to create a CSV import file with rows of additions
+func importFileOfAdditions(rows int) string {
+	file := "timestamp,operation,symbol,operand1,operand2,result,expression,mode,angleMode\n"
+	for row := 0; row < rows; row++ {
+		file += fmt.Sprintf("2024-01-02T03:04:05Z,Add,+,%d,1,%d,,,\n", row, row+1)
+	}
+	return file
+}
+
+// TestImportHandlerSavesInChunks checks that imported rows are saved with a write per chunk instead of per row.
+func TestImportHandlerSavesInChunks(t *testing.T) {
+	counting := &countingStorage{Storage: storage.NewLocalStorage()}
+	api := NewAPI(calculator.NewCalculator(), counting)
+
+	response := importHistory(t, api, "/history/import", "text/csv", importFileOfAdditions(2*importChunkSize+1))
+	if response.Imported != 2*importChunkSize+1 {
+		t.Fatalf("expected %d imported rows, got %+v", 2*importChunkSize+1, response)
+	}
+	if counting.writes != 3 {
+		t.Errorf("expected 3 writes, got %d", counting.writes)
+	}
+}
+
+// TestImportHandlerReportsPartialImport checks that an import failing in the storage tells how many rows were
+// saved, even though the detail of a 500 is not shown.
+func TestImportHandlerReportsPartialImport(t *testing.T) {
+	api := NewAPI(calculator.NewCalculator(), &failingBatchStorage{Storage: storage.NewLocalStorage(), successes: 1})
+
+	request := requestAsUser("POST", "/history/import", "alice")
+	request.Body = io.NopCloser(strings.NewReader(importFileOfAdditions(2 * importChunkSize)))
+	request.Header.Set("Content-Type", "text/csv")
+	responseRecorder := httptest.NewRecorder()
+	api.importHandler(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", responseRecorder.Code)
+	}
+	problem := expectProblem(t, responseRecorder, "internal_server_error", "")
+	if problem.Imported == nil || *problem.Imported != importChunkSize {
+		t.Errorf("expected %d imported rows, got %v", importChunkSize, problem.Imported)
 	}
 }
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"overengineered_calculator/storage"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Header in which programs send their API key instead of a bearer token
+const apiKeyHeader = "X-API-Key"
+
+// Prefix of the API keys, so leaked keys are easy to recognise, e.g. by secret scanners
+const apiKeyPrefix = "calc_"
+
+// How often the last-used time of an API key is updated, so a batch job does not write on every request
+const apiKeyTouchInterval = time.Minute
+
+// Scopes limit the routes an API key may call, see route.scope. Bearer tokens are not limited by scopes.
+const (
+	scopeCalculate    = "calculate"     // Calculations, /evaluate and /batch
+	scopeHistoryRead  = "history:read"  // Reading, exporting and verifying the history
+	scopeHistoryWrite = "history:write" // Resetting and importing the history
+)
+
+var apiKeyScopes = []string{scopeCalculate, scopeHistoryRead, scopeHistoryWrite}
+
+// The type of the context key of the API key that authenticated the request, see authMiddleware
+type apiKeyKeyType struct{}
+
+var apiKeyKey = apiKeyKeyType{}
+
+// apiKeyRequest is the body of POST /api-keys
+type apiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// apiKeyResponse is an API key as listed by GET /api-keys. The secret part of the key is never listed.
+type apiKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"` // Not set if the key was never used
+}
+
+// newAPIKeyResponse is the response of POST /api-keys, the only response that includes the key
+type newAPIKeyResponse struct {
+	apiKeyResponse
+	Key string `json:"key"` // Sent in the X-API-Key header
+}
+
+// Helper function to convert a stored API key to its response
+func apiKeyResponseOf(key storage.APIKey) apiKeyResponse {
+	response := apiKeyResponse{ID: key.ID, Name: key.Name, Scopes: key.Scopes, CreatedAt: key.CreatedAt}
+	if !key.LastUsedAt.IsZero() {
+		response.LastUsedAt = &key.LastUsedAt
+	}
+	return response
+}
+
+// Helper function to create a new API key of the form calc_<id>.<secret>. The ID is public and identifies the
+// key in storage, and only the hash of the secret is stored.
+func newAPIKey() (key string, id string, err error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", fmt.Errorf("could not generate an API key ID: %w", err)
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	id = hex.EncodeToString(idBytes)
+	return apiKeyPrefix + id + "." + secret, id, nil
+}
+
+// Helper function to split an API key into its ID and secret
+func parseAPIKey(key string) (id string, secret string, ok bool) {
+	key, found := strings.CutPrefix(key, apiKeyPrefix)
+	if !found {
+		return "", "", false
+	}
+	id, secret, found = strings.Cut(key, ".")
+	return id, secret, found && id != "" && secret != ""
+}
+
+// Helper function to hash the secret of an API key as it is stored
+func apiKeySecretHash(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// authenticateAPIKey verifies the API key of a request and returns it together with claims acting as its owner.
+// The role is read from storage, so a changed role applies to API keys immediately.
+func (api *API) authenticateAPIKey(ctx context.Context, key string) (storage.APIKey, *claims, error) {
+	id, secret, ok := parseAPIKey(key)
+	if !ok {
+		return storage.APIKey{}, nil, errInvalidAPIKey
+	}
+
+	apiKey, err := api.storage.GetAPIKey(ctx, id)
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		return storage.APIKey{}, nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return storage.APIKey{}, nil, err
+	}
+
+	// Compare in constant time, so the response time does not tell how much of the hash matched
+	if subtle.ConstantTimeCompare([]byte(apiKeySecretHash(secret)), []byte(apiKey.Hash)) != 1 {
+		return storage.APIKey{}, nil, errInvalidAPIKey
+	}
+
+	user, err := api.storage.GetUser(ctx, apiKey.Owner)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		return storage.APIKey{}, nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return storage.APIKey{}, nil, err
+	}
+
+	// Failing to record the use is logged but does not fail the request
+	now := time.Now()
+	if now.Sub(apiKey.LastUsedAt) > apiKeyTouchInterval {
+		if err := api.storage.TouchAPIKey(ctx, apiKey.ID, now); err != nil {
+			log.Printf("Failed to record the use of API key %s: %v", apiKey.ID, err)
+		}
+	}
+
+	return apiKey, &claims{Username: user.Username, Role: user.Role}, nil
+}
+
+// Middleware that only lets API keys with the scope through, and answers others with 403. Requests with a bearer
+// token are not limited by scopes. Routes without a scope cannot be called with an API key, e.g. managing the keys.
+func requireScope(nextHandler http.HandlerFunc, scope string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		apiKey, ok := request.Context().Value(apiKeyKey).(storage.APIKey)
+		if !ok {
+			nextHandler.ServeHTTP(writer, request)
+			return
+		}
+
+		if scope == "" {
+			writeError(writer, newAPIError(http.StatusForbidden, "insufficient_scope", "API keys cannot be used for this route"), http.StatusForbidden)
+			return
+		}
+		if !slices.Contains(apiKey.Scopes, scope) {
+			writeError(writer, newAPIError(http.StatusForbidden, "insufficient_scope", "the API key does not have the %s scope", scope), http.StatusForbidden)
+			return
+		}
+		nextHandler.ServeHTTP(writer, request)
+	}
+}
+
+// Handler for creating an API key of the user with a name and scopes, e.g. {"name": "nightly", "scopes": ["calculate"]}.
+// The key is only returned in this response.
+func (api *API) createAPIKeyHandler(writer http.ResponseWriter, request *http.Request) {
+	username, ok := UserFromContext(request.Context())
+	if !ok {
+		writeError(writer, errUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	var body apiKeyRequest
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		writeError(writer, invalidBody(err, "invalid API key request format"), http.StatusBadRequest)
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		writeError(writer, invalidParameter("name is required"), http.StatusBadRequest)
+		return
+	}
+	if len(body.Scopes) == 0 {
+		writeError(writer, invalidParameter("scopes is required, any of %s", strings.Join(apiKeyScopes, ", ")), http.StatusBadRequest)
+		return
+	}
+	for _, scope := range body.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			writeError(writer, invalidParameter("unknown scope %q, expected any of %s", scope, strings.Join(apiKeyScopes, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+	slices.Sort(body.Scopes)
+	body.Scopes = slices.Compact(body.Scopes)
+
+	key, id, err := newAPIKey()
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+	_, secret, _ := parseAPIKey(key)
+	apiKey := storage.APIKey{
+		ID:        id,
+		Hash:      apiKeySecretHash(secret),
+		Owner:     username,
+		Name:      body.Name,
+		Scopes:    body.Scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = api.storage.CreateAPIKey(request.Context(), apiKey)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusCreated)
+	json.NewEncoder(writer).Encode(newAPIKeyResponse{apiKeyResponse: apiKeyResponseOf(apiKey), Key: key})
+}
+
+// Handler for listing the API keys of the user, oldest first
+func (api *API) listAPIKeysHandler(writer http.ResponseWriter, request *http.Request) {
+	username, ok := UserFromContext(request.Context())
+	if !ok {
+		writeError(writer, errUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := api.storage.ListAPIKeys(request.Context(), username)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]apiKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, apiKeyResponseOf(key))
+	}
+	writeJSON(writer, response)
+}
+
+// Handler for revoking an API key of the user. Keys of other users are answered with 404, like unknown keys.
+func (api *API) deleteAPIKeyHandler(writer http.ResponseWriter, request *http.Request) {
+	username, ok := UserFromContext(request.Context())
+	if !ok {
+		writeError(writer, errUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	err := api.storage.DeleteAPIKey(request.Context(), username, request.PathValue("id"))
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
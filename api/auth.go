@@ -2,64 +2,39 @@ package api
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"net/http"
+	"overengineered_calculator/storage"
 	"strings"
-	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("TEST_SECRET_KEY_FOR_JWT")
+// The type is used to avoid key collisions in the context (for instance, if another middleware uses the same key).
+type usernameKeyType struct{}
 
-// claims represents the JWT claims
-type claims struct {
-	Username             string `json:"username"`
-	jwt.RegisteredClaims        // For expiration time
-}
+var usernameKey = usernameKeyType{}
 
-// GenerateJWT generates a new JWT token with the given username.
-// The token has an expiration time of 24 hours.
-func generateJWT(username string) (string, error) {
-
-	// Create the JWT claims, which include the username and expiration time
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &claims{
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
-	}
+// ContextWithUser returns a copy of the context carrying the username of the authenticated user.
+func ContextWithUser(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, usernameKey, username)
+}
 
-	// Use Hash and Sign paradigm to create token with the claims using HMAC SHA256 (HS256)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
-	if err != nil {
-		return "", fmt.Errorf("could not sign token: %w", err)
-	}
-	return tokenString, nil
+// UserFromContext returns the username stored in the context by the authentication middleware.
+func UserFromContext(ctx context.Context) (string, bool) {
+	username, ok := ctx.Value(usernameKey).(string)
+	return username, ok && username != ""
 }
 
-// ValidateJWT validates a JWT token
-func verifyJWT(tokenString string) (*claims, error) {
-	claims := &claims{}
+// The type of the context key of the claims of the access token, see authMiddleware
+type claimsKeyType struct{}
 
-	// Inner function to return secret key used to sign the JWT token.
-	// ParseWithClaims uses a function that can return the key dynamically for more complex use cases.
-	// In this case, I am using a fixed key, so I return it directly with the keyFunc.
-	keyFunc := func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	}
+var claimsKey = claimsKeyType{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc)
-	if err != nil {
-		return nil, fmt.Errorf("could not parse token: %w", err)
-	}
-	if !token.Valid {
-		return nil, errors.New("invalid token")
-	}
-	return claims, nil
+// claims represents the JWT claims
+type claims struct {
+	Username             string `json:"username"`
+	Role                 string `json:"role,omitempty"` // Empty in tokens issued before roles, which get storage.RoleUser
+	jwt.RegisteredClaims        // For expiration time and ID
 }
 
 // ExtractToken extracts the JWT token from the Authorization header and removes the "Bearer " prefix.
@@ -68,45 +43,99 @@ func extractToken(request *http.Request) (string, error) {
 	// Get the Authorization header
 	authHeader := request.Header.Get("Authorization")
 	if authHeader == "" {
-		return "", errors.New("authorization token required")
+		return "", errTokenRequired
 	}
 
 	// Split the token from Bearer in format: "Bearer <token>"
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		return "", errors.New("invalid token format")
+		return "", errTokenFormat
 	}
 
 	return parts[1], nil
 }
 
 // Middleware that checks if the request is authorized by verifying the JWT token in the Authorization header.
-// All calculations endpoints require this token authorization.
+// All calculations endpoints require this token authorization. Programs may send an API key in the X-API-Key
+// header instead, which requireScope limits to the scopes of the key.
 func (api *API) authMiddleware(nextHandler http.HandlerFunc) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 
+		// Authenticate with the API key instead of a token if given. The key is kept in the context for requireScope.
+		if key := request.Header.Get(apiKeyHeader); key != "" {
+			apiKey, claims, err := api.authenticateAPIKey(request.Context(), key)
+			if err != nil {
+				writeError(writer, err, http.StatusInternalServerError)
+				return
+			}
+			ctx := context.WithValue(ContextWithUser(request.Context(), claims.Username), claimsKey, claims)
+			nextHandler.ServeHTTP(writer, request.WithContext(context.WithValue(ctx, apiKeyKey, apiKey)))
+			return
+		}
+
 		// Extract token from the request header and remove the "Bearer " prefix
 		token, err := extractToken(request)
 		if err != nil {
-			http.Error(writer, err.Error(), http.StatusUnauthorized)
+			writeError(writer, err, http.StatusUnauthorized)
 			return
 		}
 
-		// Validate JWT
-		claims, err := verifyJWT(token)
+		// Validate JWT with the keys of the API
+		claims, err := api.keys.verifyJWT(token)
 		if err != nil {
-			http.Error(writer, "Invalid token", http.StatusUnauthorized)
+			writeError(writer, errInvalidToken, http.StatusUnauthorized)
 			return
 		}
 
-		// Token is valid. Set user information in request context.
-		// The type is used to avoid key collisions in the context (for instance, if another middleware uses the same key).
-		type usernameKeyType struct{}
-		usernameKey := usernameKeyType{}
-		ctx := context.WithValue(request.Context(), usernameKey, claims.Username)
-		request = request.WithContext(ctx)
+		// Reject tokens revoked by logout. Tokens without an ID cannot be revoked and are accepted until they expire.
+		if claims.ID != "" {
+			revoked, err := api.storage.IsAccessTokenRevoked(request.Context(), claims.ID)
+			if err != nil {
+				writeError(writer, err, http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				writeError(writer, errTokenRevoked, http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// Token is valid. Set user information in request context, so handlers can read it with UserFromContext,
+		// and the claims for logout.
+		ctx := ContextWithUser(request.Context(), claims.Username)
+		request = request.WithContext(context.WithValue(ctx, claimsKey, claims))
 
 		// Call the next handler, which is now authorized
 		nextHandler.ServeHTTP(writer, request)
 	}
 }
+
+// Middleware that only lets users with one of the roles through, and answers others with 403. It runs after
+// authMiddleware, so the role is the one in the token. A changed role applies once the user refreshes the token.
+func requireRole(nextHandler http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		claims, ok := request.Context().Value(claimsKey).(*claims)
+		if !ok {
+			writeError(writer, errUnauthorized, http.StatusUnauthorized)
+			return
+		}
+
+		role := claims.Role
+		if role == "" {
+			role = storage.RoleUser
+		}
+		for _, allowed := range roles {
+			if role == allowed {
+				nextHandler.ServeHTTP(writer, request)
+				return
+			}
+		}
+		writeError(writer, newAPIError(http.StatusForbidden, "forbidden", "the %s role is not allowed to do this", role), http.StatusForbidden)
+	}
+}
+
+// Handler for the public keys of the asymmetric keys of the API as a JSON Web Key Set, so other services can
+// verify the tokens without sharing a secret. The keys are listed by their kid, which tokens carry in their header.
+func (api *API) jwksHandler(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, map[string]interface{}{"keys": api.keys.jwks()})
+}
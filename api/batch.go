@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"overengineered_calculator/calculator"
+	"overengineered_calculator/storage"
+	"strings"
+	"time"
+)
+
+// Largest number of calculations in a batch. It matches the number of writes Firestore accepts in
+// a single commit, so the history of a batch is always saved in one write.
+const maxBatchItems = 500
+
+// Largest request body accepted by /batch, see RegisterRoutes
+const maxBatchBytes = 1 << 20
+
+// batchItem is a single calculation of a batch. Operands are numbers or strings, e.g. "3/4" or "1+2i".
+// Unary operations only use operand1, and "evaluate" uses the expression instead of the operands.
+type batchItem struct {
+	Operation  string       `json:"operation"`
+	Operand1   batchOperand `json:"operand1"`
+	Operand2   batchOperand `json:"operand2"`
+	Expression string       `json:"expression"`
+	Precision  string       `json:"precision"` // As the precision parameter of the operations
+	Digits     uint         `json:"digits"`    // Significant digits in decimal precision, default 34
+	Angle      string       `json:"angle"`     // "radians" (default) or "degrees" for trigonometric operations
+}
+
+// batchOperand is an operand given either as a JSON number or as a string
+type batchOperand string
+
+func (operand *batchOperand) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		*operand = batchOperand(number)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return errors.New("operands must be numbers or strings")
+	}
+	*operand = batchOperand(text)
+	return nil
+}
+
+// batchResult is the outcome of a single calculation, with either a result or an error. The result is a number,
+// or a string in the exact precision modes and for results that are not finite, e.g. "+Inf". Rational results
+// also have their decimal approximation, like the response of the operations.
+type batchResult struct {
+	Result  interface{} `json:"result,omitempty"`
+	Decimal string      `json:"decimal,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"` // Stable code of the error, as in the problem details of a failed request
+}
+
+// Handler for evaluating many calculations in one request. The body is a JSON array of batchItem, and the response
+// holds a batchResult for each item in the same order. The history of the successful calculations is saved in a
+// single write to the storage.
+func (api *API) batchHandler(writer http.ResponseWriter, request *http.Request) {
+	username, found := UserFromContext(request.Context())
+	if !found {
+		writeError(writer, errUnauthorized, http.StatusUnauthorized)
+		return
+	}
+	var items []batchItem
+	err := json.NewDecoder(request.Body).Decode(&items)
+	if err != nil {
+		writeError(writer, invalidBody(err, "invalid batch: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(items) > maxBatchItems {
+		writeError(writer, newAPIError(http.StatusRequestEntityTooLarge, "too_many_items", "a batch can contain at most %d calculations", maxBatchItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]batchResult, len(items))
+	entries := make([]storage.HistoryEntry, 0, len(items))
+	for i, item := range items {
+		entry, result, err := api.calculateBatchItem(item)
+		if err != nil {
+			results[i] = batchResult{Error: err.Error(), Code: errorCode(err)}
+			continue
+		}
+
+		results[i] = result
+		entry.Owner = username
+		entry.Timestamp = time.Now()
+		entries = append(entries, entry)
+	}
+
+	// Like a single calculation, failing to save the history does not fail the batch
+	if len(entries) > 0 {
+		err = api.storage.SaveOperations(request.Context(), entries)
+		if err != nil {
+			log.Printf("Failed to save history: %v", err)
+		}
+	}
+
+	writeJSON(writer, results)
+}
+
+// calculateBatchItem computes a single calculation with the operation from the registry, in the same way as
+// its route, and returns the history entry to save together with the result.
+func (api *API) calculateBatchItem(item batchItem) (storage.HistoryEntry, batchResult, error) {
+	var entry storage.HistoryEntry
+
+	if item.Expression != "" || strings.EqualFold(item.Operation, "evaluate") {
+		entry.Expression = item.Expression
+		entry.Operation = "Evaluate"
+		if _, err := api.recomputeExpression(&entry); err != nil {
+			return entry, batchResult{}, err
+		}
+		return entry, batchResult{Result: batchNumber(entry.Result)}, nil
+	}
+
+	operation, found := api.calculator.Registry().Lookup(item.Operation)
+	if !found {
+		return entry, batchResult{}, errUnknownOperation
+	}
+	entry.Operation = operation.Name
+
+	operands := []string{string(item.Operand1), string(item.Operand2)}[:operation.Arity]
+	for _, operand := range operands {
+		if operand == "" {
+			return entry, batchResult{}, calculator.ErrInvalidOperand
+		}
+	}
+
+	// Without a precision, operands with an imaginary part select complex mode like in the query string
+	precision := item.Precision
+	if precision == "" {
+		precision = precisionFloat
+		for _, operand := range operands {
+			if calculator.IsComplexOperand(operand) {
+				precision = precisionComplex
+			}
+		}
+	}
+
+	switch precision {
+	case precisionFloat:
+		entry.AngleMode = item.Angle
+		if _, err := computeFloat(&entry, operation, operands); err != nil {
+			return entry, batchResult{}, err
+		}
+		return entry, batchResult{Result: batchNumber(entry.Result)}, nil
+
+	case precisionDecimal:
+		digits := item.Digits
+		if digits == 0 {
+			digits = calculator.DefaultDecimalDigits
+		}
+		decimalCalculator, err := calculator.NewDecimalCalculator(digits)
+		if err != nil {
+			return entry, batchResult{}, err
+		}
+
+		entry.Mode = precisionDecimal
+		result, err := computeDecimal(&entry, operation, operands, decimalCalculator, decimalCalculator.Digits())
+		if err != nil {
+			return entry, batchResult{}, err
+		}
+		return entry, batchResult{Result: result}, nil
+
+	case precisionRational:
+		entry.Mode = precisionRational
+		result, err := computeRational(&entry, operation, operands)
+		if err != nil {
+			return entry, batchResult{}, err
+		}
+		// The result is not an operand, so it is read without the bounds of RationalCalculator.Parse, as an exact
+		// power may be longer than an operand can be
+		rationalCalculator := calculator.NewRationalCalculator()
+		fraction, _ := new(big.Rat).SetString(result)
+		return entry, batchResult{Result: result, Decimal: rationalCalculator.Approximate(fraction)}, nil
+
+	case precisionComplex:
+		entry.Mode = precisionComplex
+		result, err := computeComplex(&entry, operation, operands)
+		if err != nil {
+			return entry, batchResult{}, err
+		}
+		return entry, batchResult{Result: result}, nil
+	}
+	return entry, batchResult{}, errInvalidPrecision
+}
+
+// Helper function to return a float64 result as a JSON number, or as a string if JSON cannot represent it
+func batchNumber(value float64) interface{} {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return formatHistoryNumber(value, "", "")
+	}
+	return value
+}
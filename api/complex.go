@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"overengineered_calculator/calculator"
+	"overengineered_calculator/storage"
+	"strings"
+)
+
+// Helper function to parse a single complex operand from the query string. A "+" in a query string is
+// decoded as a space, so "3+4i" arrives as "3 4i" unless encoded as "3%2B4i". Spaces are never valid
+// inside a number, so they are turned back into "+" here for convenience.
+func parseComplexOperand(calc *calculator.ComplexCalculator, value string) (complex128, error) {
+	return calc.Parse(strings.ReplaceAll(strings.TrimSpace(value), " ", "+"))
+}
+
+// Helper function to parse operands from the request as complex numbers
+func parseComplexOperands(request *http.Request, calc *calculator.ComplexCalculator) (complex128, complex128, error) {
+	operand1, err1 := parseComplexOperand(calc, request.URL.Query().Get("operand1"))
+	operand2, err2 := parseComplexOperand(calc, request.URL.Query().Get("operand2"))
+	if err1 != nil || err2 != nil {
+		return 0, 0, errInvalidOperands
+	}
+
+	return operand1, operand2, nil
+}
+
+// Generic handler for binary operations in complex mode. The result is returned as a string, e.g. "3+4i".
+func (api *API) complexOperationHandler(writer http.ResponseWriter, request *http.Request, operation calculator.Operation) {
+	if operation.Complex == nil {
+		writeError(writer, unsupportedPrecision("complex numbers"), http.StatusBadRequest)
+		return
+	}
+
+	complexCalculator := calculator.NewComplexCalculator()
+	operand1, operand2, err := parseComplexOperands(request, complexCalculator)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+
+	result, err := operation.Complex(complexCalculator, []complex128{operand1, operand2})
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+
+	// The float64 fields hold the real parts, while the exact fields keep the full complex numbers
+	api.saveEntryToHistory(request, storage.HistoryEntry{
+		Operation:     operation.Name,
+		Operand1:      real(operand1),
+		Operand2:      real(operand2),
+		Result:        real(result),
+		Mode:          precisionComplex,
+		ExactOperand1: complexCalculator.Format(operand1),
+		ExactOperand2: complexCalculator.Format(operand2),
+		ExactResult:   complexCalculator.Format(result),
+	})
+
+	writeResultJSON(writer, complexCalculator.Format(result))
+}
+
+// Generic handler for unary complex operations (Sqrt, Abs, Arg, Conj) taking the single parameter "operand".
+func (api *API) complexUnaryOperationHandler(writer http.ResponseWriter, request *http.Request, operation calculator.Operation) {
+	complexCalculator := calculator.NewComplexCalculator()
+
+	operand, err := parseComplexOperand(complexCalculator, request.URL.Query().Get("operand"))
+	if err != nil {
+		writeError(writer, calculator.ErrInvalidOperand, http.StatusBadRequest)
+		return
+	}
+
+	result, err := operation.Complex(complexCalculator, []complex128{operand})
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+
+	api.saveEntryToHistory(request, storage.HistoryEntry{
+		Operation:     operation.Name,
+		Operand1:      real(operand),
+		Result:        real(result),
+		Mode:          precisionComplex,
+		ExactOperand1: complexCalculator.Format(operand),
+		ExactResult:   complexCalculator.Format(result),
+	})
+
+	writeResultJSON(writer, complexCalculator.Format(result))
+}
+
+// Helper function to decide if a unary operation should use complex numbers. This is the case when
+// requested with precision=complex or when the operand has an imaginary part.
+func isComplexUnaryRequest(request *http.Request) bool {
+	query := request.URL.Query()
+	return query.Get("precision") == precisionComplex || calculator.IsComplexOperand(query.Get("operand"))
+}
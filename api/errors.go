@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"overengineered_calculator/calculator"
+	"overengineered_calculator/storage"
+	"strings"
+)
+
+// apiError is an error of the API itself, e.g. a missing parameter, with the status and stable code of its response
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (err *apiError) Error() string {
+	return err.message
+}
+
+// Helper function to create an error of the API. Errors with fixed messages are declared once below.
+func newAPIError(status int, code string, format string, args ...interface{}) *apiError {
+	return &apiError{status: status, code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// Errors of the API with fixed messages
+var (
+	errUnauthorized     = newAPIError(http.StatusUnauthorized, "unauthorized", "unauthorized")
+	errInvalidToken     = newAPIError(http.StatusUnauthorized, "invalid_token", "invalid token")
+	errMethodNotAllowed = newAPIError(http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	errNotJSON          = newAPIError(http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/json")
+	errInvalidOperands  = newAPIError(http.StatusBadRequest, "invalid_operand", "invalid operands")
+	errInvalidPrecision = newAPIError(http.StatusBadRequest, "invalid_precision", "invalid precision")
+	errUnknownOperation = newAPIError(http.StatusNotFound, "unknown_operation", "unknown operation")
+	errTokenRequired    = newAPIError(http.StatusUnauthorized, "unauthorized", "authorization token required")
+	errTokenFormat      = newAPIError(http.StatusUnauthorized, "invalid_token", "invalid token format")
+	errTokenRevoked     = newAPIError(http.StatusUnauthorized, "token_revoked", "token has been revoked")
+
+	errInvalidRefreshToken = newAPIError(http.StatusUnauthorized, "invalid_refresh_token", "invalid refresh token")
+	errRefreshTokenExpired = newAPIError(http.StatusUnauthorized, "invalid_refresh_token", "refresh token has expired")
+	errRefreshTokenReused  = newAPIError(http.StatusUnauthorized, "invalid_refresh_token", "refresh token was already used, the session is revoked")
+
+	errInvalidAPIKey = newAPIError(http.StatusUnauthorized, "invalid_api_key", "invalid API key")
+
+	errTooManyLogins = newAPIError(http.StatusTooManyRequests, "too_many_logins", "too many failed logins, try again later")
+)
+
+// Helper function to create the error of a parameter or body field with an invalid value
+func invalidParameter(format string, args ...interface{}) *apiError {
+	return newAPIError(http.StatusBadRequest, "invalid_parameter", format, args...)
+}
+
+// Helper function to create the error of a request body that cannot be decoded. A body over the size limit
+// keeps its *http.MaxBytesError, so it is answered with 413 instead of 400.
+func invalidBody(err error, format string, args ...interface{}) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return err
+	}
+	return newAPIError(http.StatusBadRequest, "invalid_body", format, args...)
+}
+
+// Helper function to create the error of an operation that does not support a precision mode
+func unsupportedPrecision(description string) *apiError {
+	return newAPIError(http.StatusBadRequest, "unsupported_precision", "operation does not support %s", description)
+}
+
+// Status and stable code of the errors of the calculator and storage packages. More specific errors come
+// first, e.g. storage.ErrUserExists before the storage.ErrConflict it wraps.
+var errorCodes = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{calculator.ErrDivideByZero, http.StatusBadRequest, "divide_by_zero"},
+	{calculator.ErrModuloByZero, http.StatusBadRequest, "modulo_by_zero"},
+	{calculator.ErrOutOfRange, http.StatusBadRequest, "out_of_range"},
+	{calculator.ErrIntegerExponent, http.StatusBadRequest, "integer_exponent_required"},
+	{calculator.ErrExponentTooLarge, http.StatusBadRequest, "exponent_too_large"},
+	{calculator.ErrZeroToNegativePower, http.StatusBadRequest, "zero_to_negative_power"},
+	{calculator.ErrInvalidOperand, http.StatusBadRequest, "invalid_operand"},
+	{calculator.ErrInvalidDigits, http.StatusBadRequest, "invalid_digits"},
+	{calculator.ErrInvalidAngleMode, http.StatusBadRequest, "invalid_angle_mode"},
+
+	{storage.ErrInvalidPageToken, http.StatusBadRequest, "invalid_page_token"},
+	{storage.ErrTooManyOperations, http.StatusBadRequest, "invalid_parameter"},
+	{storage.ErrUserExists, http.StatusConflict, "user_exists"},
+	{storage.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{storage.ErrTimeout, http.StatusGatewayTimeout, "storage_timeout"},
+	{storage.ErrNotFound, http.StatusNotFound, "not_found"},
+	{storage.ErrConflict, http.StatusConflict, "conflict"},
+}
+
+// classifyError returns the status and stable code of the response to an error. Errors that are not known,
+// e.g. a failing database, get the given status and a code derived from it, such as "internal_server_error".
+func classifyError(err error, status int) (int, string) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.status, apiErr.code
+	}
+
+	for _, errorCode := range errorCodes {
+		if errors.Is(err, errorCode.err) {
+			return errorCode.status, errorCode.code
+		}
+	}
+
+	var domainErr *calculator.DomainError
+	var parseErr *calculator.ParseError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &domainErr):
+		return http.StatusBadRequest, "domain_error"
+	case errors.As(err, &parseErr):
+		return http.StatusBadRequest, "parse_error"
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, "body_too_large"
+	}
+
+	return status, strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// Helper function to get only the stable code of an error, e.g. for the items of a batch
+func errorCode(err error) string {
+	_, code := classifyError(err, http.StatusBadRequest)
+	return code
+}
+
+// problemDetails is an error response as defined by RFC 7807 (application/problem+json). The type is always
+// "about:blank", so the title is the HTTP status text, and clients branch on the code instead of the detail.
+type problemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	Column int    `json:"column,omitempty"` // Position of a parse_error in the expression
+
+	Imported *int `json:"imported,omitempty"` // Rows of /history/import saved before the error
+}
+
+// writeError writes the error as problem details. The status is used for errors that classifyError does not know.
+// Internal errors are logged instead of returning their message, which may contain details of the backend.
+func writeError(writer http.ResponseWriter, err error, status int) {
+	status, code := classifyError(err, status)
+
+	problem := problemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+		Code:   code,
+	}
+	if status >= http.StatusInternalServerError && status != http.StatusGatewayTimeout {
+		log.Printf("Internal error: %v", err)
+		problem.Detail = ""
+	}
+
+	var parseErr *calculator.ParseError
+	if errors.As(err, &parseErr) {
+		problem.Column = parseErr.Column
+	}
+	var importErr *importError
+	if errors.As(err, &importErr) {
+		problem.Imported = &importErr.imported
+	}
+
+	writer.Header().Set("Content-Type", "application/problem+json")
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(problem)
+}
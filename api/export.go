@@ -0,0 +1,303 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"overengineered_calculator/calculator"
+	"overengineered_calculator/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of entries fetched from the storage at a time while exporting. Only one page is held in memory.
+var exportPageSize = 500
+
+// Columns of an exported history, in order
+var exportColumns = []string{
+	"timestamp", "operation", "symbol", "operand1", "operand2", "result", "expression", "mode", "angleMode",
+}
+
+// exportFormat is a file format the history can be exported as
+type exportFormat struct {
+	Name        string
+	ContentType string
+	newWriter   func(io.Writer) (exportWriter, error)
+}
+
+// Formats supported by /history/export. The first one is used when the client accepts any format.
+var exportFormats = []exportFormat{
+	{"csv", "text/csv", newCSVExportWriter},
+	{"ndjson", "application/x-ndjson", newNDJSONExportWriter},
+	{"xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", func(writer io.Writer) (exportWriter, error) {
+		return newXLSXWriter(writer)
+	}},
+}
+
+// errNotAcceptable is returned when none of the accepted formats can be exported
+var errNotAcceptable = newAPIError(http.StatusNotAcceptable, "not_acceptable", "not acceptable, supported formats are "+
+	"text/csv, application/x-ndjson and application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+
+// exportCell is a single value of an exported row. Numeric cells are written as numbers where the format has them.
+type exportCell struct {
+	Value   string
+	Numeric bool
+}
+
+// exportWriter writes the rows of an export in a specific format. Close finishes the file.
+type exportWriter interface {
+	WriteRow(cells []exportCell) error
+	Close() error
+}
+
+// Handler for exporting the history of the authenticated user as a file. It takes the same filter and sort
+// parameters as /history, and the format is chosen with the format parameter or the Accept header.
+// The history is read from the storage page by page and streamed to the client.
+func (api *API) exportHandler(writer http.ResponseWriter, request *http.Request) {
+	username, found := UserFromContext(request.Context())
+	if !found {
+		writeError(writer, errUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	format, err := negotiateExportFormat(request)
+	if err != nil {
+		writeError(writer, err, http.StatusNotAcceptable)
+		return
+	}
+
+	query, err := api.parseHistoryQuery(request, username)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+	query.Limit = exportPageSize
+	query.PageToken = ""
+
+	// The first page is read before anything is written, so storage errors still get a proper status code
+	page, err := api.storage.QueryHistory(request.Context(), query)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", format.ContentType)
+	writer.Header().Set("Content-Disposition", "attachment; filename=history."+format.Name)
+	writer.WriteHeader(http.StatusOK)
+
+	// Once the status is sent, errors can only be logged. The response is cut short, which leaves
+	// an XLSX file unreadable and an NDJSON or CSV file without its last rows.
+	err = api.streamExport(writer, request, format, query, page)
+	if err != nil {
+		log.Printf("history export for %s failed: %v", username, err)
+	}
+}
+
+// Helper function to write the header row and all pages of the history, starting with the given first page
+func (api *API) streamExport(writer http.ResponseWriter, request *http.Request, format exportFormat, query storage.HistoryQuery, page storage.HistoryPage) error {
+	flusher := http.NewResponseController(writer)
+
+	rows, err := format.newWriter(writer)
+	if err != nil {
+		return err
+	}
+
+	header := make([]exportCell, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = exportCell{Value: column}
+	}
+	if err := rows.WriteRow(header); err != nil {
+		return err
+	}
+
+	for {
+		for _, entry := range page.Entries {
+			if err := rows.WriteRow(api.exportRow(entry)); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+
+		if page.NextPageToken == "" {
+			return rows.Close()
+		}
+
+		query.PageToken = page.NextPageToken
+		page, err = api.storage.QueryHistory(request.Context(), query)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// exportRow converts a history entry to the cells of exportColumns. Exact operands and results are preferred
+// over their float64 approximations. Expressions have no operands, and unary operations no second operand.
+func (api *API) exportRow(entry storage.HistoryEntry) []exportCell {
+	var symbol, operand1, operand2 string
+	if entry.Expression == "" {
+		symbol = entry.Operation
+		operand1 = formatHistoryNumber(entry.Operand1, entry.ExactOperand1, "")
+		operand2 = formatHistoryNumber(entry.Operand2, entry.ExactOperand2, "")
+
+		if operation, found := api.calculator.Registry().Lookup(entry.Operation); found {
+			symbol = operation.Symbol
+			if operation.Arity == calculator.Unary {
+				operand2 = ""
+			}
+		}
+	}
+
+	return []exportCell{
+		{Value: entry.Timestamp.UTC().Format(time.RFC3339)},
+		{Value: entry.Operation},
+		{Value: symbol},
+		newExportNumber(operand1),
+		newExportNumber(operand2),
+		newExportNumber(formatHistoryNumber(entry.Result, entry.ExactResult, "")),
+		{Value: entry.Expression},
+		{Value: entry.Mode},
+		{Value: entry.AngleMode},
+	}
+}
+
+// Helper function to create a cell for a formatted number. Only plain decimal numbers are numeric,
+// fractions such as "3/4", complex numbers and values like "NaN" are kept as text.
+func newExportNumber(value string) exportCell {
+	numeric := value != "" && (value[0] == '-' || (value[0] >= '0' && value[0] <= '9')) && json.Valid([]byte(value))
+	return exportCell{Value: value, Numeric: numeric}
+}
+
+// negotiateExportFormat picks the export format from the format parameter, or else from the Accept header.
+// Without either, or when any type is accepted, the history is exported as CSV.
+func negotiateExportFormat(request *http.Request) (exportFormat, error) {
+	if name := request.URL.Query().Get("format"); name != "" {
+		for _, format := range exportFormats {
+			if strings.EqualFold(name, format.Name) {
+				return format, nil
+			}
+		}
+		return exportFormat{}, errNotAcceptable
+	}
+
+	accept := request.Header.Get("Accept")
+	if accept == "" {
+		return exportFormats[0], nil
+	}
+
+	// Choose the format with the highest quality. Ties go to the media range listed first.
+	var best exportFormat
+	bestQuality := 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, found := params["q"]; found {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if quality <= bestQuality {
+			continue
+		}
+
+		for _, format := range exportFormats {
+			if mediaType == "*/*" || mediaType == format.ContentType || mediaType == strings.Split(format.ContentType, "/")[0]+"/*" {
+				best, bestQuality = format, quality
+				break
+			}
+		}
+	}
+
+	if bestQuality == 0 {
+		return exportFormat{}, errNotAcceptable
+	}
+	return best, nil
+}
+
+// csvExportWriter writes the export as comma separated values with a header row
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVExportWriter(writer io.Writer) (exportWriter, error) {
+	return &csvExportWriter{writer: csv.NewWriter(writer)}, nil
+}
+
+func (writer *csvExportWriter) WriteRow(cells []exportCell) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = cell.Value
+	}
+	err := writer.writer.Write(record)
+	if err != nil {
+		return err
+	}
+
+	// Flush every row, so the rows reach the client when the response is flushed
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+func (writer *csvExportWriter) Close() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+// ndjsonExportWriter writes the export as newline delimited JSON, one object per entry. The header row
+// gives the keys of the objects and is not written itself. Empty values are left out.
+type ndjsonExportWriter struct {
+	writer io.Writer
+	keys   []string
+}
+
+func newNDJSONExportWriter(writer io.Writer) (exportWriter, error) {
+	return &ndjsonExportWriter{writer: writer}, nil
+}
+
+func (writer *ndjsonExportWriter) WriteRow(cells []exportCell) error {
+	if writer.keys == nil {
+		writer.keys = make([]string, len(cells))
+		for i, cell := range cells {
+			writer.keys[i] = cell.Value
+		}
+		return nil
+	}
+
+	// The object is built by hand to keep the order of the columns
+	var builder strings.Builder
+	builder.WriteString("{")
+	for i, cell := range cells {
+		if cell.Value == "" {
+			continue
+		}
+		if builder.Len() > 1 {
+			builder.WriteString(",")
+		}
+
+		key, _ := json.Marshal(writer.keys[i])
+		builder.Write(key)
+		builder.WriteString(":")
+		if cell.Numeric {
+			builder.WriteString(cell.Value)
+		} else {
+			value, _ := json.Marshal(cell.Value)
+			builder.Write(value)
+		}
+	}
+	builder.WriteString("}\n")
+
+	_, err := io.WriteString(writer.writer, builder.String())
+	return err
+}
+
+func (writer *ndjsonExportWriter) Close() error {
+	return nil
+}
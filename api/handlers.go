@@ -4,84 +4,156 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"overengineered_calculator/calculator"
 	"overengineered_calculator/storage"
+	"strconv"
 )
 
-// Generic handler for operations that return no error (Add, Subtract, Multiply, Power)
-func (api *API) operationHandler(writer http.ResponseWriter, request *http.Request, operation string, functionType calculatorOperation) {
+// Returns the handler serving a registered operation, e.g. operationHandler("Add") for /add.
+// The operation is looked up per request, so the handler always reflects the calculator's registry.
+func (api *API) operationHandler(name string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		operation, found := api.calculator.Registry().Lookup(name)
+		if !found {
+			writeError(writer, errUnknownOperation, http.StatusNotFound)
+			return
+		}
+
+		if operation.Arity == calculator.Unary {
+			api.unaryOperationHandler(writer, request, operation)
+		} else {
+			api.binaryOperationHandler(writer, request, operation)
+		}
+	}
+}
+
+// Generic handler for binary operations taking the parameters "operand1" and "operand2".
+// Exact precision modes are dispatched to their own handlers.
+func (api *API) binaryOperationHandler(writer http.ResponseWriter, request *http.Request, operation calculator.Operation) {
+	precision, err := parsePrecision(request)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+	if precision != precisionFloat {
+		api.exactOperationHandler(writer, request, operation, precision)
+		return
+	}
+
 	operand1, operand2, err := parseOperands(request)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		writeError(writer, err, http.StatusBadRequest)
 		return
 	}
 
-	result := functionType(operand1, operand2)
-	api.saveToHistory(operation, operand1, operand2, result)
+	result, err := operation.Function([]float64{operand1, operand2}, calculator.Radians)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+	api.saveToHistory(request, operation.Name, operand1, operand2, result)
 	writeResultJSON(writer, result)
 }
 
-// Generic handler for operations that return an error (Divide, Modulo)
-func (api *API) operationHandlerWithError(writer http.ResponseWriter, request *http.Request, operation string, functionType calculatorOperationWithError) {
-	operand1, operand2, err := parseOperands(request)
+// Generic handler for unary operations taking the single parameter "operand". Operations that
+// use the angle mode read it from the "angle" parameter ("radians" or "degrees").
+func (api *API) unaryOperationHandler(writer http.ResponseWriter, request *http.Request, operation calculator.Operation) {
+	if operation.Complex != nil && isComplexUnaryRequest(request) {
+		api.complexUnaryOperationHandler(writer, request, operation)
+		return
+	}
+
+	var mode calculator.AngleMode
+	if operation.UsesAngle {
+		var err error
+		mode, err = calculator.ParseAngleMode(request.URL.Query().Get("angle"))
+		if err != nil {
+			writeError(writer, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	operand, err := parseUnaryOperand(request)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		writeError(writer, err, http.StatusBadRequest)
 		return
 	}
 
-	result, err := functionType(operand1, operand2)
+	result, err := operation.Function([]float64{operand}, mode)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		writeError(writer, err, http.StatusBadRequest)
 		return
 	}
-	api.saveToHistory(operation, operand1, operand2, result)
+	api.saveUnaryToHistory(request, operation.Name, operand, result, mode)
 	writeResultJSON(writer, result)
 }
 
-// Handler for Add operation
-func (api *API) addHandler(writer http.ResponseWriter, request *http.Request) {
-	api.operationHandler(writer, request, "Add", api.calculator.Add)
-}
+// Handler for listing the registered operations, so clients can discover what the calculator supports
+func (api *API) operationsHandler(writer http.ResponseWriter, request *http.Request) {
+	operations := api.calculator.Registry().Operations()
 
-// Handler for Subtract operation
-func (api *API) subtractHandler(writer http.ResponseWriter, request *http.Request) {
-	api.operationHandler(writer, request, "Subtract", api.calculator.Subtract)
+	descriptions := make([]operationDescription, 0, len(operations))
+	for _, operation := range operations {
+		descriptions = append(descriptions, describeOperation(operation))
+	}
+	writeJSON(writer, descriptions)
 }
 
-// Handler for Multiply operation
-func (api *API) multiplyHandler(writer http.ResponseWriter, request *http.Request) {
-	api.operationHandler(writer, request, "Multiply", api.calculator.Multiply)
-}
+// Handler for evaluating a full infix expression such as "(3 + 4) * 2 ^ 5 % 7".
+// Note that "+" must be URL encoded as "%2B" in the query string, otherwise it is decoded as a space.
+func (api *API) evaluateHandler(writer http.ResponseWriter, request *http.Request) {
+	expression := request.URL.Query().Get("expression")
 
-// Handler for Divide operation
-func (api *API) divideHandler(writer http.ResponseWriter, request *http.Request) {
-	api.operationHandlerWithError(writer, request, "Divide", api.calculator.Divide)
+	result, err := api.calculator.Evaluate(expression)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+	api.saveExpressionToHistory(request, expression, result)
+	writeResultJSON(writer, result)
 }
 
-// Handler for Modulo operation
-func (api *API) moduloHandler(writer http.ResponseWriter, request *http.Request) {
-	api.operationHandlerWithError(writer, request, "Modulo", api.calculator.Modulo)
-}
+// Handler for retrieving a page of the history of the authenticated user, see parseHistoryQuery for the parameters
+func (api *API) historyHandler(writer http.ResponseWriter, request *http.Request) {
+	username, found := UserFromContext(request.Context())
+	if !found {
+		writeError(writer, errUnauthorized, http.StatusUnauthorized)
+		return
+	}
 
-// Handler for Power operation
-func (api *API) powerHandler(writer http.ResponseWriter, request *http.Request) {
-	api.operationHandler(writer, request, "Power", api.calculator.Power)
-}
+	query, err := api.parseHistoryQuery(request, username)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
 
-// Handler for retrieving history
-func (api *API) historyHandler(writer http.ResponseWriter, request *http.Request) {
-	history, err := api.storage.GetHistory()
+	page, err := api.storage.QueryHistory(request.Context(), query)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		writeError(writer, err, http.StatusInternalServerError)
 		return
 	}
-	writer.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(writer).Encode(history)
+	writeJSON(writer, historyPageResponse{
+		Entries:       api.formatHistory(page.Entries),
+		NextPageToken: page.NextPageToken,
+	})
 }
 
-// Handler for resetting calculator history
+// Handler for resetting the calculator history of the authenticated user
 func (api *API) resetHandler(writer http.ResponseWriter, request *http.Request) {
-	api.storage.ResetHistory()
+	username, found := UserFromContext(request.Context())
+	if !found {
+		writeError(writer, errUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	err := api.storage.ResetHistory(request.Context(), username)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
 	writer.WriteHeader(http.StatusOK)
 }
 
@@ -92,38 +164,55 @@ func (api *API) loginHandler(writer http.ResponseWriter, request *http.Request)
 	var user storage.User
 	err := json.NewDecoder(request.Body).Decode(&user)
 	if err != nil {
-		http.Error(writer, "Invalid credentials format", http.StatusBadRequest)
+		writeError(writer, invalidBody(err, "invalid credentials format"), http.StatusBadRequest)
+		return
+	}
+
+	// Reject the login without checking the password while the account or client IP is locked out. Otherwise the
+	// attempt counts as failed until the password turns out to be right, see loginThrottle.attempt.
+	ip := clientIP(request)
+	if wait := api.logins.attempt(user.Username, ip); wait > 0 {
+		writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(writer, errTooManyLogins, http.StatusTooManyRequests)
 		return
 	}
 
-	// Authenticate user using storage strategy
-	err = api.storage.AuthenticateUser(user.Username, user.Password)
+	// Authenticate user using storage strategy. Unknown users get the same error as wrong passwords, and the
+	// backends take as long to reject them, so neither the response nor its timing tells which usernames exist.
+	err = api.storage.AuthenticateUser(request.Context(), user.Username, user.Password)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		err = storage.ErrInvalidCredentials
+	}
 	if err != nil {
-		http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+		if !errors.Is(err, storage.ErrInvalidCredentials) {
+			api.logins.released(user.Username, ip)
+		}
+		writeError(writer, err, http.StatusInternalServerError)
 		return
 	}
+	api.logins.succeeded(user.Username, ip)
 
-	// Generate JWT (JSON Web Token)
-	token, err := generateJWT(user.Username)
+	// Read the role of the user, which the access token carries
+	authenticated, err := api.storage.GetUser(request.Context(), user.Username)
 	if err != nil {
-		http.Error(writer, "Could not generate token", http.StatusInternalServerError)
+		writeError(writer, err, http.StatusInternalServerError)
 		return
 	}
 
-	// // Set the token as a cookie in the response
-	// http.SetCookie(writer, &http.Cookie{
-	// 	Name:    "token",
-	// 	Value:   token,
-	// 	Expires: time.Now().Add(24 * time.Hour),
-	// })
-	// json.NewEncoder(writer).Encode(map[string]string{"token": token})
+	// Generate the access token (JWT) and the refresh token of a new session
+	family, err := randomToken(16)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+	response, err := api.issueTokens(request.Context(), authenticated, family)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
 
-	// Return the token in the response body
-	writer.Header().Set("Content-Type", "application/json")
-	writer.WriteHeader(http.StatusOK)
-	json.NewEncoder(writer).Encode(map[string]string{
-		"token": "Bearer " + token, // Adding 'Bearer' as per jwt.io/introduction
-	})
+	// Return the tokens in the response body
+	writeJSON(writer, response)
 }
 
 // Handler for user registration
@@ -133,18 +222,21 @@ func (api *API) registerHandler(writer http.ResponseWriter, request *http.Reques
 	var user storage.User
 	err := json.NewDecoder(request.Body).Decode(&user)
 	if err != nil {
-		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		writeError(writer, invalidBody(err, "invalid request format"), http.StatusBadRequest)
+		return
+	}
+
+	// Reject passwords that do not satisfy the password policy
+	err = api.passwords.check(user.Username, user.Password)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
 		return
 	}
 
 	// Use storage strategy to register the user
-	err = api.storage.RegisterUser(user.Username, user.Password)
+	err = api.storage.RegisterUser(request.Context(), user.Username, user.Password)
 	if err != nil {
-		if err.Error() == "user already exists" {
-			http.Error(writer, "User already exists", http.StatusConflict)
-		} else {
-			http.Error(writer, "Could not register user", http.StatusInternalServerError)
-		}
+		writeError(writer, err, http.StatusInternalServerError)
 		return
 	}
 
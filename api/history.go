@@ -0,0 +1,179 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"overengineered_calculator/calculator"
+	"overengineered_calculator/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyPageResponse is a page of the history as returned by /history. The nextPageToken is passed
+// as the pageToken parameter to get the next page, and is omitted on the last page.
+type historyPageResponse struct {
+	Entries       []historyEntryResponse `json:"entries"`
+	NextPageToken string                 `json:"nextPageToken,omitempty"`
+}
+
+// parseHistoryQuery reads the pagination, filter and sort parameters of /history:
+//
+//	limit         entries per page (default 50, at most 1000)
+//	pageToken     nextPageToken of the previous page
+//	operation     operation to include, e.g. "add". May be repeated or comma separated
+//	from, to      time range as RFC 3339 timestamps, from inclusive and to exclusive
+//	minResult     smallest result to include
+//	maxResult     largest result to include
+//	sort          "timestamp" (default) or "result"
+//	order         "desc" (default) or "asc"
+func (api *API) parseHistoryQuery(request *http.Request, owner string) (storage.HistoryQuery, error) {
+	params := request.URL.Query()
+	query := storage.HistoryQuery{Owner: owner, PageToken: params.Get("pageToken")}
+
+	if limit := params.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > storage.MaxHistoryLimit {
+			return query, invalidParameter("limit must be between 1 and %d", storage.MaxHistoryLimit)
+		}
+		query.Limit = value
+	}
+
+	// Operations are stored by their registered name, so "add" matches "Add"
+	for _, names := range params["operation"] {
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if operation, found := api.calculator.Registry().Lookup(name); found {
+				name = operation.Name
+			} else if strings.EqualFold(name, "Evaluate") {
+				name = "Evaluate"
+			}
+			if name != "" {
+				query.Operations = append(query.Operations, name)
+			}
+		}
+	}
+
+	var err error
+	if query.From, err = parseHistoryTime(params.Get("from")); err != nil {
+		return query, invalidParameter("invalid from")
+	}
+	if query.To, err = parseHistoryTime(params.Get("to")); err != nil {
+		return query, invalidParameter("invalid to")
+	}
+	if query.MinResult, err = parseHistoryResult(params.Get("minResult")); err != nil {
+		return query, invalidParameter("invalid minResult")
+	}
+	if query.MaxResult, err = parseHistoryResult(params.Get("maxResult")); err != nil {
+		return query, invalidParameter("invalid maxResult")
+	}
+
+	switch sort := params.Get("sort"); sort {
+	case "", string(storage.SortByTimestamp):
+		query.SortBy = storage.SortByTimestamp
+	case string(storage.SortByResult):
+		query.SortBy = storage.SortByResult
+	default:
+		return query, invalidParameter(`sort must be "timestamp" or "result"`)
+	}
+
+	switch order := params.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		query.Ascending = true
+	default:
+		return query, invalidParameter(`order must be "asc" or "desc"`)
+	}
+
+	return query, nil
+}
+
+// Helper function to parse an optional RFC 3339 timestamp. An empty string gives the zero time.
+func parseHistoryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Helper function to parse an optional result bound. An empty string gives nil.
+func parseHistoryResult(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// historyEntryResponse is a history entry as returned by /history, extended with the symbol of
+// the operation and a human readable form of the calculation, e.g. "3 + 4 = 7".
+type historyEntryResponse struct {
+	storage.HistoryEntry
+	Symbol    string
+	Formatted string
+}
+
+// formatHistory formats all entries of a history, keeping their order.
+func (api *API) formatHistory(history []storage.HistoryEntry) []historyEntryResponse {
+	formatted := make([]historyEntryResponse, 0, len(history))
+	for _, entry := range history {
+		formatted = append(formatted, api.formatHistoryEntry(entry))
+	}
+	return formatted
+}
+
+// formatHistoryEntry formats a single entry using the symbol of its operation from the registry.
+// Exact operands and results are preferred over their float64 approximations.
+func (api *API) formatHistoryEntry(entry storage.HistoryEntry) historyEntryResponse {
+	operand1 := formatHistoryNumber(entry.Operand1, entry.ExactOperand1, entry.Mode)
+	operand2 := formatHistoryNumber(entry.Operand2, entry.ExactOperand2, entry.Mode)
+	result := formatHistoryNumber(entry.Result, entry.ExactResult, "")
+
+	if entry.Expression != "" {
+		return historyEntryResponse{
+			HistoryEntry: entry,
+			Formatted:    fmt.Sprintf("%s = %s", entry.Expression, result),
+		}
+	}
+
+	operation, found := api.calculator.Registry().Lookup(entry.Operation)
+	if !found {
+		// The operation is no longer registered, so fall back to its name
+		return historyEntryResponse{
+			HistoryEntry: entry,
+			Symbol:       entry.Operation,
+			Formatted:    fmt.Sprintf("%s(%s, %s) = %s", entry.Operation, operand1, operand2, result),
+		}
+	}
+
+	var formatted string
+	if operation.Arity == calculator.Unary {
+		formatted = fmt.Sprintf("%s(%s) = %s", operation.Symbol, strings.Trim(operand1, "()"), result)
+		if entry.AngleMode == string(calculator.Degrees) {
+			formatted += " (degrees)"
+		}
+	} else {
+		formatted = fmt.Sprintf("%s %s %s = %s", operand1, operation.Symbol, operand2, result)
+	}
+
+	return historyEntryResponse{
+		HistoryEntry: entry,
+		Symbol:       operation.Symbol,
+		Formatted:    formatted,
+	}
+}
+
+// formatHistoryNumber returns the exact representation if present, otherwise the shortest float64 representation.
+// Complex operands are wrapped in parentheses so "(1+2i) * (3-1i)" stays readable.
+func formatHistoryNumber(value float64, exact string, mode string) string {
+	if exact == "" {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	if mode == precisionComplex && strings.Contains(exact, "i") {
+		return "(" + exact + ")"
+	}
+	return exact
+}
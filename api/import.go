@@ -0,0 +1,355 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"overengineered_calculator/storage"
+	"strings"
+)
+
+// Largest request body accepted by /history/import
+const maxImportBytes = 32 << 20
+
+// Number of problems listed in the response of an import. Further problems are only counted.
+const maxImportProblems = 100
+
+// Number of rows saved with one SaveOperations, so a large import does not take a round trip per row
+const importChunkSize = 500
+
+// Error of rows whose stored result differs from the recomputed one
+var errImportMismatch = newAPIError(http.StatusBadRequest, "result_mismatch", "stored result does not match the recomputed result")
+
+// importResponse is the summary returned by /history/import. Duplicates are rows that are already in the
+// history or earlier in the file. Rejected rows are not imported, while flagged rows are imported even though
+// their result does not match the recomputed one (only with mismatch=flag).
+type importResponse struct {
+	Imported   int             `json:"imported"`
+	Duplicates int             `json:"duplicates"`
+	Rejected   int             `json:"rejected"`
+	Flagged    int             `json:"flagged"`
+	Problems   []importProblem `json:"problems"`
+}
+
+// importProblem describes a rejected or flagged row. Line is the line of the row in the file.
+type importProblem struct {
+	Line    int    `json:"line"`
+	Error   string `json:"error"`
+	Code    string `json:"code"`
+	Flagged bool   `json:"flagged,omitempty"`
+}
+
+// importReader reads the rows of an import file as values keyed by the export column names, see exportColumns.
+// Read returns io.EOF after the last row. A *rowError only affects the row at its line and reading may continue.
+type importReader interface {
+	Read() (map[string]string, int, error)
+}
+
+// rowError is an error in a single row of an import file
+type rowError struct {
+	line int
+	err  error
+}
+
+func (err *rowError) Error() string {
+	return err.err.Error()
+}
+
+// importError is an error that stopped an import after some rows were saved. writeError reports the number
+// in the imported member of the problem details, as it does not show the detail of 5xx responses.
+type importError struct {
+	err      error
+	imported int
+}
+
+func (err *importError) Error() string {
+	return fmt.Sprintf("%v (imported %d rows before the error)", err.err, err.imported)
+}
+
+func (err *importError) Unwrap() error {
+	return err.err
+}
+
+// Handler for importing history from a CSV or NDJSON file as produced by /history/export. The format is chosen
+// with the format parameter or the Content-Type of the body. Every row is recomputed with the calculator, and
+// rows whose stored result disagrees are rejected, or imported and flagged with mismatch=flag. Rows that are
+// already in the history are skipped, based on a hash of their exported columns.
+func (api *API) importHandler(writer http.ResponseWriter, request *http.Request) {
+	username, found := UserFromContext(request.Context())
+	if !found {
+		writeError(writer, errUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	var flagMismatches bool
+	switch mismatch := request.URL.Query().Get("mismatch"); mismatch {
+	case "", "reject":
+	case "flag":
+		flagMismatches = true
+	default:
+		writeError(writer, invalidParameter(`mismatch must be "reject" or "flag"`), http.StatusBadRequest)
+		return
+	}
+
+	body := http.MaxBytesReader(writer, request.Body, maxImportBytes)
+	rows, err := newImportReader(request, body)
+	if err != nil {
+		writeError(writer, err, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	seen, err := api.historyHashes(request, username)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := importResponse{Problems: []importProblem{}}
+	addProblem := func(line int, err error, code string, flagged bool) {
+		if len(response.Problems) < maxImportProblems {
+			response.Problems = append(response.Problems, importProblem{Line: line, Error: err.Error(), Code: code, Flagged: flagged})
+		}
+	}
+
+	// Rows are saved in chunks. The lines of the flagged rows are only reported once their chunk is saved.
+	var pending []storage.HistoryEntry
+	var pendingFlagged []int
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := api.storage.SaveOperations(request.Context(), pending); err != nil {
+			return &importError{err: err, imported: response.Imported}
+		}
+		response.Imported += len(pending)
+		response.Flagged += len(pendingFlagged)
+		for _, line := range pendingFlagged {
+			addProblem(line, errImportMismatch, errImportMismatch.code, true)
+		}
+		pending, pendingFlagged = nil, nil
+		return nil
+	}
+
+	for {
+		row, line, err := rows.Read()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			response.Rejected++
+			addProblem(rowErr.line, rowErr.err, "invalid_row", false)
+			continue
+		}
+		if err != nil {
+			// The rows before the error are imported, which the error tells
+			if flushErr := flush(); flushErr != nil {
+				writeError(writer, flushErr, http.StatusInternalServerError)
+				return
+			}
+			writeError(writer, &importError{err: err, imported: response.Imported}, http.StatusBadRequest)
+			return
+		}
+
+		entry, err := api.importRow(row)
+		flagged := false
+		if errors.Is(err, errImportMismatch) && flagMismatches {
+			flagged = true
+		} else if err != nil {
+			response.Rejected++
+			addProblem(line, err, errorCode(err), false)
+			continue
+		}
+
+		hash := api.historyHash(entry)
+		if seen[hash] {
+			response.Duplicates++
+			continue
+		}
+
+		entry.Owner = username
+		seen[hash] = true
+		pending = append(pending, entry)
+		if flagged {
+			pendingFlagged = append(pendingFlagged, line)
+		}
+
+		if len(pending) == importChunkSize {
+			if err := flush(); err != nil {
+				writeError(writer, err, http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(writer, response)
+}
+
+// Helper function to create the reader for the format of the import, given by the format parameter or the Content-Type
+func newImportReader(request *http.Request, body io.Reader) (importReader, error) {
+	name := request.URL.Query().Get("format")
+	if name == "" {
+		mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+		for _, format := range exportFormats {
+			if mediaType == format.ContentType {
+				name = format.Name
+			}
+		}
+	}
+
+	switch strings.ToLower(name) {
+	case "csv":
+		return newCSVImportReader(body)
+	case "ndjson":
+		return &ndjsonImportReader{scanner: newNDJSONScanner(body)}, nil
+	}
+	return nil, newAPIError(http.StatusUnsupportedMediaType, "unsupported_media_type", "unsupported import format, use text/csv or application/x-ndjson")
+}
+
+// historyHashes returns the hashes of every entry in the history of the owner, read page by page
+func (api *API) historyHashes(request *http.Request, owner string) (map[string]bool, error) {
+	hashes := make(map[string]bool)
+	query := storage.HistoryQuery{Owner: owner, Limit: storage.MaxHistoryLimit}
+
+	for {
+		page, err := api.storage.QueryHistory(request.Context(), query)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range page.Entries {
+			hashes[api.historyHash(entry)] = true
+		}
+		if page.NextPageToken == "" {
+			return hashes, nil
+		}
+		query.PageToken = page.NextPageToken
+	}
+}
+
+// historyHash identifies the content of an entry by the hash of its exported columns, so an entry and
+// its imported copy have the same hash even though the export only keeps the timestamp to the second.
+func (api *API) historyHash(entry storage.HistoryEntry) string {
+	hash := sha256.New()
+	for _, cell := range api.exportRow(entry) {
+		// Each value is followed by a zero byte, which cannot occur in the values themselves
+		io.WriteString(hash, cell.Value+"\x00")
+	}
+	return string(hash.Sum(nil))
+}
+
+// importRow converts a row to a history entry with recomputeRow. It returns errImportMismatch together with
+// the entry if the stored result differs from the recomputed one, in which case the entry keeps the stored result.
+func (api *API) importRow(row map[string]string) (storage.HistoryEntry, error) {
+	entry, result, err := api.recomputeRow(row)
+	if err != nil {
+		return entry, err
+	}
+
+	if stored := row["result"]; result != stored {
+		if value, err := parseOperand(stored); err == nil {
+			entry.Result = value
+		}
+		if entry.Mode != "" {
+			entry.ExactResult = stored
+		}
+		return entry, errImportMismatch
+	}
+	return entry, nil
+}
+
+// csvImportReader reads a CSV file whose first row names the columns
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func newCSVImportReader(body io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+
+	columns, err := reader.Read()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (reader *csvImportReader) Read() (map[string]string, int, error) {
+	record, err := reader.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, parseErr.Line, &rowError{line: parseErr.Line, err: parseErr.Err}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	line, _ := reader.reader.FieldPos(0)
+	if len(record) != len(reader.columns) {
+		return nil, line, &rowError{line: line, err: csv.ErrFieldCount}
+	}
+
+	row := make(map[string]string, len(record))
+	for i, value := range record {
+		row[reader.columns[i]] = value
+	}
+	return row, line, nil
+}
+
+// ndjsonImportReader reads a file with one JSON object per line. Numbers are kept as written.
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// Helper function to create a line scanner that accepts lines up to the size of an import
+func newNDJSONScanner(body io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, maxImportBytes)
+	return scanner
+}
+
+func (reader *ndjsonImportReader) Read() (map[string]string, int, error) {
+	for reader.scanner.Scan() {
+		reader.line++
+		text := strings.TrimSpace(reader.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			return nil, reader.line, &rowError{line: reader.line, err: errors.New("invalid JSON")}
+		}
+
+		row := make(map[string]string, len(object))
+		for key, value := range object {
+			switch value := value.(type) {
+			case string:
+				row[key] = value
+			case json.Number:
+				row[key] = value.String()
+			default:
+				return nil, reader.line, &rowError{line: reader.line, err: fmt.Errorf("invalid value of %s", key)}
+			}
+		}
+		return row, reader.line, nil
+	}
+
+	if err := reader.scanner.Err(); err != nil {
+		return nil, reader.line, err
+	}
+	return nil, reader.line, io.EOF
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Shortest accepted secret of an HS256 key, as HMAC SHA256 keys should have at least 256 bits
+const minHMACSecretBytes = 32
+
+// Lifetime of the access tokens. They are short-lived, as clients get new ones with their refresh token.
+const accessTokenLifetime = 15 * time.Minute
+
+// KeySet holds the keys of the tokens. New tokens are signed with the signing key and carry its ID in
+// the "kid" header, while tokens signed by any key of the set are accepted. A key is rotated by adding
+// the new key as signing key and keeping the old one until the tokens it signed have expired.
+type KeySet struct {
+	signing *signingKey
+	keys    map[string]*signingKey // Keyed by ID
+}
+
+// signingKey is a key of a KeySet. Keys given only by their public key can verify tokens but not sign them.
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private interface{} // []byte for HS256, *rsa.PrivateKey or ed25519.PrivateKey. Nil for verification only.
+	public  interface{} // []byte for HS256, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// Helper function to create a key set from its keys. The signing key must be one of them and have a private key.
+func newKeySet(signingID string, keys []*signingKey) (*KeySet, error) {
+	keySet := &KeySet{keys: make(map[string]*signingKey, len(keys))}
+	for _, key := range keys {
+		if key.id == "" {
+			return nil, errors.New("every key needs a kid")
+		}
+		if _, found := keySet.keys[key.id]; found {
+			return nil, fmt.Errorf("duplicate kid %q", key.id)
+		}
+		keySet.keys[key.id] = key
+	}
+
+	keySet.signing = keySet.keys[signingID]
+	if keySet.signing == nil {
+		return nil, fmt.Errorf("signing key %q is not in the key set", signingID)
+	}
+	if keySet.signing.private == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingID)
+	}
+	return keySet, nil
+}
+
+// NewHMACKeySet returns a key set with a single HS256 key, e.g. for a secret from the environment
+func NewHMACKeySet(secret []byte) (*KeySet, error) {
+	if len(secret) < minHMACSecretBytes {
+		return nil, fmt.Errorf("the secret must be at least %d bytes", minHMACSecretBytes)
+	}
+	key := &signingKey{id: "default", method: jwt.SigningMethodHS256, private: secret, public: secret}
+	return newKeySet(key.id, []*signingKey{key})
+}
+
+// defaultKeySet returns the key set of APIs created without WithKeySet. Its HS256 key is random and created once
+// per process, so no one can mint tokens from the source, but tokens are not valid after a restart.
+var defaultKeySet = sync.OnceValue(func() *KeySet {
+	secret := make([]byte, minHMACSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("could not generate a random key: %v", err))
+	}
+	keySet, _ := NewHMACKeySet(secret)
+	return keySet
+})
+
+// keyFile is the format of the file read by LoadKeySet, e.g.
+//
+//	{
+//	  "signingKey": "2026-10",
+//	  "keys": [
+//	    {"kid": "2026-10", "alg": "EdDSA", "privateKeyFile": "ed25519-2026-10.pem"},
+//	    {"kid": "2026-04", "alg": "RS256", "publicKeyFile": "rsa-2026-04.pub.pem"},
+//	    {"kid": "legacy", "alg": "HS256", "secret": "<base64 of at least 32 bytes>"}
+//	  ]
+//	}
+//
+// Paths of PEM files are relative to the key file. A key with only a public key verifies tokens but cannot sign.
+type keyFile struct {
+	SigningKey string `json:"signingKey"`
+	Keys       []struct {
+		ID             string `json:"kid"`
+		Algorithm      string `json:"alg"`
+		Secret         string `json:"secret"`
+		PrivateKeyFile string `json:"privateKeyFile"`
+		PublicKeyFile  string `json:"publicKeyFile"`
+	} `json:"keys"`
+}
+
+// LoadKeySet reads a key set from a JSON key file, see keyFile for the format
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %v", path, err)
+	}
+
+	// Helper function to read a PEM file next to the key file
+	readPEM := func(name string) ([]byte, error) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(path), name)
+		}
+		return os.ReadFile(name)
+	}
+
+	keys := make([]*signingKey, 0, len(file.Keys))
+	for _, entry := range file.Keys {
+		key := &signingKey{id: entry.ID}
+
+		switch entry.Algorithm {
+		case "HS256":
+			key.method = jwt.SigningMethodHS256
+			secret, err := base64.StdEncoding.DecodeString(entry.Secret)
+			if err != nil || len(secret) < minHMACSecretBytes {
+				return nil, fmt.Errorf("key %q: the secret must be the base64 of at least %d bytes", entry.ID, minHMACSecretBytes)
+			}
+			key.private, key.public = secret, secret
+
+		case "RS256", "EdDSA":
+			key.method = jwt.GetSigningMethod(entry.Algorithm)
+			if entry.PrivateKeyFile != "" {
+				data, err := readPEM(entry.PrivateKeyFile)
+				if err == nil {
+					key.private, key.public, err = parsePrivateKey(entry.Algorithm, data)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("key %q: invalid private key: %v", entry.ID, err)
+				}
+			} else {
+				data, err := readPEM(entry.PublicKeyFile)
+				if err == nil {
+					key.public, err = parsePublicKey(entry.Algorithm, data)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("key %q: invalid public key: %v", entry.ID, err)
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("key %q: unsupported algorithm %q, use HS256, RS256 or EdDSA", entry.ID, entry.Algorithm)
+		}
+		keys = append(keys, key)
+	}
+
+	return newKeySet(file.SigningKey, keys)
+}
+
+// Helper function to parse a PEM private key of the algorithm, returning it together with its public key
+func parsePrivateKey(algorithm string, data []byte) (interface{}, interface{}, error) {
+	if algorithm == "RS256" {
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return private, &private.PublicKey, nil
+	}
+
+	private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	edPrivate, ok := private.(ed25519.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("not an Ed25519 key")
+	}
+	return edPrivate, edPrivate.Public(), nil
+}
+
+// Helper function to parse a PEM public key of the algorithm
+func parsePublicKey(algorithm string, data []byte) (interface{}, error) {
+	if algorithm == "RS256" {
+		return jwt.ParseRSAPublicKeyFromPEM(data)
+	}
+	public, err := jwt.ParseEdPublicKeyFromPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	edPublic, ok := public.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 key")
+	}
+	return edPublic, nil
+}
+
+// generateJWT generates an access token for the username with the signing key. The token expires after
+// accessTokenLifetime and has a random ID (the "jti" claim), by which logout revokes it.
+func (keys *KeySet) generateJWT(username string, role string) (string, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	// Create the JWT claims, which include the username, role, expiration time and ID
+	claims := &claims{
+		Username: username,
+		Role:     role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenLifetime)),
+			ID:        id,
+		},
+	}
+
+	token := jwt.NewWithClaims(keys.signing.method, claims)
+	token.Header["kid"] = keys.signing.id
+	tokenString, err := token.SignedString(keys.signing.private)
+	if err != nil {
+		return "", fmt.Errorf("could not sign token: %w", err)
+	}
+	return tokenString, nil
+}
+
+// verifyJWT validates a token signed by any key of the set. The key is chosen by the "kid" header, and the
+// algorithm of the token must be the algorithm of the key, so e.g. an RSA public key is never used as an HMAC secret.
+func (keys *KeySet) verifyJWT(tokenString string) (*claims, error) {
+	claims := &claims{}
+
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+		key, found := keys.keys[id]
+		if !found {
+			return nil, fmt.Errorf("unknown key %q", id)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("key %q does not use %s", id, token.Method.Alg())
+		}
+		return key.public, nil
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("could not parse token: %w", err)
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// jsonWebKey is a public key in the JWK format (RFC 7517)
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`   // Modulus of an RSA key
+	E         string `json:"e,omitempty"`   // Exponent of an RSA key
+	Curve     string `json:"crv,omitempty"` // "Ed25519" for EdDSA keys
+	X         string `json:"x,omitempty"`   // Public key of an EdDSA key
+}
+
+// jwks returns the public keys of the asymmetric keys of the set. HS256 secrets are never published.
+func (keys *KeySet) jwks() []jsonWebKey {
+	webKeys := []jsonWebKey{}
+	for _, key := range keys.keys {
+		webKey := jsonWebKey{ID: key.id, Algorithm: key.method.Alg(), Use: "sig"}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			webKey.KeyType = "RSA"
+			webKey.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			webKey.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			webKey.KeyType = "OKP"
+			webKey.Curve = "Ed25519"
+			webKey.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		webKeys = append(webKeys, webKey)
+	}
+
+	sort.Slice(webKeys, func(i, j int) bool { return webKeys[i].ID < webKeys[j].ID })
+	return webKeys
+}
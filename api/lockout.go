@@ -0,0 +1,155 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Failed logins before an account or client IP is locked. A client IP gets more attempts, as several users may
+// share it behind a NAT or proxy.
+const (
+	accountLockoutThreshold = 5
+	ipLockoutThreshold      = 20
+)
+
+// Each failed login from the threshold on doubles the lockout, starting at lockoutBaseDelay, up to lockoutMaxDelay.
+// Failures are forgotten once there was none for lockoutMaxDelay.
+const (
+	lockoutBaseDelay = 30 * time.Second
+	lockoutMaxDelay  = time.Hour
+)
+
+// failedLogins is the counter of an account or client IP
+type failedLogins struct {
+	count       int
+	last        time.Time // Time of the last failure
+	lockedUntil time.Time
+}
+
+// loginThrottle counts failed logins per account and per client IP, and locks them out with exponential delays
+// so passwords cannot be guessed quickly. The counters are kept in memory, so each server instance counts its own.
+// Accounts are counted by the username of the request, so unknown users are locked out like existing ones and the
+// lockout does not tell which usernames exist.
+type loginThrottle struct {
+	mutex    sync.Mutex
+	counters map[string]*failedLogins // By "account:<username>" and "ip:<address>"
+	swept    time.Time                // Time the forgotten counters were last deleted
+	now      func() time.Time         // Replaced in tests
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{counters: make(map[string]*failedLogins), now: time.Now}
+}
+
+// Helper function to get the IP address of the client of a request. X-Forwarded-For is not used, as any client
+// can set it to get a new counter for every attempt.
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// attempt reserves a login attempt of the account from the client IP. It returns how long the account or the client
+// IP is still locked, or else counts the attempt as failed before the password is checked, in the same step, so
+// attempts sent in parallel cannot all pass before the first failure is counted. The login must then call
+// succeeded, or released if the password could not be checked.
+func (throttle *loginThrottle) attempt(username string, ip string) time.Duration {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	now := throttle.now()
+	var wait time.Duration
+	for _, key := range []string{"account:" + username, "ip:" + ip} {
+		if counter := throttle.counters[key]; counter != nil && counter.lockedUntil.Sub(now) > wait {
+			wait = counter.lockedUntil.Sub(now)
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	throttle.sweep(now)
+	throttle.count("account:"+username, accountLockoutThreshold, now)
+	throttle.count("ip:"+ip, ipLockoutThreshold, now)
+	return 0
+}
+
+// succeeded resets the counter of the account and takes back the attempt of the client IP. The earlier failures
+// of the client IP are kept, so logging in to an own account between guesses does not reset them.
+func (throttle *loginThrottle) succeeded(username string, ip string) {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	delete(throttle.counters, "account:"+username)
+	throttle.uncount("ip:"+ip, ipLockoutThreshold)
+}
+
+// released takes back an attempt whose password could not be checked, e.g. because the storage failed, so
+// errors of the server do not lock anyone out
+func (throttle *loginThrottle) released(username string, ip string) {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	throttle.uncount("account:"+username, accountLockoutThreshold)
+	throttle.uncount("ip:"+ip, ipLockoutThreshold)
+}
+
+// Helper function to count a failure of the key and lock it from the threshold on. Must hold the mutex.
+func (throttle *loginThrottle) count(key string, threshold int, now time.Time) {
+	counter := throttle.counters[key]
+	if counter == nil || now.Sub(counter.last) > lockoutMaxDelay {
+		counter = &failedLogins{}
+		throttle.counters[key] = counter
+	}
+	counter.count++
+	counter.last = now
+	counter.lock(threshold)
+}
+
+// Helper function to take back a failure of the key counted by attempt. Must hold the mutex.
+func (throttle *loginThrottle) uncount(key string, threshold int) {
+	counter := throttle.counters[key]
+	if counter == nil {
+		return
+	}
+	counter.count--
+	if counter.count <= 0 {
+		delete(throttle.counters, key)
+		return
+	}
+	counter.lock(threshold)
+}
+
+// Helper function to set the lockout of the counter from the time of its last failure. Counters below the
+// threshold are not locked, and every failure from the threshold on doubles the lockout.
+func (counter *failedLogins) lock(threshold int) {
+	if counter.count < threshold {
+		counter.lockedUntil = time.Time{}
+		return
+	}
+
+	delay := lockoutBaseDelay
+	for failures := threshold; failures < counter.count && delay < lockoutMaxDelay; failures++ {
+		delay *= 2
+	}
+	counter.lockedUntil = counter.last.Add(min(delay, lockoutMaxDelay))
+}
+
+// Helper function to delete the counters without a failure for lockoutMaxDelay, at most once per lockoutMaxDelay,
+// so the counters of every client ever seen are not kept forever. Must hold the mutex.
+func (throttle *loginThrottle) sweep(now time.Time) {
+	if now.Sub(throttle.swept) < lockoutMaxDelay {
+		return
+	}
+	throttle.swept = now
+
+	for key, counter := range throttle.counters {
+		if now.Sub(counter.last) > lockoutMaxDelay && now.After(counter.lockedUntil) {
+			delete(throttle.counters, key)
+		}
+	}
+}
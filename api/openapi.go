@@ -0,0 +1,374 @@
+package api
+
+import (
+	"net/http"
+	"overengineered_calculator/storage"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openAPIDocument is an OpenAPI 3 document. Only the parts used to describe this API are modelled.
+type openAPIDocument struct {
+	OpenAPI    string                            `json:"openapi"`
+	Info       openAPIInfo                       `json:"info"`
+	Servers    []openAPIServer                   `json:"servers"`
+	Paths      map[string]map[string]openAPIPath `json:"paths"` // Keyed by path and lower case method
+	Components openAPIComponents                 `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// openAPIServer is the base URL of the paths, here the prefix of the version
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+// openAPIPath is an operation in the OpenAPI sense, i.e. a method of a path
+type openAPIPath struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+	Servers     []openAPIServer            `json:"servers,omitempty"` // Set for root routes, which have no prefix
+}
+
+type openAPIParameter struct {
+	Name        string     `json:"name"`
+	In          string     `json:"in"`
+	Description string     `json:"description"`
+	Required    bool       `json:"required,omitempty"`
+	Schema      jsonSchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Ref         string                      `json:"$ref,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema jsonSchema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]jsonSchema      `json:"schemas"`
+	Responses       map[string]openAPIResponse `json:"responses"`
+	SecuritySchemes map[string]jsonSchema      `json:"securitySchemes"`
+}
+
+// jsonSchema is a JSON schema as used by OpenAPI 3.0
+type jsonSchema map[string]interface{}
+
+// Schemas used by many parameters
+var (
+	stringSchema         = jsonSchema{"type": "string"}
+	numberSchema         = jsonSchema{"type": "number"}
+	integerSchema        = jsonSchema{"type": "integer"}
+	dateTimeSchema       = jsonSchema{"type": "string", "format": "date-time"}
+	numberOrStringSchema = jsonSchema{"oneOf": []jsonSchema{numberSchema, stringSchema}}
+)
+
+// Helper function to create the schema of a string with the given values
+func enumSchema(values ...string) jsonSchema {
+	return jsonSchema{"type": "string", "enum": values}
+}
+
+// Helper function to create the schema of an array of items
+func arraySchema(items jsonSchema) jsonSchema {
+	return jsonSchema{"type": "array", "items": items}
+}
+
+// Helper function to create the schema of an object with the given properties
+func objectSchema(properties map[string]jsonSchema, required ...string) jsonSchema {
+	schema := jsonSchema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// Helper function to refer to a schema of the components, e.g. schemaRef("Problem")
+func schemaRef(name string) jsonSchema {
+	return jsonSchema{"$ref": "#/components/schemas/" + name}
+}
+
+// Helper function to describe an optional query parameter
+func queryParam(name string, description string, schema jsonSchema) openAPIParameter {
+	return openAPIParameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// Helper function to describe a parameter in the path, e.g. {username}
+func pathParam(name string, description string) openAPIParameter {
+	return openAPIParameter{Name: name, In: "path", Description: description, Required: true, Schema: stringSchema}
+}
+
+// Helper function to make a parameter required
+func requiredParam(param openAPIParameter) openAPIParameter {
+	param.Required = true
+	return param
+}
+
+// Helper function to copy parameters without requiring them
+func optionalParams(params []openAPIParameter) []openAPIParameter {
+	optional := make([]openAPIParameter, 0, len(params))
+	for _, param := range params {
+		param.Required = param.In == "path"
+		optional = append(optional, param)
+	}
+	return optional
+}
+
+// Helper function to join lists of parameters into a new list
+func concatParams(lists ...[]openAPIParameter) []openAPIParameter {
+	var params []openAPIParameter
+	for _, list := range lists {
+		params = append(params, list...)
+	}
+	return params
+}
+
+// Helper function to describe a JSON request body
+func jsonBody(schema jsonSchema) *openAPIRequestBody {
+	return &openAPIRequestBody{
+		Required: true,
+		Content:  map[string]openAPIMediaType{"application/json": {Schema: schema}},
+	}
+}
+
+// paramsBody describes the JSON body a calculation route accepts on POST instead of the query parameters
+func paramsBody(params []openAPIParameter) *openAPIRequestBody {
+	properties := make(map[string]jsonSchema, len(params))
+	var required []string
+	for _, param := range params {
+		properties[param.Name] = param.Schema
+		if param.Required {
+			required = append(required, param.Name)
+		}
+	}
+
+	body := jsonBody(objectSchema(properties, required...))
+	body.Required = false // A POST without a body uses the query string
+	return body
+}
+
+// Helper function to describe a request body that is a file in one of the given media types
+func fileBody(contentTypes ...string) *openAPIRequestBody {
+	body := &openAPIRequestBody{Required: true, Content: make(map[string]openAPIMediaType)}
+	for _, contentType := range contentTypes {
+		body.Content[contentType] = openAPIMediaType{Schema: jsonSchema{"type": "string", "format": "binary"}}
+	}
+	return body
+}
+
+// Helper function to describe a JSON response
+func jsonResponse(description string, schema jsonSchema) openAPIResponse {
+	return openAPIResponse{
+		Description: description,
+		Content:     map[string]openAPIMediaType{"application/json": {Schema: schema}},
+	}
+}
+
+// Helper function to describe a response that is a file in one of the given media types
+func fileResponse(description string, contentTypes ...string) openAPIResponse {
+	return openAPIResponse{Description: description, Content: fileBody(contentTypes...).Content}
+}
+
+// Helper function to list the media types of the export formats
+func exportContentTypes() []string {
+	contentTypes := make([]string, 0, len(exportFormats))
+	for _, format := range exportFormats {
+		contentTypes = append(contentTypes, format.ContentType)
+	}
+	return contentTypes
+}
+
+// openAPIDocumentOf describes every route of the route table of a version, see versionRoutes
+func openAPIDocumentOf(version Version, routes []route) openAPIDocument {
+	document := openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title: "Over-engineered calculator API",
+			Description: "Calculations in float64, decimal, rational and complex precision with a history per user. " +
+				"Errors are returned as RFC 7807 problem details with a stable code.",
+			Version: version.Name,
+		},
+		Servers:    []openAPIServer{{URL: version.Prefix()}},
+		Paths:      make(map[string]map[string]openAPIPath),
+		Components: openAPIComponentsOfAPI(),
+	}
+
+	for _, route := range routes {
+		status := route.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		// Routes of the same path with different methods are described together
+		methods := document.Paths[route.path]
+		if methods == nil {
+			methods = make(map[string]openAPIPath, len(route.methods))
+		}
+		for _, method := range route.methods {
+			path := openAPIPath{
+				OperationID: operationID(method, route.path),
+				Summary:     route.summary,
+				Parameters:  route.params,
+				Responses: map[string]openAPIResponse{
+					strconv.Itoa(status): route.response,
+					"default":            {Ref: "#/components/responses/Problem"},
+				},
+			}
+			if method == http.MethodPost && route.body != nil {
+				path.RequestBody = route.body
+				path.Parameters = optionalParams(route.params) // The body may give the parameters instead
+			}
+			var description []string
+			if route.auth {
+				path.Security = []map[string][]string{{"bearerAuth": {}}}
+			}
+			if route.auth && route.scope != "" {
+				path.Security = append(path.Security, map[string][]string{"apiKeyAuth": {}})
+				description = append(description, "API keys need the scope "+route.scope+".")
+			}
+			if len(route.roles) > 0 {
+				description = append(description, "Requires the role "+strings.Join(route.roles, " or ")+".")
+			}
+			path.Description = strings.Join(description, " ")
+			if route.root {
+				path.Servers = []openAPIServer{{URL: "/"}}
+			}
+			methods[strings.ToLower(method)] = path
+		}
+		document.Paths[route.path] = methods
+	}
+	return document
+}
+
+// Helper function to derive the operationId of a method of a path, e.g. "postHistoryImport" for POST /history/import
+func operationID(method string, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return strings.ContainsRune("/.-{}", r) }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// Helper function to create the schemas, shared responses and security schemes of the OpenAPI document
+func openAPIComponentsOfAPI() openAPIComponents {
+	historyEntry := map[string]jsonSchema{
+		"ID": stringSchema, "Operand1": numberSchema, "Operand2": numberSchema, "Operation": stringSchema,
+		"Result": numberSchema, "Timestamp": dateTimeSchema, "Owner": stringSchema, "Expression": stringSchema,
+		"AngleMode": stringSchema, "Mode": stringSchema, "ExactOperand1": stringSchema,
+		"ExactOperand2": stringSchema, "ExactResult": stringSchema, "Symbol": stringSchema, "Formatted": stringSchema,
+	}
+
+	apiKeyProperties := map[string]jsonSchema{
+		"id": stringSchema, "name": stringSchema, "scopes": arraySchema(enumSchema(apiKeyScopes...)),
+		"createdAt": dateTimeSchema, "lastUsedAt": dateTimeSchema,
+	}
+	newAPIKeyProperties := map[string]jsonSchema{"key": jsonSchema{"type": "string", "description": "Sent in the X-API-Key header"}}
+	for name, schema := range apiKeyProperties {
+		newAPIKeyProperties[name] = schema
+	}
+
+	codes := make([]string, 0, len(errorCodes))
+	for _, errorCode := range errorCodes {
+		codes = append(codes, errorCode.code)
+	}
+	sort.Strings(codes)
+
+	return openAPIComponents{
+		Schemas: map[string]jsonSchema{
+			"Problem": objectSchema(map[string]jsonSchema{
+				"type":   stringSchema,
+				"title":  stringSchema,
+				"status": integerSchema,
+				"detail": stringSchema,
+				"code": jsonSchema{"type": "string", "description": "Stable code of the error, e.g. " +
+					strings.Join(codes, ", ") + ". See the README for every code."},
+				"column":   jsonSchema{"type": "integer", "description": "Position of a parse_error in the expression"},
+				"imported": jsonSchema{"type": "integer", "description": "Rows of /history/import saved before the error"},
+			}, "type", "title", "status", "code"),
+			"Result": objectSchema(map[string]jsonSchema{
+				"result":  numberOrStringSchema,
+				"decimal": jsonSchema{"type": "string", "description": "Decimal approximation of a rational result"},
+			}, "result"),
+			"Tokens": objectSchema(map[string]jsonSchema{
+				"token":        jsonSchema{"type": "string", "description": "Access token, prefixed with \"Bearer \""},
+				"refreshToken": stringSchema,
+				"expiresIn":    jsonSchema{"type": "integer", "description": "Lifetime of the access token in seconds"},
+			}, "token", "refreshToken", "expiresIn"),
+			"RefreshRequest": objectSchema(map[string]jsonSchema{
+				"refreshToken": stringSchema,
+			}, "refreshToken"),
+			"User": objectSchema(map[string]jsonSchema{
+				"username": stringSchema,
+				"role":     enumSchema(storage.Roles...),
+			}, "username", "role"),
+			"APIKeyRequest": objectSchema(map[string]jsonSchema{
+				"name":   stringSchema,
+				"scopes": arraySchema(enumSchema(apiKeyScopes...)),
+			}, "name", "scopes"),
+			"APIKey":    objectSchema(apiKeyProperties, "id", "name", "scopes", "createdAt"),
+			"NewAPIKey": objectSchema(newAPIKeyProperties, "id", "name", "scopes", "createdAt", "key"),
+			"Credentials": objectSchema(map[string]jsonSchema{
+				"username": stringSchema,
+				"password": stringSchema,
+			}, "username", "password"),
+			"Operation": objectSchema(map[string]jsonSchema{
+				"name": stringSchema, "route": stringSchema, "symbol": stringSchema, "arity": integerSchema,
+				"description": stringSchema, "canFail": {"type": "boolean"}, "usesAngle": {"type": "boolean"},
+				"precisions": arraySchema(stringSchema),
+			}),
+			"HistoryEntry": objectSchema(historyEntry),
+			"HistoryPage": objectSchema(map[string]jsonSchema{
+				"entries":       arraySchema(schemaRef("HistoryEntry")),
+				"nextPageToken": stringSchema,
+			}, "entries"),
+			"BatchItem": objectSchema(map[string]jsonSchema{
+				"operation": stringSchema, "operand1": numberOrStringSchema, "operand2": numberOrStringSchema,
+				"expression": stringSchema, "precision": enumSchema(precisionFloat, precisionDecimal, precisionRational, precisionComplex),
+				"digits": integerSchema, "angle": enumSchema("radians", "degrees"),
+			}),
+			"BatchResult": objectSchema(map[string]jsonSchema{
+				"result": numberOrStringSchema, "decimal": stringSchema, "error": stringSchema, "code": stringSchema,
+			}),
+			"ImportResponse": objectSchema(map[string]jsonSchema{
+				"imported": integerSchema, "duplicates": integerSchema, "rejected": integerSchema, "flagged": integerSchema,
+				"problems": arraySchema(objectSchema(map[string]jsonSchema{
+					"line": integerSchema, "error": stringSchema, "code": stringSchema, "flagged": {"type": "boolean"},
+				})),
+			}),
+			"VerifyReport": objectSchema(map[string]jsonSchema{
+				"checked": integerSchema, "mismatched": integerSchema,
+				"mismatches": arraySchema(objectSchema(map[string]jsonSchema{
+					"id": stringSchema, "timestamp": dateTimeSchema, "formatted": stringSchema, "stored": stringSchema,
+					"recomputed": stringSchema, "difference": numberSchema, "error": stringSchema, "code": stringSchema,
+				})),
+			}),
+		},
+		Responses: map[string]openAPIResponse{
+			"Problem": {
+				Description: "The error as RFC 7807 problem details",
+				Content:     map[string]openAPIMediaType{"application/problem+json": {Schema: schemaRef("Problem")}},
+			},
+		},
+		SecuritySchemes: map[string]jsonSchema{
+			"bearerAuth": {"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			"apiKeyAuth": {"type": "apiKey", "in": "header", "name": apiKeyHeader},
+		},
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"overengineered_calculator/calculator"
+)
+
+// operationDescription is the JSON representation of a registered operation returned by /operations
+type operationDescription struct {
+	Name        string   `json:"name"`
+	Route       string   `json:"route"`
+	Symbol      string   `json:"symbol"`
+	Arity       int      `json:"arity"`
+	Description string   `json:"description"`
+	CanFail     bool     `json:"canFail"`
+	UsesAngle   bool     `json:"usesAngle"`
+	Precisions  []string `json:"precisions"` // Supported values of the "precision" parameter
+}
+
+// describeOperation converts a registered operation to its JSON representation.
+func describeOperation(operation calculator.Operation) operationDescription {
+	precisions := []string{precisionFloat}
+	if operation.Decimal != nil {
+		precisions = append(precisions, precisionDecimal)
+	}
+	if operation.Rational != nil {
+		precisions = append(precisions, precisionRational)
+	}
+	if operation.Complex != nil {
+		precisions = append(precisions, precisionComplex)
+	}
+
+	return operationDescription{
+		Name:        operation.Name,
+		Route:       operation.Route(),
+		Symbol:      operation.Symbol,
+		Arity:       int(operation.Arity),
+		Description: operation.Description,
+		CanFail:     operation.CanFail,
+		UsesAngle:   operation.UsesAngle,
+		Precisions:  precisions,
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcrypt only uses the first 72 bytes of a password, so longer passwords are rejected instead of silently truncated
+const maxPasswordBytes = 72
+
+// PasswordPolicy is the strength a password needs to register, see WithPasswordPolicy
+type PasswordPolicy struct {
+	MinLength     int  // Minimum number of characters
+	RequireUpper  bool // At least one upper case letter
+	RequireLower  bool // At least one lower case letter
+	RequireDigit  bool // At least one digit
+	RequireSymbol bool // At least one character that is not a letter or digit
+}
+
+// DefaultPasswordPolicy only requires a length, as length adds more strength than character classes (NIST SP 800-63B)
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8}
+
+// WithPasswordPolicy sets the strength a password needs to register. Without it, DefaultPasswordPolicy is used.
+func WithPasswordPolicy(policy PasswordPolicy) Option {
+	return func(api *API) {
+		api.passwords = policy
+	}
+}
+
+// Helper function to create the 400 response to a password that does not satisfy the policy
+func weakPassword(format string, args ...interface{}) *apiError {
+	return newAPIError(http.StatusBadRequest, "weak_password", format, args...)
+}
+
+// check returns a weak_password error describing the first rule the password of the user breaks
+func (policy PasswordPolicy) check(username string, password string) error {
+	if password == "" {
+		return weakPassword("password is required")
+	}
+	if length := utf8.RuneCountInString(password); length < policy.MinLength {
+		return weakPassword("password must be at least %d characters", policy.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return weakPassword("password must be at most %d bytes", maxPasswordBytes)
+	}
+	if strings.EqualFold(password, username) {
+		return weakPassword("password must not be the username")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+
+	rules := []struct {
+		required  bool
+		satisfied bool
+		name      string
+	}{
+		{policy.RequireUpper, upper, "an upper case letter"},
+		{policy.RequireLower, lower, "a lower case letter"},
+		{policy.RequireDigit, digit, "a digit"},
+		{policy.RequireSymbol, symbol, "a symbol"},
+	}
+	for _, rule := range rules {
+		if rule.required && !rule.satisfied {
+			return weakPassword("password must contain %s", rule.name)
+		}
+	}
+	return nil
+}
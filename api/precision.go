@@ -0,0 +1,172 @@
+package api
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"overengineered_calculator/calculator"
+	"overengineered_calculator/storage"
+	"strconv"
+)
+
+// Precision modes selectable with the "precision" query parameter
+const (
+	precisionFloat    = "float" // Default float64 arithmetic
+	precisionDecimal  = "decimal"
+	precisionRational = "rational"
+	precisionComplex  = "complex"
+)
+
+// Helper function to read the precision mode from the request. Defaults to float64 arithmetic,
+// unless an operand has an imaginary part (e.g. "3+4i"), in which case complex mode is used.
+func parsePrecision(request *http.Request) (string, error) {
+	query := request.URL.Query()
+
+	precision := query.Get("precision")
+	switch precision {
+	case "":
+		if calculator.IsComplexOperand(query.Get("operand1")) || calculator.IsComplexOperand(query.Get("operand2")) {
+			return precisionComplex, nil
+		}
+		return precisionFloat, nil
+	case precisionFloat, precisionDecimal, precisionRational, precisionComplex:
+		return precision, nil
+	}
+	return "", errInvalidPrecision
+}
+
+// Helper function to create a DecimalCalculator from the optional "digits" query parameter
+func parseDecimalCalculator(request *http.Request) (*calculator.DecimalCalculator, error) {
+	digits := uint64(calculator.DefaultDecimalDigits)
+
+	if value := request.URL.Query().Get("digits"); value != "" {
+		var err error
+		digits, err = strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, calculator.ErrInvalidDigits
+		}
+	}
+
+	return calculator.NewDecimalCalculator(uint(digits))
+}
+
+// Helper function to parse operands from the request as arbitrary precision decimals
+func parseDecimalOperands(request *http.Request, calc *calculator.DecimalCalculator) (*big.Float, *big.Float, error) {
+	operand1, err1 := calc.Parse(request.URL.Query().Get("operand1"))
+	operand2, err2 := calc.Parse(request.URL.Query().Get("operand2"))
+	if err1 != nil || err2 != nil {
+		return nil, nil, errInvalidOperands
+	}
+
+	return operand1, operand2, nil
+}
+
+// Dispatches an operation to the handler of the given exact precision mode
+func (api *API) exactOperationHandler(writer http.ResponseWriter, request *http.Request, operation calculator.Operation, precision string) {
+	switch precision {
+	case precisionDecimal:
+		api.decimalOperationHandler(writer, request, operation)
+	case precisionRational:
+		api.rationalOperationHandler(writer, request, operation)
+	case precisionComplex:
+		api.complexOperationHandler(writer, request, operation)
+	}
+}
+
+// Generic handler for operations in decimal precision mode. The result is returned as an exact string.
+func (api *API) decimalOperationHandler(writer http.ResponseWriter, request *http.Request, operation calculator.Operation) {
+	if operation.Decimal == nil {
+		writeError(writer, unsupportedPrecision("decimal precision"), http.StatusBadRequest)
+		return
+	}
+
+	decimalCalculator, err := parseDecimalCalculator(request)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+
+	operand1, operand2, err := parseDecimalOperands(request, decimalCalculator)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+
+	result, err := operation.Decimal(decimalCalculator, []*big.Float{operand1, operand2})
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+
+	// Store the float64 approximations next to the lossless strings, so existing clients can still read the entry
+	approximation1, _ := operand1.Float64()
+	approximation2, _ := operand2.Float64()
+	approximation, _ := result.Float64()
+	api.saveEntryToHistory(request, storage.HistoryEntry{
+		Operation:     operation.Name,
+		Operand1:      approximation1,
+		Operand2:      approximation2,
+		Result:        approximation,
+		Mode:          precisionDecimal,
+		ExactOperand1: decimalCalculator.Format(operand1),
+		ExactOperand2: decimalCalculator.Format(operand2),
+		ExactResult:   decimalCalculator.Format(result),
+	})
+
+	writeResultJSON(writer, decimalCalculator.Format(result))
+}
+
+// Helper function to parse operands from the request as exact fractions, e.g. "3/4"
+func parseRationalOperands(request *http.Request, calc *calculator.RationalCalculator) (*big.Rat, *big.Rat, error) {
+	operand1, err1 := calc.Parse(request.URL.Query().Get("operand1"))
+	operand2, err2 := calc.Parse(request.URL.Query().Get("operand2"))
+	if errors.Is(err1, calculator.ErrOutOfRange) || errors.Is(err2, calculator.ErrOutOfRange) {
+		return nil, nil, calculator.ErrOutOfRange
+	}
+	if err1 != nil || err2 != nil {
+		return nil, nil, errInvalidOperands
+	}
+
+	return operand1, operand2, nil
+}
+
+// Generic handler for operations in rational precision mode.
+// The result is returned as a reduced fraction together with its decimal approximation.
+func (api *API) rationalOperationHandler(writer http.ResponseWriter, request *http.Request, operation calculator.Operation) {
+	if operation.Rational == nil {
+		writeError(writer, unsupportedPrecision("rational precision"), http.StatusBadRequest)
+		return
+	}
+
+	rationalCalculator := calculator.NewRationalCalculator()
+	operand1, operand2, err := parseRationalOperands(request, rationalCalculator)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+
+	result, err := operation.Rational(rationalCalculator, []*big.Rat{operand1, operand2})
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+
+	approximation1, _ := operand1.Float64()
+	approximation2, _ := operand2.Float64()
+	approximation, _ := result.Float64()
+	api.saveEntryToHistory(request, storage.HistoryEntry{
+		Operation:     operation.Name,
+		Operand1:      approximation1,
+		Operand2:      approximation2,
+		Result:        approximation,
+		Mode:          precisionRational,
+		ExactOperand1: rationalCalculator.Format(operand1),
+		ExactOperand2: rationalCalculator.Format(operand2),
+		ExactResult:   rationalCalculator.Format(result),
+	})
+
+	writeJSON(writer, map[string]string{
+		"result":  rationalCalculator.Format(result),
+		"decimal": rationalCalculator.Approximate(result),
+	})
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"errors"
+	"math/big"
+	"overengineered_calculator/calculator"
+	"overengineered_calculator/storage"
+	"strings"
+	"time"
+)
+
+// Errors of rows that cannot be recomputed
+var (
+	errInvalidTimestamp = invalidParameter("invalid timestamp")
+	errInvalidMode      = invalidParameter("invalid mode")
+)
+
+// recomputeRow converts a row with the export columns to a history entry by computing it again with the
+// calculator in the mode it was stored with. The entry holds the recomputed values, and the recomputed result
+// is also returned formatted like the result column, so it can be compared with the stored one.
+func (api *API) recomputeRow(row map[string]string) (storage.HistoryEntry, string, error) {
+	timestamp, err := time.Parse(time.RFC3339, row["timestamp"])
+	if err != nil {
+		return storage.HistoryEntry{}, "", errInvalidTimestamp
+	}
+
+	entry := storage.HistoryEntry{
+		Operation:  row["operation"],
+		Timestamp:  timestamp,
+		Expression: row["expression"],
+		Mode:       row["mode"],
+		AngleMode:  row["angleMode"],
+	}
+	stored := row["result"]
+
+	var result string
+	if entry.Operation == "Evaluate" || entry.Expression != "" {
+		entry.Operation = "Evaluate"
+		result, err = api.recomputeExpression(&entry)
+	} else {
+		operation, found := api.calculator.Registry().Lookup(entry.Operation)
+		if !found {
+			return storage.HistoryEntry{}, "", errUnknownOperation
+		}
+		entry.Operation = operation.Name
+
+		operands := []string{row["operand1"], row["operand2"]}[:operation.Arity]
+		switch entry.Mode {
+		case "":
+			result, err = computeFloat(&entry, operation, operands)
+		case precisionDecimal:
+			result, err = recomputeDecimal(&entry, operation, operands, stored)
+		case precisionRational:
+			result, err = computeRational(&entry, operation, operands)
+		case precisionComplex:
+			result, err = computeComplex(&entry, operation, operands)
+		default:
+			err = errInvalidMode
+		}
+	}
+	if err != nil {
+		return storage.HistoryEntry{}, "", err
+	}
+	return entry, result, nil
+}
+
+// historyRow returns the export columns of an entry keyed by their name, the inverse of recomputeRow
+func (api *API) historyRow(entry storage.HistoryEntry) map[string]string {
+	row := make(map[string]string, len(exportColumns))
+	for i, cell := range api.exportRow(entry) {
+		row[exportColumns[i]] = cell.Value
+	}
+	return row
+}
+
+// Helper function to evaluate the expression of an entry again, returning the formatted result
+func (api *API) recomputeExpression(entry *storage.HistoryEntry) (string, error) {
+	result, err := api.calculator.Evaluate(entry.Expression)
+	if err != nil {
+		return "", err
+	}
+	entry.Result = result
+	return formatHistoryNumber(result, "", ""), nil
+}
+
+// Helper function to compute an operation in the default float64 mode, returning the formatted result
+func computeFloat(entry *storage.HistoryEntry, operation calculator.Operation, operands []string) (string, error) {
+	values := make([]float64, len(operands))
+	for i, operand := range operands {
+		var err error
+		values[i], err = parseOperand(operand)
+		if err != nil {
+			return "", calculator.ErrInvalidOperand
+		}
+	}
+
+	var mode calculator.AngleMode
+	if operation.UsesAngle {
+		var err error
+		mode, err = calculator.ParseAngleMode(entry.AngleMode)
+		if err != nil {
+			return "", err
+		}
+	}
+	entry.AngleMode = string(mode)
+
+	result, err := operation.Function(values, mode)
+	if err != nil {
+		return "", err
+	}
+
+	entry.Operand1 = values[0]
+	if len(values) > 1 {
+		entry.Operand2 = values[1]
+	}
+	entry.Result = result
+	return formatHistoryNumber(result, "", ""), nil
+}
+
+// Helper function to compute an operation in decimal mode with the calculator, returning the result rounded
+// to the given number of significant digits
+func computeDecimal(entry *storage.HistoryEntry, operation calculator.Operation, operands []string, decimalCalculator *calculator.DecimalCalculator, digits uint) (string, error) {
+	if operation.Decimal == nil {
+		return "", unsupportedPrecision("decimal precision")
+	}
+
+	values := make([]*big.Float, len(operands))
+	for i, operand := range operands {
+		var err error
+		values[i], err = decimalCalculator.Parse(operand)
+		if err != nil {
+			return "", calculator.ErrInvalidOperand
+		}
+	}
+
+	result, err := operation.Decimal(decimalCalculator, values)
+	if err != nil {
+		return "", err
+	}
+
+	entry.Operand1, _ = values[0].Float64()
+	entry.ExactOperand1 = decimalCalculator.Format(values[0])
+	if len(values) > 1 {
+		entry.Operand2, _ = values[1].Float64()
+		entry.ExactOperand2 = decimalCalculator.Format(values[1])
+	}
+	entry.Result, _ = result.Float64()
+	entry.ExactResult = result.Text('g', int(digits))
+	return entry.ExactResult, nil
+}
+
+// Helper function to recompute an entry in decimal mode. The number of digits the entry was computed with is
+// not stored, but rounding the exact result to the significant digits of the stored result gives the stored
+// result if it was correct, so that many digits are compared.
+func recomputeDecimal(entry *storage.HistoryEntry, operation calculator.Operation, operands []string, stored string) (string, error) {
+
+	// Compute with at least as many digits as the longest number, so the operands are parsed without loss
+	digits := uint(calculator.DefaultDecimalDigits)
+	for _, number := range append([]string{stored}, operands...) {
+		digits = max(digits, significantDigits(number))
+	}
+	decimalCalculator, err := calculator.NewDecimalCalculator(min(digits, calculator.MaxDecimalDigits))
+	if err != nil {
+		return "", err
+	}
+	return computeDecimal(entry, operation, operands, decimalCalculator, significantDigits(stored))
+}
+
+// Helper function to compute an operation in rational mode, returning the reduced fraction
+func computeRational(entry *storage.HistoryEntry, operation calculator.Operation, operands []string) (string, error) {
+	if operation.Rational == nil {
+		return "", unsupportedPrecision("rational precision")
+	}
+
+	rationalCalculator := calculator.NewRationalCalculator()
+	values := make([]*big.Rat, len(operands))
+	for i, operand := range operands {
+		var err error
+		values[i], err = rationalCalculator.Parse(operand)
+		if errors.Is(err, calculator.ErrOutOfRange) {
+			return "", err
+		}
+		if err != nil {
+			return "", calculator.ErrInvalidOperand
+		}
+	}
+
+	result, err := operation.Rational(rationalCalculator, values)
+	if err != nil {
+		return "", err
+	}
+
+	entry.Operand1, _ = values[0].Float64()
+	entry.ExactOperand1 = rationalCalculator.Format(values[0])
+	if len(values) > 1 {
+		entry.Operand2, _ = values[1].Float64()
+		entry.ExactOperand2 = rationalCalculator.Format(values[1])
+	}
+	entry.Result, _ = result.Float64()
+	entry.ExactResult = rationalCalculator.Format(result)
+	return entry.ExactResult, nil
+}
+
+// Helper function to compute an operation in complex mode, returning the formatted complex result
+func computeComplex(entry *storage.HistoryEntry, operation calculator.Operation, operands []string) (string, error) {
+	if operation.Complex == nil {
+		return "", unsupportedPrecision("complex numbers")
+	}
+
+	complexCalculator := calculator.NewComplexCalculator()
+	values := make([]complex128, len(operands))
+	for i, operand := range operands {
+		var err error
+		values[i], err = complexCalculator.Parse(operand)
+		if err != nil {
+			return "", calculator.ErrInvalidOperand
+		}
+	}
+
+	result, err := operation.Complex(complexCalculator, values)
+	if err != nil {
+		return "", err
+	}
+
+	entry.Operand1 = real(values[0])
+	entry.ExactOperand1 = complexCalculator.Format(values[0])
+	if len(values) > 1 {
+		entry.Operand2 = real(values[1])
+		entry.ExactOperand2 = complexCalculator.Format(values[1])
+	}
+	entry.Result = real(result)
+	entry.ExactResult = complexCalculator.Format(result)
+	return entry.ExactResult, nil
+}
+
+// Helper function to count the significant digits of a decimal number such as "-0.0125" or "1.5e+300".
+// Leading zeros are not significant, and a number without significant digits counts as one digit.
+func significantDigits(number string) uint {
+	mantissa, _, _ := strings.Cut(strings.ToLower(number), "e")
+	mantissa = strings.TrimLeft(mantissa, "+-0.")
+
+	digits := uint(0)
+	for _, char := range mantissa {
+		if char >= '0' && char <= '9' {
+			digits++
+		}
+	}
+	return max(digits, 1)
+}
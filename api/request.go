@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Largest JSON body accepted by the calculation routes, /login and /register
+const maxJSONBodyBytes = 64 << 10
+
+// Parameters a calculation route accepts in a JSON body, e.g. {"operand1": 3, "operand2": "4"}
+var calculationParams = map[string]bool{
+	"operand1": true, "operand2": true, "operand": true,
+	"precision": true, "digits": true, "angle": true, "expression": true,
+}
+
+// Middleware that only lets the given methods through, and answers other methods with 405 and an Allow header.
+// HEAD is allowed together with GET.
+func allowMethods(nextHandler http.HandlerFunc, methods ...string) http.HandlerFunc {
+	for _, method := range methods {
+		if method == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+			break
+		}
+	}
+	allow := strings.Join(methods, ", ")
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		for _, method := range methods {
+			if request.Method == method {
+				nextHandler.ServeHTTP(writer, request)
+				return
+			}
+		}
+
+		writer.Header().Set("Allow", allow)
+		writeError(writer, errMethodNotAllowed, http.StatusMethodNotAllowed)
+	}
+}
+
+// Middleware that requires a JSON body of at most maxBytes, answering other content types with 415
+func requireJSON(nextHandler http.HandlerFunc, maxBytes int64) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if !isJSONRequest(request) {
+			writeError(writer, errNotJSON, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		request.Body = http.MaxBytesReader(writer, request.Body, maxBytes)
+		nextHandler.ServeHTTP(writer, request)
+	}
+}
+
+// Middleware letting calculation routes take their parameters from a JSON body on POST, as an alternative
+// to the query string of GET. The fields of the body are added to the query, so the handlers read
+// parameters the same way for both methods. A POST without a body only uses the query string.
+func jsonParams(nextHandler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost || request.ContentLength == 0 {
+			nextHandler.ServeHTTP(writer, request)
+			return
+		}
+		if !isJSONRequest(request) {
+			writeError(writer, errNotJSON, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		params, err := decodeJSONParams(http.MaxBytesReader(writer, request.Body, maxJSONBodyBytes))
+		if err != nil {
+			writeError(writer, err, http.StatusBadRequest)
+			return
+		}
+
+		// Parameters in the body take precedence over the same parameters in the query string
+		query := request.URL.Query()
+		for name, value := range params {
+			query.Set(name, value)
+		}
+
+		request = request.Clone(request.Context())
+		request.URL.RawQuery = query.Encode()
+		nextHandler.ServeHTTP(writer, request)
+	}
+}
+
+// Helper function to decode the JSON object of a calculation body. Values are numbers or strings, and numbers
+// are kept as written, so e.g. 0.1 is not rounded to a float64 before a decimal calculation.
+func decodeJSONParams(body io.Reader) (map[string]string, error) {
+	var fields map[string]json.RawMessage
+	err := json.NewDecoder(body).Decode(&fields)
+	if err != nil {
+		return nil, invalidBody(err, "body must be a JSON object")
+	}
+
+	params := make(map[string]string, len(fields))
+	for name, raw := range fields {
+		if !calculationParams[name] {
+			return nil, newAPIError(http.StatusBadRequest, "invalid_body", "unknown field %q", name)
+		}
+
+		var text string
+		if json.Unmarshal(raw, &text) == nil {
+			params[name] = text
+			continue
+		}
+
+		var number json.Number
+		if json.Unmarshal(raw, &number) != nil {
+			return nil, newAPIError(http.StatusBadRequest, "invalid_body", "%s must be a number or a string", name)
+		}
+		params[name] = number.String()
+	}
+	return params, nil
+}
+
+// Helper function reporting whether the request has a JSON content type, e.g. "application/json; charset=utf-8"
+func isJSONRequest(request *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
@@ -1,24 +1,376 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"overengineered_calculator/calculator"
+	"overengineered_calculator/storage"
+	"slices"
 )
 
-// Set up routes for the calculator API
-func (api *API) RegisterRoutes(mux *http.ServeMux) {
+// route is an entry of the route table of a version. RegisterRoutes serves the table and the /openapi.json
+// of the version describes it, so a route is documented by adding it to the table.
+type route struct {
+	path    string
+	methods []string
+	handler http.HandlerFunc // Without the method check and authentication, which RegisterRoutes adds
+	auth    bool             // Whether the route requires a bearer token
+	roles   []string         // Roles allowed to call a route that requires a token, every role if empty
+	scope   string           // Scope an API key needs to call the route. API keys cannot call routes without a scope
+	root    bool             // Served once at its path instead of under the prefix of each version, see rootRoutes
 
-	// // Public route for login
-	mux.HandleFunc("/login", api.loginHandler)
-	mux.HandleFunc("/register", api.registerHandler)
+	summary  string
+	params   []openAPIParameter  // Query parameters
+	body     *openAPIRequestBody // Body of POST requests
+	status   int                 // Status of a successful response, 200 if not set
+	response openAPIResponse
+}
+
+// Set up routes for the calculator API. Every operation in the calculator's registry is served
+// at its route, so operations must be registered before calling this. Routes answer methods they do
+// not support with 405, and calculations accept their parameters as a JSON body on POST.
+//
+// The routes of each version are served under its prefix, e.g. /v1/add, and versions are given side by side,
+// e.g. RegisterRoutes(mux, V1, V2). Without versions, V1 is registered. The routes of V1 are also served
+// without prefix as deprecated aliases for existing clients, see deprecatedAlias.
+func (api *API) RegisterRoutes(mux *http.ServeMux, versions ...Version) {
+	api.registerRoutes(mux, versions...)
+}
+
+// routeMux is the part of http.ServeMux used to register routes
+type routeMux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+func (api *API) registerRoutes(mux routeMux, versions ...Version) {
+	if len(versions) == 0 {
+		versions = []Version{V1}
+	}
+
+	for _, version := range versions {
+		routes := api.versionRoutes(version)
+		for _, path := range routePaths(routes) {
+			handler := api.pathHandler(routes, path)
+			mux.Handle(version.Prefix()+path, handler)
+			if version.Name == V1.Name {
+				mux.Handle(path, deprecatedAlias(handler, version.Prefix()+path))
+			}
+		}
+	}
+
+	routes := api.rootRoutes()
+	for _, path := range routePaths(routes) {
+		mux.Handle(path, api.pathHandler(routes, path))
+	}
+}
+
+// Helper function to get the paths of the routes in the order of the table, each path once
+func routePaths(routes []route) []string {
+	var paths []string
+	for _, route := range routes {
+		if !slices.Contains(paths, route.path) {
+			paths = append(paths, route.path)
+		}
+	}
+	return paths
+}
+
+// Helper function to create the handler of a path. Routes of the same path with different methods, e.g.
+// GET and POST /api-keys, are served by one handler that picks the route by the method of the request.
+// Like http.ServeMux with conflicting patterns, it panics if two routes have the same path and method.
+func (api *API) pathHandler(routes []route, path string) http.HandlerFunc {
+	handlers := make(map[string]http.HandlerFunc)
+	var methods []string
+	for _, route := range routes {
+		if route.path != path {
+			continue
+		}
+		handler := api.routeHandler(route)
+		for _, method := range route.methods {
+			if _, exists := handlers[method]; exists {
+				panic(fmt.Sprintf("api: %s %s is registered by two routes", method, path))
+			}
+			handlers[method] = handler
+			if method == http.MethodGet {
+				handlers[http.MethodHead] = handler
+			}
+		}
+		methods = append(methods, route.methods...)
+	}
+
+	return allowMethods(func(writer http.ResponseWriter, request *http.Request) {
+		handlers[request.Method](writer, request)
+	}, methods...)
+}
+
+// Helper function to add the authentication and role and scope checks of a route to its handler
+func (api *API) routeHandler(route route) http.HandlerFunc {
+	handler := route.handler
+	if len(route.roles) > 0 {
+		handler = requireRole(handler, route.roles...)
+	}
+	if route.auth {
+		handler = api.authMiddleware(requireScope(handler, route.scope))
+	}
+	return handler
+}
+
+// rootRoutes returns the routes that are not versioned, such as the /.well-known URIs of RFC 8615.
+// They are described in the OpenAPI document of every version.
+func (api *API) rootRoutes() []route {
+	return []route{
+		{
+			path: "/.well-known/jwks.json", methods: []string{http.MethodGet},
+			handler: api.jwksHandler,
+			root:    true,
+			summary: "Lists the public keys that verify the tokens",
+			response: jsonResponse("The JSON Web Key Set (RFC 7517) of the RS256 and EdDSA keys", objectSchema(map[string]jsonSchema{
+				"keys": arraySchema(jsonSchema{"type": "object"}),
+			})),
+		},
+	}
+}
+
+// routes returns the route table of V1, with a route for every operation in the calculator's registry
+func (api *API) routes() []route {
+	historyParams := []openAPIParameter{
+		queryParam("operation", "Operations to include, e.g. add. May be repeated or comma separated", stringSchema),
+		queryParam("from", "Start of the time range as an RFC 3339 timestamp (inclusive)", dateTimeSchema),
+		queryParam("to", "End of the time range as an RFC 3339 timestamp (exclusive)", dateTimeSchema),
+		queryParam("minResult", "Smallest result to include", numberSchema),
+		queryParam("maxResult", "Largest result to include", numberSchema),
+	}
+	sortParams := []openAPIParameter{
+		queryParam("sort", "Sort key", enumSchema("timestamp", "result")),
+		queryParam("order", "Sort order", enumSchema("desc", "asc")),
+	}
+	credentials := jsonBody(schemaRef("Credentials"))
+
+	// Routes that change the history are not allowed for read-only users
+	writers := []string{storage.RoleUser, storage.RoleAdmin}
+	admins := []string{storage.RoleAdmin}
+	usernameParams := []openAPIParameter{pathParam("username", "Username of the user")}
+
+	// Public routes
+	routes := []route{
+		{
+			path: "/login", methods: []string{http.MethodPost},
+			handler:  requireJSON(api.loginHandler, maxJSONBodyBytes),
+			summary:  "Logs in and returns a bearer token and a refresh token",
+			body:     credentials,
+			response: jsonResponse("The tokens of a new session", schemaRef("Tokens")),
+		},
+		{
+			path: "/token/refresh", methods: []string{http.MethodPost},
+			handler:  requireJSON(api.refreshHandler, maxJSONBodyBytes),
+			summary:  "Exchanges a refresh token for a new bearer token and refresh token",
+			body:     jsonBody(schemaRef("RefreshRequest")),
+			response: jsonResponse("The new tokens. The refresh token of the request can no longer be used", schemaRef("Tokens")),
+		},
+		{
+			path: "/logout", methods: []string{http.MethodPost},
+			handler: api.logoutHandler,
+			auth:    true,
+			summary: "Revokes the bearer token, and the session of the refresh token if given",
+			body: &openAPIRequestBody{
+				Content: map[string]openAPIMediaType{"application/json": {Schema: schemaRef("RefreshRequest")}},
+			},
+			status:   http.StatusNoContent,
+			response: openAPIResponse{Description: "The tokens are revoked"},
+		},
+		{
+			path: "/register", methods: []string{http.MethodPost},
+			handler: requireJSON(api.registerHandler, maxJSONBodyBytes),
+			summary: "Registers a new user",
+			body:    credentials,
+			status:  http.StatusCreated,
+			response: jsonResponse("The user is registered", objectSchema(map[string]jsonSchema{
+				"message": stringSchema,
+			})),
+		},
+		{
+			path: "/operations", methods: []string{http.MethodGet},
+			handler:  api.operationsHandler,
+			summary:  "Lists the registered operations",
+			response: jsonResponse("The operations in registration order", arraySchema(schemaRef("Operation"))),
+		},
+	}
 
 	// Protect routes with authentication
-	mux.Handle("/add", api.authMiddleware(api.addHandler))
-	mux.Handle("/subtract", api.authMiddleware(api.subtractHandler))
-	mux.Handle("/multiply", api.authMiddleware(api.multiplyHandler))
-	mux.Handle("/divide", api.authMiddleware(api.divideHandler))
-	mux.Handle("/modulo", api.authMiddleware(api.moduloHandler))
-	mux.Handle("/power", api.authMiddleware(api.powerHandler))
-	mux.Handle("/history", api.authMiddleware(api.historyHandler))
-	mux.Handle("/history/reset", api.authMiddleware(api.resetHandler))
+	for _, operation := range api.calculator.Registry().Operations() {
+		params := operationParams(operation)
+		routes = append(routes, route{
+			path: operation.Route(), methods: []string{http.MethodGet, http.MethodPost},
+			handler:  jsonParams(api.operationHandler(operation.Name)),
+			auth:     true,
+			roles:    writers,
+			scope:    scopeCalculate,
+			summary:  operation.Description,
+			params:   params,
+			body:     paramsBody(params),
+			response: jsonResponse("The result", schemaRef("Result")),
+		})
+	}
+
+	evaluateParams := []openAPIParameter{
+		requiredParam(queryParam("expression", "Infix expression, e.g. (3 + 4) * 2 ^ 5 % 7", stringSchema)),
+	}
+	routes = append(routes, []route{
+		{
+			path: "/evaluate", methods: []string{http.MethodGet, http.MethodPost},
+			handler:  jsonParams(api.evaluateHandler),
+			auth:     true,
+			roles:    writers,
+			scope:    scopeCalculate,
+			summary:  "Evaluates an infix expression",
+			params:   evaluateParams,
+			body:     paramsBody(evaluateParams),
+			response: jsonResponse("The result", schemaRef("Result")),
+		},
+		{
+			path: "/batch", methods: []string{http.MethodPost},
+			handler:  requireJSON(api.batchHandler, maxBatchBytes),
+			auth:     true,
+			roles:    writers,
+			scope:    scopeCalculate,
+			summary:  "Evaluates up to 500 calculations in one request",
+			body:     jsonBody(arraySchema(schemaRef("BatchItem"))),
+			response: jsonResponse("A result or error for each calculation, in order", arraySchema(schemaRef("BatchResult"))),
+		},
+		{
+			path: "/history", methods: []string{http.MethodGet},
+			handler: api.historyHandler,
+			auth:    true,
+			scope:   scopeHistoryRead,
+			summary: "Gets a page of the history of the user",
+			params: concatParams([]openAPIParameter{
+				queryParam("limit", "Entries per page", jsonSchema{"type": "integer", "minimum": 1, "maximum": 1000, "default": 50}),
+				queryParam("pageToken", "nextPageToken of the previous page", stringSchema),
+			}, historyParams, sortParams),
+			response: jsonResponse("A page of the history", schemaRef("HistoryPage")),
+		},
+		{
+			path: "/history/reset", methods: []string{http.MethodPost},
+			handler:  api.resetHandler,
+			auth:     true,
+			roles:    writers,
+			scope:    scopeHistoryWrite,
+			summary:  "Deletes the history of the user",
+			response: openAPIResponse{Description: "The history is deleted"},
+		},
+		{
+			path: "/history/export", methods: []string{http.MethodGet},
+			handler: api.exportHandler,
+			auth:    true,
+			scope:   scopeHistoryRead,
+			summary: "Downloads the history of the user as a file",
+			params: concatParams([]openAPIParameter{
+				queryParam("format", "File format, by default chosen from the Accept header", enumSchema("csv", "ndjson", "xlsx")),
+			}, historyParams, sortParams),
+			response: fileResponse("The history file", exportContentTypes()...),
+		},
+		{
+			path: "/history/import", methods: []string{http.MethodPost},
+			handler: api.importHandler,
+			auth:    true,
+			roles:   writers,
+			scope:   scopeHistoryWrite,
+			summary: "Imports an exported history file into the history of the user",
+			params: []openAPIParameter{
+				queryParam("format", "File format, by default given by the Content-Type", enumSchema("csv", "ndjson")),
+				queryParam("mismatch", "Whether rows with a wrong result are rejected or imported and flagged", enumSchema("reject", "flag")),
+			},
+			body:     fileBody("text/csv", "application/x-ndjson"),
+			response: jsonResponse("Summary of the import", schemaRef("ImportResponse")),
+		},
+		{
+			path: "/history/verify", methods: []string{http.MethodGet},
+			handler: api.verifyHandler,
+			auth:    true,
+			scope:   scopeHistoryRead,
+			summary: "Recomputes the history of the user and reports the results that differ",
+			params: concatParams([]openAPIParameter{
+				queryParam("tolerance", "Largest accepted absolute difference", jsonSchema{"type": "number", "minimum": 0, "default": 0}),
+			}, historyParams),
+			response: jsonResponse("The verification report", schemaRef("VerifyReport")),
+		},
+	}...)
+
+	// Management of the API keys of the user. API keys cannot manage keys, as the routes have no scope.
+	routes = append(routes, []route{
+		{
+			path: "/api-keys", methods: []string{http.MethodGet},
+			handler:  api.listAPIKeysHandler,
+			auth:     true,
+			summary:  "Lists the API keys of the user",
+			response: jsonResponse("The API keys, oldest first. The keys themselves are only returned when created", arraySchema(schemaRef("APIKey"))),
+		},
+		{
+			path: "/api-keys", methods: []string{http.MethodPost},
+			handler:  requireJSON(api.createAPIKeyHandler, maxJSONBodyBytes),
+			auth:     true,
+			summary:  "Creates an API key that calls the API as the user, limited to its scopes",
+			body:     jsonBody(schemaRef("APIKeyRequest")),
+			status:   http.StatusCreated,
+			response: jsonResponse("The API key. The key is only returned here", schemaRef("NewAPIKey")),
+		},
+		{
+			path: "/api-keys/{id}", methods: []string{http.MethodDelete},
+			handler:  api.deleteAPIKeyHandler,
+			auth:     true,
+			summary:  "Revokes an API key of the user",
+			params:   []openAPIParameter{pathParam("id", "ID of the API key")},
+			status:   http.StatusNoContent,
+			response: openAPIResponse{Description: "The API key is revoked"},
+		},
+	}...)
+
+	// Administration of the other users
+	routes = append(routes, []route{
+		{
+			path: "/admin/users", methods: []string{http.MethodGet},
+			handler:  api.listUsersHandler,
+			auth:     true,
+			roles:    admins,
+			summary:  "Lists the users and their roles",
+			response: jsonResponse("The users sorted by username", arraySchema(schemaRef("User"))),
+		},
+		{
+			path: "/admin/users/{username}/history/reset", methods: []string{http.MethodPost},
+			handler:  api.adminResetHandler,
+			auth:     true,
+			roles:    admins,
+			summary:  "Deletes the history of another user",
+			params:   usernameParams,
+			response: openAPIResponse{Description: "The history is deleted"},
+		},
+	}...)
+
+	return routes
+}
+
+// operationParams returns the query parameters of an operation, depending on its arity and supported modes
+func operationParams(operation calculator.Operation) []openAPIParameter {
+	precisions := describeOperation(operation).Precisions
 
+	var params []openAPIParameter
+	if operation.Arity == calculator.Unary {
+		params = append(params, requiredParam(queryParam("operand", "The operand", numberOrStringSchema)))
+	} else {
+		params = append(params,
+			requiredParam(queryParam("operand1", "Left operand, e.g. 3, 3/4 or 3+4i", numberOrStringSchema)),
+			requiredParam(queryParam("operand2", "Right operand", numberOrStringSchema)),
+		)
+	}
+	if len(precisions) > 1 {
+		params = append(params, queryParam("precision", "Precision mode", enumSchema(precisions...)))
+	}
+	if operation.Decimal != nil {
+		params = append(params, queryParam("digits", "Significant digits in decimal precision",
+			jsonSchema{"type": "integer", "minimum": 1, "maximum": calculator.MaxDecimalDigits, "default": calculator.DefaultDecimalDigits}))
+	}
+	if operation.UsesAngle {
+		params = append(params, queryParam("angle", "Angle mode", enumSchema("radians", "degrees")))
+	}
+	return params
 }
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"overengineered_calculator/storage"
+	"time"
+)
+
+// Lifetime of the refresh tokens. Each refresh returns a new refresh token, so a session lasts as long as the
+// client refreshes within this time.
+const refreshTokenLifetime = 30 * 24 * time.Hour
+
+// tokenResponse is the response of /login and /token/refresh
+type tokenResponse struct {
+	Token        string `json:"token"`        // Access token, prefixed with "Bearer "
+	RefreshToken string `json:"refreshToken"` // Exchanged for new tokens at /token/refresh
+	ExpiresIn    int    `json:"expiresIn"`    // Lifetime of the access token in seconds
+}
+
+// refreshRequest is the body of /token/refresh and the optional body of /logout
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Helper function to create a random token of n bytes, encoded as base64url
+func randomToken(n int) (string, error) {
+	token := make([]byte, n)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("could not generate a random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// Helper function to get the ID of a refresh token in storage. Only the SHA-256 hash is stored, so the
+// stored tokens cannot be used to refresh.
+func refreshTokenID(refreshToken string) string {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(hash[:])
+}
+
+// issueTokens creates an access token with the role of the user and a refresh token of the family, and saves
+// the refresh token
+func (api *API) issueTokens(ctx context.Context, user storage.User, family string) (tokenResponse, error) {
+	accessToken, err := api.keys.generateJWT(user.Username, user.Role)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	err = api.storage.SaveRefreshToken(ctx, storage.RefreshToken{
+		ID:        refreshTokenID(refreshToken),
+		Family:    family,
+		Owner:     user.Username,
+		ExpiresAt: time.Now().Add(refreshTokenLifetime),
+	})
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	return tokenResponse{
+		Token:        "Bearer " + accessToken, // Adding 'Bearer' as per jwt.io/introduction
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessTokenLifetime / time.Second),
+	}, nil
+}
+
+// Handler for exchanging a refresh token for new tokens. Each refresh token can be used once. Using it again means
+// it was stolen, or the client misbehaves, so every token of its family is revoked and the user must log in again.
+func (api *API) refreshHandler(writer http.ResponseWriter, request *http.Request) {
+	var body refreshRequest
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		writeError(writer, invalidBody(err, "invalid refresh request format"), http.StatusBadRequest)
+		return
+	}
+	if body.RefreshToken == "" {
+		writeError(writer, invalidParameter("refreshToken is required"), http.StatusBadRequest)
+		return
+	}
+
+	token, err := api.storage.UseRefreshToken(request.Context(), refreshTokenID(body.RefreshToken))
+	switch {
+	case errors.Is(err, storage.ErrTokenNotFound):
+		writeError(writer, errInvalidRefreshToken, http.StatusUnauthorized)
+		return
+
+	case errors.Is(err, storage.ErrTokenUsed):
+		log.Printf("Refresh token of %s was reused, revoking its session", token.Owner)
+		if err := api.storage.RevokeRefreshTokens(request.Context(), token.Family); err != nil {
+			writeError(writer, err, http.StatusInternalServerError)
+			return
+		}
+		writeError(writer, errRefreshTokenReused, http.StatusUnauthorized)
+		return
+
+	case err != nil:
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		writeError(writer, errRefreshTokenExpired, http.StatusUnauthorized)
+		return
+	}
+
+	// The role is read again, so a changed role applies from the next refresh
+	user, err := api.storage.GetUser(request.Context(), token.Owner)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		err = errInvalidRefreshToken
+	}
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+
+	response, err := api.issueTokens(request.Context(), user, token.Family)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(writer, response)
+}
+
+// Handler for logging out. The access token of the request is revoked until it expires. When the body gives
+// the refresh token of the session, e.g. {"refreshToken": "..."}, every refresh token of the session is revoked too.
+func (api *API) logoutHandler(writer http.ResponseWriter, request *http.Request) {
+	claims, ok := request.Context().Value(claimsKey).(*claims)
+	if !ok {
+		writeError(writer, errUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	// The body is optional, as clients without a refresh token only need to revoke the access token
+	var body refreshRequest
+	if request.ContentLength != 0 {
+		if !isJSONRequest(request) {
+			writeError(writer, errNotJSON, http.StatusUnsupportedMediaType)
+			return
+		}
+		err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxJSONBodyBytes)).Decode(&body)
+		if err != nil {
+			writeError(writer, invalidBody(err, "invalid logout request format"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The refresh token is looked up without using it, so a token of another user is rejected before anything
+	// is revoked and its session keeps working
+	var family string
+	if body.RefreshToken != "" {
+		token, err := api.storage.GetRefreshToken(request.Context(), refreshTokenID(body.RefreshToken))
+		if errors.Is(err, storage.ErrTokenNotFound) || (err == nil && token.Owner != claims.Username) {
+			err = errInvalidRefreshToken
+		}
+		if err != nil {
+			writeError(writer, err, http.StatusInternalServerError)
+			return
+		}
+		family = token.Family
+	}
+
+	if claims.ID != "" {
+		err := api.storage.RevokeAccessToken(request.Context(), claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			writeError(writer, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if family != "" {
+		if err := api.storage.RevokeRefreshTokens(request.Context(), family); err != nil {
+			writeError(writer, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -2,29 +2,61 @@ package api
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
+	"overengineered_calculator/calculator"
 	"strconv"
+	"strings"
 )
 
-// Type definitions for passing functions as arguments to handlers more cleanly
-type calculatorOperation func(a, b float64) float64
-type calculatorOperationWithError func(a, b float64) (float64, error)
-
 // Helper function to parse operands from the request as float64
 func parseOperands(request *http.Request) (float64, float64, error) {
-	operand1, err1 := strconv.ParseFloat(request.URL.Query().Get("operand1"), 64)
-	operand2, err2 := strconv.ParseFloat(request.URL.Query().Get("operand2"), 64)
+	operand1, err1 := parseOperand(request.URL.Query().Get("operand1"))
+	operand2, err2 := parseOperand(request.URL.Query().Get("operand2"))
 	if err1 != nil || err2 != nil {
-		return 0, 0, errors.New("invalid operands")
+		return 0, 0, errInvalidOperands
 	}
 
 	return operand1, operand2, nil
 }
 
-// Helper function to write JSON response with the result
-func writeResultJSON(writer http.ResponseWriter, result float64) {
+// Helper function to parse the single operand of a unary operation from the request as float64
+func parseUnaryOperand(request *http.Request) (float64, error) {
+	operand, err := parseOperand(request.URL.Query().Get("operand"))
+	if err != nil {
+		return 0, calculator.ErrInvalidOperand
+	}
+
+	return operand, nil
+}
+
+// Helper function to parse a single operand as float64. Besides regular numbers,
+// fractions such as "3/4" are accepted and converted to their closest float64.
+// Fractions are bounded in size like the operands of the rational mode.
+func parseOperand(value string) (float64, error) {
+	operand, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		return operand, nil
+	}
+
+	if strings.Contains(value, "/") {
+		fraction, fractionErr := calculator.NewRationalCalculator().Parse(value)
+		if fractionErr == nil {
+			operand, _ = fraction.Float64()
+			return operand, nil
+		}
+	}
+	return 0, err
+}
+
+// Helper function to write JSON response with the result.
+// The result is a float64, or a string for exact precision modes.
+func writeResultJSON(writer http.ResponseWriter, result interface{}) {
+	writeJSON(writer, map[string]interface{}{"result": result})
+}
+
+// Helper function to write any value as a JSON response
+func writeJSON(writer http.ResponseWriter, value interface{}) {
 	writer.Header().Set("Content-Type", "application/json")
 
-	json.NewEncoder(writer).Encode(map[string]float64{"result": result})
+	json.NewEncoder(writer).Encode(value)
 }
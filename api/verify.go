@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"math"
+	"math/cmplx"
+	"net/http"
+	"overengineered_calculator/calculator"
+	"overengineered_calculator/storage"
+	"strconv"
+	"time"
+)
+
+// Number of mismatches listed in a verification report. Further mismatches are only counted.
+const maxVerifyMismatches = 1000
+
+// VerifyReport is the result of replaying a history against the current calculator
+type VerifyReport struct {
+	Checked    int              `json:"checked"`
+	Mismatched int              `json:"mismatched"`
+	Mismatches []VerifyMismatch `json:"mismatches"`
+}
+
+// VerifyMismatch is an entry whose stored result differs from the recomputed one by more than the tolerance,
+// or that cannot be computed anymore, in which case Error tells why. Difference is omitted when not finite.
+type VerifyMismatch struct {
+	ID         string    `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Formatted  string    `json:"formatted"`
+	Stored     string    `json:"stored"`
+	Recomputed string    `json:"recomputed,omitempty"`
+	Difference float64   `json:"difference,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Code       string    `json:"code,omitempty"`
+}
+
+// VerifyHistory executes every entry of the history selected by the query again with the operation named in
+// the entry, and reports the entries whose result now differs from the stored result by more than tolerance.
+// The history is read page by page, so the limit and page token of the query are ignored.
+func (api *API) VerifyHistory(ctx context.Context, query storage.HistoryQuery, tolerance float64) (VerifyReport, error) {
+	report := VerifyReport{Mismatches: []VerifyMismatch{}}
+	query.Limit = storage.MaxHistoryLimit
+	query.PageToken = ""
+
+	for {
+		page, err := api.storage.QueryHistory(ctx, query)
+		if err != nil {
+			return report, err
+		}
+
+		for _, entry := range page.Entries {
+			report.Checked++
+			mismatch, found := api.verifyEntry(entry, tolerance)
+			if !found {
+				continue
+			}
+
+			report.Mismatched++
+			if len(report.Mismatches) < maxVerifyMismatches {
+				report.Mismatches = append(report.Mismatches, mismatch)
+			}
+		}
+
+		if page.NextPageToken == "" {
+			return report, nil
+		}
+		query.PageToken = page.NextPageToken
+	}
+}
+
+// Helper function to recompute a single entry, returning the mismatch if it does not verify
+func (api *API) verifyEntry(entry storage.HistoryEntry, tolerance float64) (VerifyMismatch, bool) {
+	row := api.historyRow(entry)
+	mismatch := VerifyMismatch{
+		ID:        entry.ID,
+		Timestamp: entry.Timestamp,
+		Formatted: api.formatHistoryEntry(entry).Formatted,
+		Stored:    row["result"],
+	}
+
+	_, result, err := api.recomputeRow(row)
+	if err != nil {
+		mismatch.Error = err.Error()
+		mismatch.Code = errorCode(err)
+		return mismatch, true
+	}
+	mismatch.Recomputed = result
+
+	difference := resultDifference(entry.Mode, mismatch.Stored, result)
+	if difference <= tolerance {
+		return mismatch, false
+	}
+	if !math.IsInf(difference, 0) && !math.IsNaN(difference) {
+		mismatch.Difference = difference
+	}
+	return mismatch, true
+}
+
+// Helper function to compute the absolute difference between a stored and a recomputed result, both formatted as
+// in the history. Equal results differ by 0, even when not a number, and results that cannot be compared by +Inf.
+func resultDifference(mode string, stored string, recomputed string) float64 {
+	if stored == recomputed {
+		return 0
+	}
+
+	if mode == precisionComplex {
+		complexCalculator := calculator.NewComplexCalculator()
+		value1, err1 := complexCalculator.Parse(stored)
+		value2, err2 := complexCalculator.Parse(recomputed)
+		if err1 != nil || err2 != nil {
+			return math.Inf(1)
+		}
+		return cmplx.Abs(value1 - value2)
+	}
+
+	// Fractions of the rational mode are compared by their float64 approximations
+	value1, err1 := parseOperand(stored)
+	value2, err2 := parseOperand(recomputed)
+	if err1 != nil || err2 != nil {
+		return math.Inf(1)
+	}
+	return math.Abs(value1 - value2)
+}
+
+// Handler for verifying the history of the authenticated user against the current calculator. It takes the
+// filters of /history and a tolerance parameter, the largest accepted absolute difference (default 0).
+func (api *API) verifyHandler(writer http.ResponseWriter, request *http.Request) {
+	username, found := UserFromContext(request.Context())
+	if !found {
+		writeError(writer, errUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	query, err := api.parseHistoryQuery(request, username)
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+
+	tolerance, err := parseTolerance(request.URL.Query().Get("tolerance"))
+	if err != nil {
+		writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+
+	report, err := api.VerifyHistory(request.Context(), query, tolerance)
+	if err != nil {
+		writeError(writer, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(writer, report)
+}
+
+// Helper function to parse an optional non-negative tolerance. An empty string gives 0.
+func parseTolerance(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	tolerance, err := strconv.ParseFloat(value, 64)
+	if err != nil || tolerance < 0 || math.IsNaN(tolerance) {
+		return 0, invalidParameter("tolerance must be a non-negative number")
+	}
+	return tolerance, nil
+}
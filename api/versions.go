@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Version is a set of routes served under the prefix of its name, e.g. /v1/add. Versions are registered side by
+// side with RegisterRoutes, so a new version can change the shape of responses while clients keep using the old one.
+type Version struct {
+	Name   string
+	routes func(api *API) []route // Route table of the version, without /openapi.json which every version serves
+}
+
+// V1 is the first version of the API. Its routes are also served without prefix as deprecated aliases.
+var V1 = Version{Name: "v1", routes: (*API).routes}
+
+// Date the unprefixed routes were deprecated in favour of /v1, and the date they will be removed
+var (
+	legacyDeprecated = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	legacySunset     = time.Date(2027, time.April, 18, 0, 0, 0, 0, time.UTC)
+)
+
+// Prefix returns the path prefix of the routes of the version, e.g. "/v1"
+func (version Version) Prefix() string {
+	return "/" + version.Name
+}
+
+// versionRoutes returns the route table of a version together with the route serving its OpenAPI document.
+// The document is created once, so it describes exactly the routes that are registered, and the root routes.
+func (api *API) versionRoutes(version Version) []route {
+	routes := append(version.routes(api), route{
+		path: "/openapi.json", methods: []string{http.MethodGet},
+		summary:  "Returns this OpenAPI document",
+		response: jsonResponse("The OpenAPI 3 document of this version of the API", jsonSchema{"type": "object"}),
+	})
+
+	document := openAPIDocumentOf(version, append(routes, api.rootRoutes()...))
+	routes[len(routes)-1].handler = func(writer http.ResponseWriter, request *http.Request) {
+		writeJSON(writer, document)
+	}
+	return routes
+}
+
+// Middleware for the unprefixed alias of a route of V1. The response tells the client that the alias is deprecated
+// (RFC 9745), when it will be removed (RFC 8594) and which route replaces it.
+func deprecatedAlias(nextHandler http.HandlerFunc, successor string) http.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", legacyDeprecated.Unix())
+	sunset := legacySunset.Format(http.TimeFormat)
+	link := fmt.Sprintf(`<%s>; rel="successor-version"`, successor)
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Deprecation", deprecation)
+		writer.Header().Set("Sunset", sunset)
+		writer.Header().Add("Link", link)
+		nextHandler.ServeHTTP(writer, request)
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xlsxWriter streams a single worksheet as an Office Open XML spreadsheet (.xlsx). The package files are
+// written to a zip stream, so rows are sent to the client as they are written instead of being held in memory.
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   io.Writer
+	rows    int
+}
+
+// Package files that do not depend on the rows. The worksheet is xl/worksheets/sheet1.xml.
+var xlsxPackageFiles = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="History" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+}
+
+// newXLSXWriter writes the package files and the start of the worksheet to writer.
+func newXLSXWriter(writer io.Writer) (*xlsxWriter, error) {
+	archive := zip.NewWriter(writer)
+
+	for _, file := range xlsxPackageFiles {
+		fileWriter, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.WriteString(fileWriter, file.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The worksheet must be the last file, since the zip stream cannot go back to a previous file
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &xlsxWriter{archive: archive, sheet: sheet}, nil
+}
+
+// WriteRow writes a row of cells. Numeric cells are stored as numbers, the others as inline strings.
+func (writer *xlsxWriter) WriteRow(cells []exportCell) error {
+	writer.rows++
+	row := strconv.Itoa(writer.rows)
+
+	var builder strings.Builder
+	builder.WriteString(`<row r="` + row + `">`)
+	for i, cell := range cells {
+		if cell.Value == "" {
+			continue
+		}
+
+		reference := xlsxColumn(i) + row
+		if cell.Numeric {
+			builder.WriteString(`<c r="` + reference + `"><v>` + cell.Value + `</v></c>`)
+		} else {
+			builder.WriteString(`<c r="` + reference + `" t="inlineStr"><is><t>`)
+			xml.EscapeText(&builder, []byte(cell.Value))
+			builder.WriteString(`</t></is></c>`)
+		}
+	}
+	builder.WriteString(`</row>`)
+
+	_, err := io.WriteString(writer.sheet, builder.String())
+	return err
+}
+
+// Close ends the worksheet and writes the zip directory. It does not close the underlying writer.
+func (writer *xlsxWriter) Close() error {
+	_, err := io.WriteString(writer.sheet, `</sheetData></worksheet>`)
+	if err != nil {
+		return err
+	}
+	return writer.archive.Close()
+}
+
+// xlsxColumn returns the name of the column with the zero-based index, e.g. 0 is "A" and 26 is "AA".
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
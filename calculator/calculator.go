@@ -2,15 +2,31 @@
 package calculator
 
 import (
-	"errors"
 	"math"
 )
 
 type Calculator struct {
+	registry *Registry
 }
 
+// NewCalculator returns a Calculator with all built-in operations registered.
 func NewCalculator() *Calculator {
-	return &Calculator{}
+	calc := &Calculator{
+		registry: NewRegistry(),
+	}
+
+	for _, operation := range calc.builtinOperations() {
+		if err := calc.registry.Register(operation); err != nil {
+			panic(err) // Built-in operations are always valid
+		}
+	}
+	return calc
+}
+
+// Registry returns the operations available in the calculator. Register custom operations on it
+// before the API routes are registered to have them served like the built-in ones.
+func (calc *Calculator) Registry() *Registry {
+	return calc.registry
 }
 
 // Add takes two float64 operands, returns their sum, and saves the operation to history.
@@ -39,7 +55,7 @@ func (calc *Calculator) Multiply(operand1 float64, operand2 float64) float64 {
 func (calc *Calculator) Divide(operand1 float64, operand2 float64) (float64, error) {
 
 	if operand2 == 0 {
-		return 0, errors.New("cannot divide by zero")
+		return 0, ErrDivideByZero
 	}
 
 	result := operand1 / operand2
@@ -51,7 +67,7 @@ func (calc *Calculator) Divide(operand1 float64, operand2 float64) (float64, err
 func (calc *Calculator) Modulo(operand1 float64, operand2 float64) (float64, error) {
 
 	if operand2 == 0 {
-		return 0, errors.New("cannot modulo by zero")
+		return 0, ErrModuloByZero
 	}
 
 	result := math.Mod(operand1, operand2) // Standard "%" operator does not work with floats
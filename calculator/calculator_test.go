@@ -1,6 +1,7 @@
 package calculator
 
 import (
+	"errors"
 	"math"
 	"testing"
 )
@@ -244,8 +245,8 @@ func TestDivideByZero(t *testing.T) {
 	calc := setupCalculatorWithLocalStorage()
 
 	_, err := calc.Divide(10000, 0)
-	if err == nil {
-		t.Error("Expected error but got nil")
+	if !errors.Is(err, ErrDivideByZero) {
+		t.Errorf("Expected ErrDivideByZero but got %v", err)
 	}
 }
 
@@ -333,8 +334,8 @@ func TestModuloByZero(t *testing.T) {
 	calc := setupCalculatorWithLocalStorage()
 
 	_, err := calc.Modulo(10000, 0)
-	if err == nil {
-		t.Error("Expected error but got nil")
+	if !errors.Is(err, ErrModuloByZero) {
+		t.Errorf("Expected ErrModuloByZero but got %v", err)
 	}
 }
 
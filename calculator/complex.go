@@ -0,0 +1,92 @@
+package calculator
+
+import (
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+// ComplexCalculator performs the arithmetic operations on complex numbers using complex128.
+// Unlike math.Pow, a negative base with a fractional exponent has a well defined (principal) result here.
+type ComplexCalculator struct {
+}
+
+func NewComplexCalculator() *ComplexCalculator {
+	return &ComplexCalculator{}
+}
+
+// IsComplexOperand reports whether the operand is written with an imaginary part, e.g. "3+4i" or "2i".
+func IsComplexOperand(operand string) bool {
+	return strings.HasSuffix(strings.TrimSpace(operand), "i")
+}
+
+// Parse converts a complex number such as "3+4i", "-2i" or "5" to a complex128.
+func (calc *ComplexCalculator) Parse(operand string) (complex128, error) {
+	value, err := strconv.ParseComplex(strings.TrimSpace(operand), 128)
+	if err != nil || cmplx.IsNaN(value) || cmplx.IsInf(value) {
+		return 0, &OperandError{Mode: "complex", Operand: operand}
+	}
+	return value, nil
+}
+
+// Format returns the complex number as "a+bi", or just "a" when the imaginary part is zero.
+func (calc *ComplexCalculator) Format(value complex128) string {
+	if imag(value) == 0 {
+		return strconv.FormatFloat(real(value), 'g', -1, 64)
+	}
+
+	// FormatComplex wraps the number in parentheses, e.g. "(3+4i)"
+	text := strconv.FormatComplex(value, 'g', -1, 128)
+	return strings.TrimSuffix(strings.TrimPrefix(text, "("), ")")
+}
+
+// Add takes two complex operands and returns their sum.
+func (calc *ComplexCalculator) Add(operand1 complex128, operand2 complex128) complex128 {
+	return operand1 + operand2
+}
+
+// Subtract takes two complex operands and returns their difference.
+func (calc *ComplexCalculator) Subtract(operand1 complex128, operand2 complex128) complex128 {
+	return operand1 - operand2
+}
+
+// Multiply takes two complex operands and returns their product.
+func (calc *ComplexCalculator) Multiply(operand1 complex128, operand2 complex128) complex128 {
+	return operand1 * operand2
+}
+
+// Divide takes two complex operands and returns their quotient.
+// If dividing by zero, the function returns an error.
+func (calc *ComplexCalculator) Divide(operand1 complex128, operand2 complex128) (complex128, error) {
+
+	if operand2 == 0 {
+		return 0, ErrDivideByZero
+	}
+
+	return operand1 / operand2, nil
+}
+
+// Power returns the principal value of operand1 raised to operand2, e.g. (-8)^(1/3) = 1+1.732i.
+func (calc *ComplexCalculator) Power(operand1 complex128, operand2 complex128) complex128 {
+	return cmplx.Pow(operand1, operand2)
+}
+
+// Sqrt returns the principal square root of the operand, e.g. sqrt(-4) = 2i.
+func (calc *ComplexCalculator) Sqrt(operand complex128) complex128 {
+	return cmplx.Sqrt(operand)
+}
+
+// Abs returns the modulus (magnitude) of the operand, e.g. |3+4i| = 5.
+func (calc *ComplexCalculator) Abs(operand complex128) float64 {
+	return cmplx.Abs(operand)
+}
+
+// Arg returns the argument (phase angle) of the operand in radians, in the range [-π, π].
+func (calc *ComplexCalculator) Arg(operand complex128) float64 {
+	return cmplx.Phase(operand)
+}
+
+// Conj returns the complex conjugate of the operand, e.g. conj(3+4i) = 3-4i.
+func (calc *ComplexCalculator) Conj(operand complex128) complex128 {
+	return cmplx.Conj(operand)
+}
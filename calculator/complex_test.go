@@ -0,0 +1,123 @@
+package calculator
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+// Adjust with a small epsilon to account for floating point imprecision
+const complexEpsilon = 0.00001
+
+func parseComplex(t *testing.T, calc *ComplexCalculator, operand string) complex128 {
+	value, err := calc.Parse(operand)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	return value
+}
+
+func TestComplexAdd(t *testing.T) {
+
+	calc := NewComplexCalculator()
+
+	result := calc.Add(parseComplex(t, calc, "3+4i"), parseComplex(t, calc, "1-2i"))
+	if calc.Format(result) != "4+2i" {
+		t.Errorf("Expected 4+2i but got %s", calc.Format(result))
+	}
+}
+
+func TestComplexSubtractToReal(t *testing.T) {
+
+	calc := NewComplexCalculator()
+
+	result := calc.Subtract(parseComplex(t, calc, "3+4i"), parseComplex(t, calc, "4i"))
+	if calc.Format(result) != "3" {
+		t.Errorf("Expected 3 but got %s", calc.Format(result))
+	}
+}
+
+func TestComplexMultiply(t *testing.T) {
+
+	calc := NewComplexCalculator()
+
+	// (1+2i)(3-i) = 3 - i + 6i - 2i² = 5+5i
+	result := calc.Multiply(parseComplex(t, calc, "1+2i"), parseComplex(t, calc, "3-1i"))
+	if calc.Format(result) != "5+5i" {
+		t.Errorf("Expected 5+5i but got %s", calc.Format(result))
+	}
+}
+
+func TestComplexDivide(t *testing.T) {
+
+	calc := NewComplexCalculator()
+
+	result, err := calc.Divide(parseComplex(t, calc, "5+5i"), parseComplex(t, calc, "1+2i"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if cmplx.Abs(result-complex(3, -1)) > complexEpsilon {
+		t.Errorf("Expected 3-1i but got %s", calc.Format(result))
+	}
+}
+
+func TestComplexDivideByZero(t *testing.T) {
+
+	calc := NewComplexCalculator()
+
+	_, err := calc.Divide(parseComplex(t, calc, "1+1i"), parseComplex(t, calc, "0"))
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestComplexPowerNegativeBaseFractionalExponent(t *testing.T) {
+
+	calc := NewComplexCalculator()
+
+	// math.Pow(-8, 1/3) is NaN, but the principal complex root is 1+√3i
+	result := calc.Power(complex(-8, 0), complex(1.0/3.0, 0))
+	if cmplx.Abs(result-complex(1, math.Sqrt(3))) > complexEpsilon {
+		t.Errorf("Expected 1+1.732i but got %s", calc.Format(result))
+	}
+}
+
+func TestComplexSqrtOfNegative(t *testing.T) {
+
+	calc := NewComplexCalculator()
+
+	result := calc.Sqrt(parseComplex(t, calc, "-4"))
+	if calc.Format(result) != "0+2i" {
+		t.Errorf("Expected 0+2i but got %s", calc.Format(result))
+	}
+}
+
+func TestComplexAbsArgConj(t *testing.T) {
+
+	calc := NewComplexCalculator()
+	operand := parseComplex(t, calc, "3+4i")
+
+	if calc.Abs(operand) != 5 {
+		t.Errorf("Expected 5 but got %f", calc.Abs(operand))
+	}
+
+	if math.Abs(calc.Arg(parseComplex(t, calc, "1i"))-math.Pi/2) > complexEpsilon {
+		t.Errorf("Expected π/2 but got %f", calc.Arg(parseComplex(t, calc, "1i")))
+	}
+
+	if calc.Format(calc.Conj(operand)) != "3-4i" {
+		t.Errorf("Expected 3-4i but got %s", calc.Format(calc.Conj(operand)))
+	}
+}
+
+func TestComplexParseInvalid(t *testing.T) {
+
+	calc := NewComplexCalculator()
+
+	for _, operand := range []string{"", "3+4j", "abc", "NaN"} {
+		_, err := calc.Parse(operand)
+		if err == nil {
+			t.Errorf("Expected error for %q but got nil", operand)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package calculator
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+const (
+	DefaultDecimalDigits = 34    // Same number of significant digits as IEEE 754 decimal128
+	MaxDecimalDigits     = 10000 // Upper bound to keep a single request from exhausting memory
+)
+
+// guardBits are extra mantissa bits used for intermediate results, so rounding errors
+// from the binary representation never show up in the requested number of decimal digits.
+const guardBits = 64
+
+// DecimalCalculator performs the arithmetic operations with arbitrary precision using math/big.
+// It is used where float64 rounding (e.g. 0.1 + 0.2 = 0.30000000000000004) is unacceptable.
+// Results are correctly rounded to the configured number of significant decimal digits.
+type DecimalCalculator struct {
+	digits    uint // Significant decimal digits of formatted results
+	precision uint // Mantissa precision in bits used for all computations
+}
+
+// NewDecimalCalculator returns a DecimalCalculator that works with the given number of significant digits.
+func NewDecimalCalculator(digits uint) (*DecimalCalculator, error) {
+	if digits == 0 || digits > MaxDecimalDigits {
+		return nil, ErrInvalidDigits
+	}
+
+	// Each decimal digit needs log2(10) ≈ 3.32 bits
+	precision := uint(math.Ceil(float64(digits)*math.Log2(10))) + guardBits
+
+	return &DecimalCalculator{
+		digits:    digits,
+		precision: precision,
+	}, nil
+}
+
+// Digits returns the number of significant decimal digits of formatted results.
+func (calc *DecimalCalculator) Digits() uint {
+	return calc.digits
+}
+
+// Parse converts a decimal string such as "0.1" or "1.5e300" to a big.Float with the calculator's precision.
+func (calc *DecimalCalculator) Parse(operand string) (*big.Float, error) {
+	value, _, err := big.ParseFloat(operand, 10, calc.precision, big.ToNearestEven)
+	if err != nil || value.IsInf() {
+		return nil, &OperandError{Mode: "decimal", Operand: operand}
+	}
+	return value, nil
+}
+
+// Format returns the value rounded to the calculator's number of significant digits.
+func (calc *DecimalCalculator) Format(value *big.Float) string {
+	return value.Text('g', int(calc.digits))
+}
+
+func (calc *DecimalCalculator) newFloat() *big.Float {
+	return new(big.Float).SetPrec(calc.precision)
+}
+
+// Add takes two decimal operands and returns their sum.
+func (calc *DecimalCalculator) Add(operand1 *big.Float, operand2 *big.Float) *big.Float {
+	return calc.newFloat().Add(operand1, operand2)
+}
+
+// Subtract takes two decimal operands and returns their difference.
+func (calc *DecimalCalculator) Subtract(operand1 *big.Float, operand2 *big.Float) *big.Float {
+	return calc.newFloat().Sub(operand1, operand2)
+}
+
+// Multiply takes two decimal operands and returns their product.
+func (calc *DecimalCalculator) Multiply(operand1 *big.Float, operand2 *big.Float) *big.Float {
+	return calc.newFloat().Mul(operand1, operand2)
+}
+
+// Divide takes two decimal operands and returns their quotient.
+// If dividing by zero, the function returns an error.
+func (calc *DecimalCalculator) Divide(operand1 *big.Float, operand2 *big.Float) (*big.Float, error) {
+
+	if operand2.Sign() == 0 {
+		return nil, ErrDivideByZero
+	}
+
+	return calc.newFloat().Quo(operand1, operand2), nil
+}
+
+// Modulo takes two decimal operands and returns the remainder of the truncated division.
+// Like math.Mod, the result has the sign of operand1. If modulo by zero, the function returns an error.
+func (calc *DecimalCalculator) Modulo(operand1 *big.Float, operand2 *big.Float) (*big.Float, error) {
+
+	if operand2.Sign() == 0 {
+		return nil, ErrModuloByZero
+	}
+
+	// The quotient needs enough bits to hold its whole integer part exactly, otherwise the remainder is wrong.
+	// The extra bits are bounded like the exponent of Power, so a few bytes of operands cannot take seconds.
+	quotientPrecision := calc.precision
+	if difference := operand1.MantExp(nil) - operand2.MantExp(nil); difference > 0 {
+		if difference > MaxDecimalDigits*4 {
+			return nil, ErrOutOfRange
+		}
+		quotientPrecision += uint(difference)
+	}
+
+	quotient := new(big.Float).SetPrec(quotientPrecision).Quo(operand1, operand2)
+	truncated, _ := quotient.Int(nil)
+
+	product := new(big.Float).SetPrec(quotientPrecision + calc.precision).SetInt(truncated)
+	product.Mul(product, operand2)
+
+	return calc.newFloat().Sub(operand1, product), nil
+}
+
+// Power raises operand1 to the integer power operand2 using exponentiation by squaring.
+// Fractional exponents and zero raised to a negative power return an error.
+func (calc *DecimalCalculator) Power(operand1 *big.Float, operand2 *big.Float) (*big.Float, error) {
+
+	if !operand2.IsInt() {
+		return nil, fmt.Errorf("decimal %w", ErrIntegerExponent)
+	}
+
+	exponent, accuracy := operand2.Int64()
+	if accuracy != big.Exact || exponent == math.MinInt64 {
+		return nil, ErrExponentTooLarge
+	}
+
+	if exponent < 0 && operand1.Sign() == 0 {
+		return nil, ErrZeroToNegativePower
+	}
+
+	negative := exponent < 0
+	if negative {
+		exponent = -exponent
+	}
+
+	result := calc.newFloat().SetInt64(1)
+	base := calc.newFloat().Set(operand1)
+	for exponent > 0 {
+		if exponent&1 == 1 {
+			result.Mul(result, base)
+		}
+		base.Mul(base, base)
+		exponent >>= 1
+	}
+
+	if negative {
+		result.Quo(calc.newFloat().SetInt64(1), result)
+	}
+
+	if result.IsInf() {
+		return nil, ErrOutOfRange
+	}
+	return result, nil
+}
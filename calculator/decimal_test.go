@@ -0,0 +1,162 @@
+package calculator
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func setupDecimalCalculator(t *testing.T, digits uint) *DecimalCalculator {
+	calc, err := NewDecimalCalculator(digits)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	return calc
+}
+
+func parseDecimal(t *testing.T, calc *DecimalCalculator, operand string) *big.Float {
+	value, err := calc.Parse(operand)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	return value
+}
+
+func TestDecimalAddIsExact(t *testing.T) {
+
+	calc := setupDecimalCalculator(t, 50)
+
+	result := calc.Add(parseDecimal(t, calc, "0.1"), parseDecimal(t, calc, "0.2"))
+	if calc.Format(result) != "0.3" {
+		t.Errorf("Expected 0.3 but got %s", calc.Format(result))
+	}
+}
+
+func TestDecimalSubtract(t *testing.T) {
+
+	calc := setupDecimalCalculator(t, 50)
+
+	result := calc.Subtract(parseDecimal(t, calc, "1"), parseDecimal(t, calc, "0.9"))
+	if calc.Format(result) != "0.1" {
+		t.Errorf("Expected 0.1 but got %s", calc.Format(result))
+	}
+}
+
+func TestDecimalMultiplyKeepsAllDigits(t *testing.T) {
+
+	calc := setupDecimalCalculator(t, 60)
+
+	result := calc.Multiply(parseDecimal(t, calc, "123456789012345678901234567890"), parseDecimal(t, calc, "2"))
+	if calc.Format(result) != "246913578024691357802469135780" {
+		t.Errorf("Expected 246913578024691357802469135780 but got %s", calc.Format(result))
+	}
+}
+
+func TestDecimalDivide(t *testing.T) {
+
+	calc := setupDecimalCalculator(t, 20)
+
+	result, err := calc.Divide(parseDecimal(t, calc, "1"), parseDecimal(t, calc, "3"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if calc.Format(result) != "0.33333333333333333333" {
+		t.Errorf("Expected 0.33333333333333333333 but got %s", calc.Format(result))
+	}
+}
+
+func TestDecimalDivideByZero(t *testing.T) {
+
+	calc := setupDecimalCalculator(t, 20)
+
+	_, err := calc.Divide(parseDecimal(t, calc, "1"), parseDecimal(t, calc, "0"))
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestDecimalModulo(t *testing.T) {
+
+	calc := setupDecimalCalculator(t, 30)
+
+	result, err := calc.Modulo(parseDecimal(t, calc, "87.3"), parseDecimal(t, calc, "5.5"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if calc.Format(result) != "4.8" {
+		t.Errorf("Expected 4.8 but got %s", calc.Format(result))
+	}
+
+	result, err = calc.Modulo(parseDecimal(t, calc, "-87"), parseDecimal(t, calc, "5"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if calc.Format(result) != "-2" {
+		t.Errorf("Expected -2 but got %s", calc.Format(result))
+	}
+}
+
+func TestDecimalModuloByZero(t *testing.T) {
+
+	calc := setupDecimalCalculator(t, 20)
+
+	_, err := calc.Modulo(parseDecimal(t, calc, "1"), parseDecimal(t, calc, "0"))
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestDecimalModuloHugeExponentGap(t *testing.T) {
+
+	calc := setupDecimalCalculator(t, 20)
+
+	// The integer part of the quotient would need about 2 billion bits
+	_, err := calc.Modulo(parseDecimal(t, calc, "1e300000000"), parseDecimal(t, calc, "1e-300000000"))
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Expected ErrOutOfRange but got %v", err)
+	}
+}
+
+func TestDecimalPower(t *testing.T) {
+
+	calc := setupDecimalCalculator(t, 40)
+
+	result, err := calc.Power(parseDecimal(t, calc, "2"), parseDecimal(t, calc, "100"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if calc.Format(result) != "1267650600228229401496703205376" {
+		t.Errorf("Expected 1267650600228229401496703205376 but got %s", calc.Format(result))
+	}
+
+	result, err = calc.Power(parseDecimal(t, calc, "5"), parseDecimal(t, calc, "-3"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if calc.Format(result) != "0.008" {
+		t.Errorf("Expected 0.008 but got %s", calc.Format(result))
+	}
+}
+
+func TestDecimalPowerFractionalExponent(t *testing.T) {
+
+	calc := setupDecimalCalculator(t, 20)
+
+	_, err := calc.Power(parseDecimal(t, calc, "2"), parseDecimal(t, calc, "0.5"))
+	if !errors.Is(err, ErrIntegerExponent) {
+		t.Errorf("Expected ErrIntegerExponent but got %v", err)
+	}
+}
+
+func TestDecimalInvalidDigits(t *testing.T) {
+
+	_, err := NewDecimalCalculator(0)
+	if !errors.Is(err, ErrInvalidDigits) {
+		t.Errorf("Expected ErrInvalidDigits but got %v", err)
+	}
+
+	_, err = NewDecimalCalculator(MaxDecimalDigits + 1)
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
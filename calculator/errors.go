@@ -0,0 +1,35 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the calculations in every precision mode. They can be checked with errors.Is, also when
+// returned from Evaluate. Undefined unary functions return a *DomainError and invalid expressions a *ParseError.
+var (
+	ErrDivideByZero        = errors.New("cannot divide by zero")
+	ErrModuloByZero        = errors.New("cannot modulo by zero")
+	ErrOutOfRange          = errors.New("result is out of range")
+	ErrIntegerExponent     = errors.New("power requires an integer exponent")
+	ErrExponentTooLarge    = errors.New("exponent is too large")
+	ErrZeroToNegativePower = errors.New("cannot raise zero to a negative power")
+	ErrInvalidOperand      = errors.New("invalid operand")
+	ErrInvalidDigits       = fmt.Errorf("digits must be between 1 and %d", MaxDecimalDigits)
+	ErrInvalidAngleMode    = errors.New("invalid angle mode")
+)
+
+// OperandError is returned when an operand cannot be parsed in a precision mode, e.g. "abc" as a decimal.
+// It matches ErrInvalidOperand with errors.Is.
+type OperandError struct {
+	Mode    string // "decimal", "rational" or "complex"
+	Operand string
+}
+
+func (err *OperandError) Error() string {
+	return fmt.Sprintf("invalid %s operand %q", err.Mode, err.Operand)
+}
+
+func (err *OperandError) Is(target error) bool {
+	return target == ErrInvalidOperand
+}
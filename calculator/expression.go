@@ -0,0 +1,348 @@
+package calculator
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+// ParseError is returned when an infix expression cannot be tokenized or parsed.
+// Column is the 1-based position (in characters) where the problem was found.
+type ParseError struct {
+	Column  int
+	Message string
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("%s at column %d", err.Message, err.Column)
+}
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenEnd
+)
+
+// token is a single lexical element of an expression together with the column it starts at.
+type token struct {
+	kind   tokenKind
+	text   string
+	value  float64
+	column int
+}
+
+// tokenize splits an infix expression into numbers, operators and parentheses.
+// Whitespace is ignored. The returned slice always ends with a tokenEnd token.
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+		character := runes[i]
+		column := i + 1
+
+		switch {
+		case unicode.IsSpace(character):
+			i++
+
+		case unicode.IsDigit(character) || character == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+
+			// Optional exponent, e.g. 1.5e-3
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				next := i + 1
+				if next < len(runes) && (runes[next] == '+' || runes[next] == '-') {
+					next++
+				}
+				if next < len(runes) && unicode.IsDigit(runes[next]) {
+					i = next
+					for i < len(runes) && unicode.IsDigit(runes[i]) {
+						i++
+					}
+				}
+			}
+
+			text := string(runes[start:i])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, &ParseError{Column: column, Message: fmt.Sprintf("invalid number %q", text)}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: value, column: column})
+
+		case character == '+' || character == '-' || character == '*' || character == '/' || character == '%' || character == '^':
+			tokens = append(tokens, token{kind: tokenOperator, text: string(character), column: column})
+			i++
+
+		case character == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", column: column})
+			i++
+
+		case character == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", column: column})
+			i++
+
+		default:
+			return nil, &ParseError{Column: column, Message: fmt.Sprintf("unexpected character %q", character)}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEnd, column: len(runes) + 1})
+	return tokens, nil
+}
+
+// Node is a node in the abstract syntax tree of a parsed expression.
+type Node interface {
+	// Evaluate computes the value of the node using the given calculator.
+	Evaluate(calc *Calculator) (float64, error)
+}
+
+// NumberNode is a numeric literal.
+type NumberNode struct {
+	Value float64
+}
+
+// UnaryNode is a prefix operator ("-" or "+") applied to an operand.
+type UnaryNode struct {
+	Operator string
+	Operand  Node
+}
+
+// BinaryNode is an infix operator applied to a left and right operand.
+type BinaryNode struct {
+	Operator string
+	Left     Node
+	Right    Node
+	Column   int // Position of the operator, used for error reporting
+}
+
+func (node *NumberNode) Evaluate(calc *Calculator) (float64, error) {
+	return node.Value, nil
+}
+
+func (node *UnaryNode) Evaluate(calc *Calculator) (float64, error) {
+	operand, err := node.Operand.Evaluate(calc)
+	if err != nil {
+		return 0, err
+	}
+
+	if node.Operator == "-" {
+		return calc.Subtract(0, operand), nil
+	}
+	return operand, nil
+}
+
+// Evaluate applies the operator using the corresponding Calculator method, so expressions share
+// the exact semantics (and errors) of the single operation endpoints.
+func (node *BinaryNode) Evaluate(calc *Calculator) (float64, error) {
+	left, err := node.Left.Evaluate(calc)
+	if err != nil {
+		return 0, err
+	}
+	right, err := node.Right.Evaluate(calc)
+	if err != nil {
+		return 0, err
+	}
+
+	switch node.Operator {
+	case "+":
+		return calc.Add(left, right), nil
+	case "-":
+		return calc.Subtract(left, right), nil
+	case "*":
+		return calc.Multiply(left, right), nil
+	case "/":
+		return calc.Divide(left, right)
+	case "%":
+		return calc.Modulo(left, right)
+	case "^":
+		return calc.Power(left, right), nil
+	}
+	return 0, fmt.Errorf("unknown operator %q", node.Operator)
+}
+
+// parser is a recursive descent parser implementing the grammar below. Each rule corresponds
+// to one precedence level, lowest first:
+//
+//	expression = term { ("+" | "-") term }
+//	term       = unary { ("*" | "/" | "%") unary }
+//	unary      = ("-" | "+") unary | power
+//	power      = primary [ "^" unary ]
+//	primary    = number | "(" expression ")"
+//
+// Power is right-associative and binds tighter than unary minus, so -2^2 = -4 and 2^3^2 = 512.
+type parser struct {
+	tokens   []token
+	position int
+	depth    int // Number of enclosing parentheses, unary signs and powers
+}
+
+// Deepest nesting of parentheses, unary signs and powers an expression may have. Each level recurses in the
+// parser, so without a limit a long input such as "((((...1))))" overflows the stack and crashes the process.
+const maxExpressionDepth = 256
+
+// Parse converts an infix expression into an abstract syntax tree.
+func Parse(expression string) (Node, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEnd {
+		return nil, &ParseError{Column: 1, Message: "empty expression"}
+	}
+
+	node, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything must be consumed, otherwise there is trailing input such as "1 2" or "(1))"
+	if next := p.peek(); next.kind != tokenEnd {
+		return nil, &ParseError{Column: next.column, Message: fmt.Sprintf("unexpected %q", next.text)}
+	}
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.position]
+}
+
+func (p *parser) next() token {
+	current := p.tokens[p.position]
+	if current.kind != tokenEnd {
+		p.position++
+	}
+	return current
+}
+
+// nested parses one level deeper, or returns an error if the expression is already nested maxExpressionDepth deep.
+// column is the position of the token that opens the level.
+func (p *parser) nested(column int, parse func() (Node, error)) (Node, error) {
+	if p.depth >= maxExpressionDepth {
+		return nil, &ParseError{Column: column, Message: "expression is nested too deeply"}
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	return parse()
+}
+
+// isOperator reports whether the next token is one of the given operators.
+func (p *parser) isOperator(operators ...string) bool {
+	current := p.peek()
+	if current.kind != tokenOperator {
+		return false
+	}
+	for _, operator := range operators {
+		if current.text == operator {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseExpression() (Node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("+", "-") {
+		operator := p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Operator: operator.text, Left: left, Right: right, Column: operator.column}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("*", "/", "%") {
+		operator := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Operator: operator.text, Left: left, Right: right, Column: operator.column}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.isOperator("-", "+") {
+		operator := p.next()
+		operand, err := p.nested(operator.column, p.parseUnary)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryNode{Operator: operator.text, Operand: operand}, nil
+	}
+	return p.parsePower()
+}
+
+func (p *parser) parsePower() (Node, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isOperator("^") {
+		operator := p.next()
+		exponent, err := p.nested(operator.column, p.parseUnary) // Recursing into unary makes "^" right-associative
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryNode{Operator: operator.text, Left: base, Right: exponent, Column: operator.column}, nil
+	}
+	return base, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	current := p.next()
+
+	switch current.kind {
+	case tokenNumber:
+		return &NumberNode{Value: current.value}, nil
+
+	case tokenLeftParen:
+		node, err := p.nested(current.column, p.parseExpression)
+		if err != nil {
+			return nil, err
+		}
+		closing := p.next()
+		if closing.kind != tokenRightParen {
+			return nil, &ParseError{Column: closing.column, Message: "expected \")\""}
+		}
+		return node, nil
+
+	case tokenEnd:
+		return nil, &ParseError{Column: current.column, Message: "unexpected end of expression"}
+	}
+
+	return nil, &ParseError{Column: current.column, Message: fmt.Sprintf("unexpected %q", current.text)}
+}
+
+// Evaluate parses and evaluates an infix expression such as "(3 + 4) * 2 ^ 5 % 7".
+// Parse errors are returned as *ParseError, while arithmetic errors (e.g. division by zero)
+// are returned exactly as the corresponding Calculator method reports them.
+func (calc *Calculator) Evaluate(expression string) (float64, error) {
+	node, err := Parse(expression)
+	if err != nil {
+		return 0, err
+	}
+	return node.Evaluate(calc)
+}
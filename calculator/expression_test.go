@@ -0,0 +1,206 @@
+package calculator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateSingleNumber(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Evaluate("42")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if result != 42 {
+		t.Errorf("Expected 42 but got %f", result)
+	}
+}
+
+func TestEvaluatePrecedence(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Evaluate("2 + 3 * 4")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if result != 14 {
+		t.Errorf("Expected 14 but got %f", result)
+	}
+}
+
+func TestEvaluateParentheses(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Evaluate("(2 + 3) * 4")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if result != 20 {
+		t.Errorf("Expected 20 but got %f", result)
+	}
+}
+
+func TestEvaluateMixedOperators(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	// 2 ^ 5 = 32, 7 * 32 = 224, 224 % 7 = 0
+	result, err := calc.Evaluate("(3 + 4) * 2 ^ 5 % 7")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if result != 0 {
+		t.Errorf("Expected 0 but got %f", result)
+	}
+}
+
+func TestEvaluateLeftAssociativeSubtraction(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Evaluate("10 - 4 - 3")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if result != 3 {
+		t.Errorf("Expected 3 but got %f", result)
+	}
+}
+
+func TestEvaluateRightAssociativePower(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Evaluate("2 ^ 3 ^ 2")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if result != 512 {
+		t.Errorf("Expected 512 but got %f", result)
+	}
+}
+
+func TestEvaluateUnaryMinus(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	// Power binds tighter than unary minus
+	result, err := calc.Evaluate("-2 ^ 2")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if result != -4 {
+		t.Errorf("Expected -4 but got %f", result)
+	}
+
+	result, err = calc.Evaluate("2 ^ -1")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if result != 0.5 {
+		t.Errorf("Expected 0.5 but got %f", result)
+	}
+}
+
+func TestEvaluateDecimalsAndExponents(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Evaluate("1.5e2 / .5")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if result != 300 {
+		t.Errorf("Expected 300 but got %f", result)
+	}
+}
+
+func TestEvaluateDivideByZero(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	_, err := calc.Evaluate("1 / (2 - 2)")
+	if !errors.Is(err, ErrDivideByZero) || err.Error() != "cannot divide by zero" {
+		t.Errorf("Expected divide by zero error but got %v", err)
+	}
+}
+
+func TestEvaluateModuloByZero(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	_, err := calc.Evaluate("5 % 0")
+	if !errors.Is(err, ErrModuloByZero) || err.Error() != "cannot modulo by zero" {
+		t.Errorf("Expected modulo by zero error but got %v", err)
+	}
+}
+
+func TestEvaluateParseErrors(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	tests := []struct {
+		expression string
+		column     int
+	}{
+		{"", 1},
+		{"1 +", 4},
+		{"(1 + 2", 7},
+		{"1 + 2)", 6},
+		{"1 $ 2", 3},
+		{"1 2", 3},
+		{"* 2", 1},
+		{"1.2.3", 1},
+	}
+
+	for _, test := range tests {
+		_, err := calc.Evaluate(test.expression)
+
+		var parseError *ParseError
+		if !errors.As(err, &parseError) {
+			t.Errorf("Expected ParseError for %q but got %v", test.expression, err)
+			continue
+		}
+		if parseError.Column != test.column {
+			t.Errorf("Expected column %d for %q but got %d (%s)", test.column, test.expression, parseError.Column, parseError)
+		}
+	}
+}
+
+func TestEvaluateNestedTooDeeply(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	tests := []struct {
+		expression string
+		column     int
+	}{
+		{strings.Repeat("(", 600000) + "1" + strings.Repeat(")", 600000), maxExpressionDepth + 1},
+		{strings.Repeat("-", 600000) + "1", maxExpressionDepth + 1},
+		{"2" + strings.Repeat("^2", 600000), 2*maxExpressionDepth + 2},
+	}
+
+	for _, test := range tests {
+		_, err := calc.Evaluate(test.expression)
+
+		var parseError *ParseError
+		if !errors.As(err, &parseError) || parseError.Message != "expression is nested too deeply" {
+			t.Errorf("Expected nesting ParseError but got %v", err)
+			continue
+		}
+		if parseError.Column != test.column {
+			t.Errorf("Expected column %d but got %d", test.column, parseError.Column)
+		}
+	}
+
+	// Nesting up to the limit is allowed
+	result, err := calc.Evaluate(strings.Repeat("(", maxExpressionDepth) + "1" + strings.Repeat(")", maxExpressionDepth))
+	if err != nil || result != 1 {
+		t.Errorf("Expected 1 but got %v (%v)", result, err)
+	}
+}
@@ -0,0 +1,149 @@
+package calculator
+
+import (
+	"math"
+	"math/big"
+)
+
+// builtinOperations describes the operations every Calculator supports. Additional operations can be
+// added with calc.Registry().Register before the routes are registered.
+func (calc *Calculator) builtinOperations() []Operation {
+	return []Operation{
+		{
+			Name: "Add", Symbol: "+", Arity: Binary,
+			Description: "Adds two numbers",
+			Function:    BinaryFunction(calc.Add),
+			Decimal: func(decimal *DecimalCalculator, operands []*big.Float) (*big.Float, error) {
+				return decimal.Add(operands[0], operands[1]), nil
+			},
+			Rational: func(rational *RationalCalculator, operands []*big.Rat) (*big.Rat, error) {
+				return rational.Add(operands[0], operands[1]), nil
+			},
+			Complex: func(complexCalc *ComplexCalculator, operands []complex128) (complex128, error) {
+				return complexCalc.Add(operands[0], operands[1]), nil
+			},
+		},
+		{
+			Name: "Subtract", Symbol: "-", Arity: Binary,
+			Description: "Subtracts the second operand from the first",
+			Function:    BinaryFunction(calc.Subtract),
+			Decimal: func(decimal *DecimalCalculator, operands []*big.Float) (*big.Float, error) {
+				return decimal.Subtract(operands[0], operands[1]), nil
+			},
+			Rational: func(rational *RationalCalculator, operands []*big.Rat) (*big.Rat, error) {
+				return rational.Subtract(operands[0], operands[1]), nil
+			},
+			Complex: func(complexCalc *ComplexCalculator, operands []complex128) (complex128, error) {
+				return complexCalc.Subtract(operands[0], operands[1]), nil
+			},
+		},
+		{
+			Name: "Multiply", Symbol: "*", Arity: Binary,
+			Description: "Multiplies two numbers",
+			Function:    BinaryFunction(calc.Multiply),
+			Decimal: func(decimal *DecimalCalculator, operands []*big.Float) (*big.Float, error) {
+				return decimal.Multiply(operands[0], operands[1]), nil
+			},
+			Rational: func(rational *RationalCalculator, operands []*big.Rat) (*big.Rat, error) {
+				return rational.Multiply(operands[0], operands[1]), nil
+			},
+			Complex: func(complexCalc *ComplexCalculator, operands []complex128) (complex128, error) {
+				return complexCalc.Multiply(operands[0], operands[1]), nil
+			},
+		},
+		{
+			Name: "Divide", Symbol: "/", Arity: Binary, CanFail: true,
+			Description: "Divides the first operand by the second",
+			Function:    BinaryFunctionWithError(calc.Divide),
+			Decimal: func(decimal *DecimalCalculator, operands []*big.Float) (*big.Float, error) {
+				return decimal.Divide(operands[0], operands[1])
+			},
+			Rational: func(rational *RationalCalculator, operands []*big.Rat) (*big.Rat, error) {
+				return rational.Divide(operands[0], operands[1])
+			},
+			Complex: func(complexCalc *ComplexCalculator, operands []complex128) (complex128, error) {
+				return complexCalc.Divide(operands[0], operands[1])
+			},
+		},
+		{
+			Name: "Modulo", Symbol: "%", Arity: Binary, CanFail: true,
+			Description: "Returns the remainder of division",
+			Function:    BinaryFunctionWithError(calc.Modulo),
+			Decimal: func(decimal *DecimalCalculator, operands []*big.Float) (*big.Float, error) {
+				return decimal.Modulo(operands[0], operands[1])
+			},
+			Rational: func(rational *RationalCalculator, operands []*big.Rat) (*big.Rat, error) {
+				return rational.Modulo(operands[0], operands[1])
+			},
+		},
+		{
+			Name: "Power", Symbol: "^", Arity: Binary,
+			Description: "Raises the first operand to the power of the second",
+			Function:    BinaryFunction(calc.Power),
+			Decimal: func(decimal *DecimalCalculator, operands []*big.Float) (*big.Float, error) {
+				return decimal.Power(operands[0], operands[1])
+			},
+			Rational: func(rational *RationalCalculator, operands []*big.Rat) (*big.Rat, error) {
+				return rational.Power(operands[0], operands[1])
+			},
+			Complex: func(complexCalc *ComplexCalculator, operands []complex128) (complex128, error) {
+				return complexCalc.Power(operands[0], operands[1]), nil
+			},
+		},
+		{
+			Name: "Sqrt", Symbol: "sqrt", Arity: Unary, CanFail: true,
+			Description: "Square root (principal complex root in complex mode)",
+			Function:    UnaryFunctionWithError(calc.Sqrt),
+			Complex: func(complexCalc *ComplexCalculator, operands []complex128) (complex128, error) {
+				return complexCalc.Sqrt(operands[0]), nil
+			},
+		},
+		{
+			Name: "Abs", Symbol: "abs", Arity: Unary,
+			Description: "Absolute value, or modulus of a complex number",
+			Function:    UnaryFunctionWithError(calc.Abs),
+			Complex: func(complexCalc *ComplexCalculator, operands []complex128) (complex128, error) {
+				return complex(complexCalc.Abs(operands[0]), 0), nil
+			},
+		},
+		{
+			Name: "Arg", Symbol: "arg", Arity: Unary,
+			Description: "Argument (phase angle in radians) of a complex number",
+			Function: UnaryFunctionWithError(func(operand float64) (float64, error) {
+				return math.Atan2(0, operand), nil // 0 for positive and π for negative real numbers
+			}),
+			Complex: func(complexCalc *ComplexCalculator, operands []complex128) (complex128, error) {
+				return complex(complexCalc.Arg(operands[0]), 0), nil
+			},
+		},
+		{
+			Name: "Conj", Symbol: "conj", Arity: Unary,
+			Description: "Complex conjugate",
+			Function: UnaryFunctionWithError(func(operand float64) (float64, error) {
+				return operand, nil // A real number is its own conjugate
+			}),
+			Complex: func(complexCalc *ComplexCalculator, operands []complex128) (complex128, error) {
+				return complexCalc.Conj(operands[0]), nil
+			},
+		},
+		{Name: "Ln", Symbol: "ln", Arity: Unary, CanFail: true, Description: "Natural logarithm", Function: UnaryFunctionWithError(calc.Ln)},
+		{Name: "Log10", Symbol: "log10", Arity: Unary, CanFail: true, Description: "Base 10 logarithm", Function: UnaryFunctionWithError(calc.Log10)},
+		{Name: "Exp", Symbol: "exp", Arity: Unary, CanFail: true, Description: "Exponential function", Function: UnaryFunctionWithError(calc.Exp)},
+		{Name: "Sin", Symbol: "sin", Arity: Unary, UsesAngle: true, Description: "Sine", Function: AngleFunction(calc.Sin)},
+		{Name: "Cos", Symbol: "cos", Arity: Unary, UsesAngle: true, Description: "Cosine", Function: AngleFunction(calc.Cos)},
+		{Name: "Tan", Symbol: "tan", Arity: Unary, UsesAngle: true, CanFail: true, Description: "Tangent", Function: AngleFunction(calc.Tan)},
+		{Name: "Asin", Symbol: "asin", Arity: Unary, UsesAngle: true, CanFail: true, Description: "Arcsine", Function: AngleFunction(calc.Asin)},
+		{Name: "Acos", Symbol: "acos", Arity: Unary, UsesAngle: true, CanFail: true, Description: "Arccosine", Function: AngleFunction(calc.Acos)},
+		{Name: "Atan", Symbol: "atan", Arity: Unary, UsesAngle: true, Description: "Arctangent", Function: AngleFunction(calc.Atan)},
+		{Name: "Sinh", Symbol: "sinh", Arity: Unary, CanFail: true, Description: "Hyperbolic sine", Function: UnaryFunctionWithError(calc.Sinh)},
+		{Name: "Cosh", Symbol: "cosh", Arity: Unary, CanFail: true, Description: "Hyperbolic cosine", Function: UnaryFunctionWithError(calc.Cosh)},
+		{Name: "Tanh", Symbol: "tanh", Arity: Unary, Description: "Hyperbolic tangent", Function: UnaryFunctionWithError(calc.Tanh)},
+		{Name: "Asinh", Symbol: "asinh", Arity: Unary, Description: "Inverse hyperbolic sine", Function: UnaryFunctionWithError(calc.Asinh)},
+		{Name: "Acosh", Symbol: "acosh", Arity: Unary, CanFail: true, Description: "Inverse hyperbolic cosine", Function: UnaryFunctionWithError(calc.Acosh)},
+		{Name: "Atanh", Symbol: "atanh", Arity: Unary, CanFail: true, Description: "Inverse hyperbolic tangent", Function: UnaryFunctionWithError(calc.Atanh)},
+		{Name: "Floor", Symbol: "floor", Arity: Unary, Description: "Rounds down to an integer", Function: UnaryFunctionWithError(calc.Floor)},
+		{Name: "Ceil", Symbol: "ceil", Arity: Unary, Description: "Rounds up to an integer", Function: UnaryFunctionWithError(calc.Ceil)},
+		{Name: "Factorial", Symbol: "factorial", Arity: Unary, CanFail: true, Description: "Factorial of a non-negative integer", Function: UnaryFunctionWithError(calc.Factorial)},
+		{Name: "Gamma", Symbol: "gamma", Arity: Unary, CanFail: true, Description: "Gamma function", Function: UnaryFunctionWithError(calc.Gamma)},
+	}
+}
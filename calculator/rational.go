@@ -0,0 +1,160 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	ApproximationDecimals      = 20      // Fractional digits in the decimal approximation of a rational result
+	MaxRationalExponent        = 10000   // Exact powers grow quickly, so the exponent is bounded
+	MaxRationalPowerBits       = 1 << 20 // Bound of the size of an exact power, as a large base grows it just as quickly
+	MaxRationalOperandLength   = 1000    // Characters of an operand, so every operation works on numbers of bounded size
+	MaxRationalOperandExponent = 1000    // Bound of the exponent of an operand such as "1e1000", as it is expanded exactly
+)
+
+// RationalCalculator performs the arithmetic operations exactly on fractions using big.Rat,
+// so 1/3 + 1/6 gives 1/2 rather than 0.5000000001. Results are always in lowest terms.
+type RationalCalculator struct {
+}
+
+func NewRationalCalculator() *RationalCalculator {
+	return &RationalCalculator{}
+}
+
+// Parse converts a fraction such as "3/4", an integer or a decimal such as "0.75" to a big.Rat.
+// Operands longer than MaxRationalOperandLength or with an exponent beyond MaxRationalOperandExponent
+// return ErrOutOfRange, as "1e999999" alone would expand to millions of digits.
+func (calc *RationalCalculator) Parse(operand string) (*big.Rat, error) {
+	text := strings.TrimSpace(operand)
+	if len(text) > MaxRationalOperandLength {
+		return nil, ErrOutOfRange
+	}
+	if exponent := rationalExponent(text); exponent > MaxRationalOperandExponent || exponent < -MaxRationalOperandExponent {
+		return nil, ErrOutOfRange
+	}
+
+	value, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, &OperandError{Mode: "rational", Operand: operand}
+	}
+	return value, nil
+}
+
+// Helper function to read the exponent of a number such as "1.5e-3" or "0x1p4" without computing the number.
+// Hexadecimal mantissas may contain "e" as a digit, so only "p" starts their exponent. Numbers without a valid
+// exponent return 0 and are left to big.Rat.SetString to accept or reject.
+func rationalExponent(text string) int64 {
+	mantissa := strings.ToLower(strings.TrimLeft(text, "+-"))
+	markers := "eEpP"
+	if strings.HasPrefix(mantissa, "0x") {
+		markers = "pP"
+	}
+
+	index := strings.LastIndexAny(text, markers)
+	if index < 0 {
+		return 0
+	}
+	// Exponents that overflow int64 are returned as the largest int64 of their sign
+	exponent, err := strconv.ParseInt(text[index+1:], 10, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0
+	}
+	return exponent
+}
+
+// Format returns the reduced fraction, e.g. "1/2", or just the numerator for whole numbers.
+func (calc *RationalCalculator) Format(value *big.Rat) string {
+	return value.RatString()
+}
+
+// Approximate returns the decimal approximation of the value with at most ApproximationDecimals
+// fractional digits and without trailing zeros, e.g. "0.5" or "0.33333333333333333333".
+func (calc *RationalCalculator) Approximate(value *big.Rat) string {
+	text := value.FloatString(ApproximationDecimals)
+	text = strings.TrimRight(text, "0")
+	text = strings.TrimSuffix(text, ".")
+	if text == "-0" {
+		return "0"
+	}
+	return text
+}
+
+// Add takes two rational operands and returns their sum.
+func (calc *RationalCalculator) Add(operand1 *big.Rat, operand2 *big.Rat) *big.Rat {
+	return new(big.Rat).Add(operand1, operand2)
+}
+
+// Subtract takes two rational operands and returns their difference.
+func (calc *RationalCalculator) Subtract(operand1 *big.Rat, operand2 *big.Rat) *big.Rat {
+	return new(big.Rat).Sub(operand1, operand2)
+}
+
+// Multiply takes two rational operands and returns their product.
+func (calc *RationalCalculator) Multiply(operand1 *big.Rat, operand2 *big.Rat) *big.Rat {
+	return new(big.Rat).Mul(operand1, operand2)
+}
+
+// Divide takes two rational operands and returns their quotient.
+// If dividing by zero, the function returns an error.
+func (calc *RationalCalculator) Divide(operand1 *big.Rat, operand2 *big.Rat) (*big.Rat, error) {
+
+	if operand2.Sign() == 0 {
+		return nil, ErrDivideByZero
+	}
+
+	return new(big.Rat).Quo(operand1, operand2), nil
+}
+
+// Modulo takes two rational operands and returns the remainder of the truncated division.
+// Like math.Mod, the result has the sign of operand1. If modulo by zero, the function returns an error.
+func (calc *RationalCalculator) Modulo(operand1 *big.Rat, operand2 *big.Rat) (*big.Rat, error) {
+
+	if operand2.Sign() == 0 {
+		return nil, ErrModuloByZero
+	}
+
+	quotient := new(big.Rat).Quo(operand1, operand2)
+	truncated := new(big.Int).Quo(quotient.Num(), quotient.Denom()) // big.Int.Quo truncates towards zero
+
+	product := new(big.Rat).Mul(new(big.Rat).SetInt(truncated), operand2)
+	return new(big.Rat).Sub(operand1, product), nil
+}
+
+// Power raises operand1 to the integer power operand2. A fractional exponent would in general
+// give an irrational result, so it returns an error, as does zero raised to a negative power.
+func (calc *RationalCalculator) Power(operand1 *big.Rat, operand2 *big.Rat) (*big.Rat, error) {
+
+	if !operand2.IsInt() {
+		return nil, fmt.Errorf("rational %w", ErrIntegerExponent)
+	}
+
+	exponent := new(big.Int).Set(operand2.Num())
+	if exponent.CmpAbs(big.NewInt(MaxRationalExponent)) > 0 {
+		return nil, ErrExponentTooLarge
+	}
+
+	if exponent.Sign() < 0 && operand1.Sign() == 0 {
+		return nil, ErrZeroToNegativePower
+	}
+
+	negative := exponent.Sign() < 0
+	exponent.Abs(exponent)
+
+	// The power has about as many bits as the base times the exponent, so it is checked before computing it
+	baseBits := int64(operand1.Num().BitLen() + operand1.Denom().BitLen())
+	if baseBits*exponent.Int64() > MaxRationalPowerBits {
+		return nil, ErrOutOfRange
+	}
+
+	numerator := new(big.Int).Exp(operand1.Num(), exponent, nil)
+	denominator := new(big.Int).Exp(operand1.Denom(), exponent, nil)
+
+	if negative {
+		numerator, denominator = denominator, numerator
+	}
+	return new(big.Rat).SetFrac(numerator, denominator), nil
+}
@@ -0,0 +1,200 @@
+package calculator
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func parseRational(t *testing.T, calc *RationalCalculator, operand string) *big.Rat {
+	value, err := calc.Parse(operand)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	return value
+}
+
+func TestRationalAdd(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	result := calc.Add(parseRational(t, calc, "1/3"), parseRational(t, calc, "1/6"))
+	if calc.Format(result) != "1/2" {
+		t.Errorf("Expected 1/2 but got %s", calc.Format(result))
+	}
+	if calc.Approximate(result) != "0.5" {
+		t.Errorf("Expected 0.5 but got %s", calc.Approximate(result))
+	}
+}
+
+func TestRationalSubtractToWholeNumber(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	result := calc.Subtract(parseRational(t, calc, "7/2"), parseRational(t, calc, "1/2"))
+	if calc.Format(result) != "3" {
+		t.Errorf("Expected 3 but got %s", calc.Format(result))
+	}
+}
+
+func TestRationalMultiplyDecimalOperand(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	result := calc.Multiply(parseRational(t, calc, "0.75"), parseRational(t, calc, "-2/3"))
+	if calc.Format(result) != "-1/2" {
+		t.Errorf("Expected -1/2 but got %s", calc.Format(result))
+	}
+}
+
+func TestRationalDivide(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	result, err := calc.Divide(parseRational(t, calc, "1"), parseRational(t, calc, "3"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if calc.Format(result) != "1/3" {
+		t.Errorf("Expected 1/3 but got %s", calc.Format(result))
+	}
+	if calc.Approximate(result) != "0.33333333333333333333" {
+		t.Errorf("Expected 0.33333333333333333333 but got %s", calc.Approximate(result))
+	}
+}
+
+func TestRationalDivideByZero(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	_, err := calc.Divide(parseRational(t, calc, "1/2"), parseRational(t, calc, "0"))
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestRationalModulo(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	// 7/2 = 2 * 3/2 + 1/2
+	result, err := calc.Modulo(parseRational(t, calc, "7/2"), parseRational(t, calc, "3/2"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if calc.Format(result) != "1/2" {
+		t.Errorf("Expected 1/2 but got %s", calc.Format(result))
+	}
+
+	result, err = calc.Modulo(parseRational(t, calc, "-87"), parseRational(t, calc, "5"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if calc.Format(result) != "-2" {
+		t.Errorf("Expected -2 but got %s", calc.Format(result))
+	}
+}
+
+func TestRationalModuloByZero(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	_, err := calc.Modulo(parseRational(t, calc, "1/2"), parseRational(t, calc, "0"))
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestRationalPower(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	result, err := calc.Power(parseRational(t, calc, "2/3"), parseRational(t, calc, "3"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if calc.Format(result) != "8/27" {
+		t.Errorf("Expected 8/27 but got %s", calc.Format(result))
+	}
+
+	result, err = calc.Power(parseRational(t, calc, "-2/3"), parseRational(t, calc, "-3"))
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if calc.Format(result) != "-27/8" {
+		t.Errorf("Expected -27/8 but got %s", calc.Format(result))
+	}
+}
+
+func TestRationalPowerResultTooLarge(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	// The exponent is allowed, but the base has 1000 digits, so the power would have 10 million
+	_, err := calc.Power(parseRational(t, calc, "1"+strings.Repeat("0", 999)), parseRational(t, calc, "10000"))
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Expected ErrOutOfRange but got %v", err)
+	}
+
+	_, err = calc.Power(parseRational(t, calc, "1/"+strings.Repeat("7", 998)), parseRational(t, calc, "-10000"))
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Expected ErrOutOfRange but got %v", err)
+	}
+}
+
+func TestRationalPowerFractionalExponent(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	_, err := calc.Power(parseRational(t, calc, "2"), parseRational(t, calc, "1/2"))
+	if !errors.Is(err, ErrIntegerExponent) {
+		t.Errorf("Expected ErrIntegerExponent but got %v", err)
+	}
+}
+
+func TestRationalPowerZeroToNegative(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	_, err := calc.Power(parseRational(t, calc, "0"), parseRational(t, calc, "-1"))
+	if !errors.Is(err, ErrZeroToNegativePower) {
+		t.Errorf("Expected ErrZeroToNegativePower but got %v", err)
+	}
+}
+
+func TestRationalParseInvalid(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	for _, operand := range []string{"", "1/0", "abc", "1/2/3"} {
+		_, err := calc.Parse(operand)
+		if !errors.Is(err, ErrInvalidOperand) {
+			t.Errorf("Expected ErrInvalidOperand for %q but got %v", operand, err)
+		}
+	}
+}
+
+func TestRationalParseTooLarge(t *testing.T) {
+
+	calc := NewRationalCalculator()
+
+	operands := []string{
+		"1e999999", "1e-999999", "-1E1001", "1p999999", "0x1p-1001", "1e99999999999999999999",
+		strings.Repeat("9", MaxRationalOperandLength+1), "1/" + strings.Repeat("3", MaxRationalOperandLength),
+	}
+	for _, operand := range operands {
+		_, err := calc.Parse(operand)
+		if !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("Expected ErrOutOfRange for %.20q but got %v", operand, err)
+		}
+	}
+
+	// Operands at the bounds, and hexadecimal digits that look like an exponent, are accepted
+	operands = []string{"1e1000", "-2.5e-1000", "0x1p1000", "0x1e99999", strings.Repeat("9", MaxRationalOperandLength)}
+	for _, operand := range operands {
+		if _, err := calc.Parse(operand); err != nil {
+			t.Errorf("Expected nil for %.20q but got %v", operand, err)
+		}
+	}
+}
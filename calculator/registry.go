@@ -0,0 +1,153 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Arity is the number of operands an operation takes.
+type Arity int
+
+const (
+	Unary  Arity = 1
+	Binary Arity = 2
+)
+
+// OperationFunc computes an operation on float64 operands. The operands slice always has the length of the
+// operation's arity. The angle mode is only relevant for operations with UsesAngle set.
+type OperationFunc func(operands []float64, mode AngleMode) (float64, error)
+
+// Functions implementing an operation in one of the exact modes
+type DecimalFunc func(calc *DecimalCalculator, operands []*big.Float) (*big.Float, error)
+type RationalFunc func(calc *RationalCalculator, operands []*big.Rat) (*big.Rat, error)
+type ComplexFunc func(calc *ComplexCalculator, operands []complex128) (complex128, error)
+
+// Operation describes a calculator operation. Everything that exposes operations (routes, the history
+// formatter and the /operations endpoint) is driven by these descriptions.
+type Operation struct {
+	Name        string // Used in history and, in lower case, as the route, e.g. "Add" is served at /add
+	Symbol      string // Symbol used when formatting, e.g. "+" or "sqrt"
+	Arity       Arity
+	Description string
+	CanFail     bool // Whether Function may return an error, e.g. division by zero or a domain error
+	UsesAngle   bool // Whether the operation depends on the angle mode (trigonometric functions)
+	Function    OperationFunc
+
+	// Optional implementations in the exact modes. A nil function means the mode is not supported.
+	Decimal  DecimalFunc
+	Rational RationalFunc
+	Complex  ComplexFunc
+}
+
+// Route returns the path the operation is served at, e.g. "/add".
+func (operation Operation) Route() string {
+	return "/" + strings.ToLower(operation.Name)
+}
+
+// Operation names must be a single path segment, as they are served at their route
+var validOperationName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// Lower case names of the routes the API serves besides the operations, which operations cannot be named
+var reservedOperationNames = map[string]bool{
+	"login": true, "register": true, "logout": true, "token": true, "operations": true, "evaluate": true,
+	"batch": true, "history": true, "admin": true, "openapi": true,
+}
+
+// Registry holds the available operations in registration order. It is safe for concurrent use.
+type Registry struct {
+	mutex      sync.RWMutex
+	operations map[string]Operation // Keyed by lower case name
+	order      []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		operations: make(map[string]Operation),
+	}
+}
+
+// Register adds an operation to the registry. Names are case-insensitive and must be unique, start with a letter
+// and only contain letters and digits, and must not be the name of another route of the API, e.g. "Login".
+func (registry *Registry) Register(operation Operation) error {
+
+	if operation.Name == "" {
+		return errors.New("operation name is required")
+	}
+	if !validOperationName.MatchString(operation.Name) {
+		return fmt.Errorf("operation %q: name must start with a letter and only contain letters and digits", operation.Name)
+	}
+	if reservedOperationNames[strings.ToLower(operation.Name)] {
+		return fmt.Errorf("operation %s: name is reserved for another route", operation.Name)
+	}
+	if operation.Arity != Unary && operation.Arity != Binary {
+		return fmt.Errorf("operation %s: arity must be 1 or 2", operation.Name)
+	}
+	if operation.Function == nil {
+		return fmt.Errorf("operation %s: function is required", operation.Name)
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	key := strings.ToLower(operation.Name)
+	if _, exists := registry.operations[key]; exists {
+		return fmt.Errorf("operation %s is already registered", operation.Name)
+	}
+
+	registry.operations[key] = operation
+	registry.order = append(registry.order, key)
+	return nil
+}
+
+// Lookup returns the operation with the given (case-insensitive) name.
+func (registry *Registry) Lookup(name string) (Operation, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	operation, found := registry.operations[strings.ToLower(name)]
+	return operation, found
+}
+
+// Operations returns all registered operations in registration order.
+func (registry *Registry) Operations() []Operation {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	operations := make([]Operation, 0, len(registry.order))
+	for _, key := range registry.order {
+		operations = append(operations, registry.operations[key])
+	}
+	return operations
+}
+
+// BinaryFunction adapts a binary function that cannot fail, such as Calculator.Add, to an OperationFunc.
+func BinaryFunction(function func(a, b float64) float64) OperationFunc {
+	return func(operands []float64, mode AngleMode) (float64, error) {
+		return function(operands[0], operands[1]), nil
+	}
+}
+
+// BinaryFunctionWithError adapts a binary function that may fail, such as Calculator.Divide, to an OperationFunc.
+func BinaryFunctionWithError(function func(a, b float64) (float64, error)) OperationFunc {
+	return func(operands []float64, mode AngleMode) (float64, error) {
+		return function(operands[0], operands[1])
+	}
+}
+
+// UnaryFunctionWithError adapts a unary function, such as Calculator.Ln, to an OperationFunc.
+func UnaryFunctionWithError(function func(a float64) (float64, error)) OperationFunc {
+	return func(operands []float64, mode AngleMode) (float64, error) {
+		return function(operands[0])
+	}
+}
+
+// AngleFunction adapts a trigonometric function, such as Calculator.Sin, to an OperationFunc.
+func AngleFunction(function func(a float64, mode AngleMode) (float64, error)) OperationFunc {
+	return func(operands []float64, mode AngleMode) (float64, error) {
+		return function(operands[0], mode)
+	}
+}
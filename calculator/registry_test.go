@@ -0,0 +1,102 @@
+package calculator
+
+import (
+	"testing"
+)
+
+func TestRegistryContainsBuiltinOperations(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	operations := calc.Registry().Operations()
+	if len(operations) == 0 || operations[0].Name != "Add" {
+		t.Fatalf("Expected Add as the first operation but got %+v", operations)
+	}
+
+	for _, name := range []string{"Add", "Subtract", "Multiply", "Divide", "Modulo", "Power", "Sqrt", "Sin", "Factorial"} {
+		if _, found := calc.Registry().Lookup(name); !found {
+			t.Errorf("Expected %s to be registered", name)
+		}
+	}
+}
+
+func TestRegistryLookupIsCaseInsensitive(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	operation, found := calc.Registry().Lookup("divide")
+	if !found {
+		t.Fatal("Expected divide to be found")
+	}
+	if operation.Symbol != "/" || operation.Route() != "/divide" || !operation.CanFail {
+		t.Errorf("Unexpected operation %+v", operation)
+	}
+
+	_, err := operation.Function([]float64{1, 0}, Radians)
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestRegistryRegisterCustomOperation(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	err := calc.Registry().Register(Operation{
+		Name:        "Hypot",
+		Symbol:      "hypot",
+		Arity:       Binary,
+		Description: "Length of the hypotenuse",
+		Function: BinaryFunction(func(a, b float64) float64 {
+			result, _ := calc.Sqrt(a*a + b*b)
+			return result
+		}),
+	})
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	operation, found := calc.Registry().Lookup("Hypot")
+	if !found {
+		t.Fatal("Expected Hypot to be found")
+	}
+
+	result, err := operation.Function([]float64{3, 4}, Radians)
+	if err != nil || result != 5 {
+		t.Errorf("Expected 5 but got %f (%v)", result, err)
+	}
+
+	operations := calc.Registry().Operations()
+	if operations[len(operations)-1].Name != "Hypot" {
+		t.Errorf("Expected Hypot to be the last operation")
+	}
+}
+
+func TestRegistryRejectsInvalidOperations(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+	identity := UnaryFunctionWithError(func(a float64) (float64, error) { return a, nil })
+
+	invalid := []Operation{
+		{Name: "", Arity: Unary, Function: identity},
+		{Name: "Ternary", Arity: 3, Function: identity},
+		{Name: "NoFunction", Arity: Unary},
+		{Name: "ADD", Arity: Binary, Function: identity},  // Duplicate of the built-in Add
+		{Name: "Login", Arity: Unary, Function: identity}, // Reserved for the routes of the API
+		{Name: "batch", Arity: Unary, Function: identity},
+		{Name: "History", Arity: Unary, Function: identity},
+		{Name: "Operations", Arity: Unary, Function: identity},
+		{Name: "Evaluate", Arity: Unary, Function: identity},
+		{Name: "Two Words", Arity: Unary, Function: identity}, // Not a single path segment
+		{Name: "a/b", Arity: Unary, Function: identity},
+		{Name: "{x}", Arity: Unary, Function: identity},
+		{Name: "1st", Arity: Unary, Function: identity},
+	}
+
+	for _, operation := range invalid {
+		err := calc.Registry().Register(operation)
+		if err == nil {
+			t.Errorf("Expected error for %+v but got nil", operation)
+		}
+	}
+}
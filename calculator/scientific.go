@@ -0,0 +1,224 @@
+package calculator
+
+import (
+	"fmt"
+	"math"
+)
+
+// DomainError is returned when a unary function is undefined for its operand, e.g. the logarithm of a negative number.
+type DomainError struct {
+	Operation string
+	Operand   float64
+	Reason    string
+}
+
+func (err *DomainError) Error() string {
+	return fmt.Sprintf("%s is undefined for %g: %s", err.Operation, err.Operand, err.Reason)
+}
+
+// AngleMode selects whether trigonometric functions work in radians or degrees.
+type AngleMode string
+
+const (
+	Radians AngleMode = "radians"
+	Degrees AngleMode = "degrees"
+)
+
+// ParseAngleMode converts "radians" or "degrees" to an AngleMode. An empty string defaults to radians.
+func ParseAngleMode(mode string) (AngleMode, error) {
+	switch AngleMode(mode) {
+	case "", Radians:
+		return Radians, nil
+	case Degrees:
+		return Degrees, nil
+	}
+	return "", ErrInvalidAngleMode
+}
+
+// toRadians converts an input angle to radians
+func (mode AngleMode) toRadians(angle float64) float64 {
+	if mode == Degrees {
+		return angle * math.Pi / 180
+	}
+	return angle
+}
+
+// fromRadians converts a resulting angle from radians
+func (mode AngleMode) fromRadians(angle float64) float64 {
+	if mode == Degrees {
+		return angle * 180 / math.Pi
+	}
+	return angle
+}
+
+// checkResult returns an error if a finite operand produced an infinite result, e.g. exp(1000).
+func checkResult(result float64) (float64, error) {
+	if math.IsInf(result, 0) {
+		return 0, ErrOutOfRange
+	}
+	return result, nil
+}
+
+// Sqrt returns the square root of a non-negative operand.
+func (calc *Calculator) Sqrt(operand float64) (float64, error) {
+	if operand < 0 {
+		return 0, &DomainError{Operation: "sqrt", Operand: operand, Reason: "operand must not be negative"}
+	}
+	return math.Sqrt(operand), nil
+}
+
+// Ln returns the natural logarithm of a positive operand.
+func (calc *Calculator) Ln(operand float64) (float64, error) {
+	if operand <= 0 {
+		return 0, &DomainError{Operation: "ln", Operand: operand, Reason: "operand must be positive"}
+	}
+	return math.Log(operand), nil
+}
+
+// Log10 returns the base 10 logarithm of a positive operand.
+func (calc *Calculator) Log10(operand float64) (float64, error) {
+	if operand <= 0 {
+		return 0, &DomainError{Operation: "log10", Operand: operand, Reason: "operand must be positive"}
+	}
+	return math.Log10(operand), nil
+}
+
+// Exp returns e raised to the operand.
+func (calc *Calculator) Exp(operand float64) (float64, error) {
+	return checkResult(math.Exp(operand))
+}
+
+// Sin returns the sine of an angle given in the angle mode.
+// Multiples of 90 degrees give exact results, e.g. sin(180°) = 0 rather than 1.2e-16.
+func (calc *Calculator) Sin(operand float64, mode AngleMode) (float64, error) {
+	if mode == Degrees && math.Mod(operand, 90) == 0 {
+		return []float64{0, 1, 0, -1}[quadrant(operand)], nil
+	}
+	return math.Sin(mode.toRadians(operand)), nil
+}
+
+// Cos returns the cosine of an angle given in the angle mode.
+func (calc *Calculator) Cos(operand float64, mode AngleMode) (float64, error) {
+	if mode == Degrees && math.Mod(operand, 90) == 0 {
+		return []float64{1, 0, -1, 0}[quadrant(operand)], nil
+	}
+	return math.Cos(mode.toRadians(operand)), nil
+}
+
+// Tan returns the tangent of an angle given in the angle mode. In degrees, odd multiples
+// of 90° are reported as a domain error. In radians they cannot be represented exactly.
+func (calc *Calculator) Tan(operand float64, mode AngleMode) (float64, error) {
+	if mode == Degrees && math.Mod(operand, 90) == 0 {
+		if quadrant(operand)%2 == 1 {
+			return 0, &DomainError{Operation: "tan", Operand: operand, Reason: "operand must not be an odd multiple of 90 degrees"}
+		}
+		return 0, nil
+	}
+	return math.Tan(mode.toRadians(operand)), nil
+}
+
+// quadrant returns which multiple of 90 degrees (0-3) the angle is, for angles that are multiples of 90.
+func quadrant(degrees float64) int {
+	quadrant := int(math.Mod(degrees/90, 4))
+	if quadrant < 0 {
+		quadrant += 4
+	}
+	return quadrant
+}
+
+// Asin returns the arcsine of an operand in [-1, 1] as an angle in the angle mode.
+func (calc *Calculator) Asin(operand float64, mode AngleMode) (float64, error) {
+	if operand < -1 || operand > 1 {
+		return 0, &DomainError{Operation: "asin", Operand: operand, Reason: "operand must be between -1 and 1"}
+	}
+	return mode.fromRadians(math.Asin(operand)), nil
+}
+
+// Acos returns the arccosine of an operand in [-1, 1] as an angle in the angle mode.
+func (calc *Calculator) Acos(operand float64, mode AngleMode) (float64, error) {
+	if operand < -1 || operand > 1 {
+		return 0, &DomainError{Operation: "acos", Operand: operand, Reason: "operand must be between -1 and 1"}
+	}
+	return mode.fromRadians(math.Acos(operand)), nil
+}
+
+// Atan returns the arctangent of the operand as an angle in the angle mode.
+func (calc *Calculator) Atan(operand float64, mode AngleMode) (float64, error) {
+	return mode.fromRadians(math.Atan(operand)), nil
+}
+
+// Sinh returns the hyperbolic sine of the operand.
+func (calc *Calculator) Sinh(operand float64) (float64, error) {
+	return checkResult(math.Sinh(operand))
+}
+
+// Cosh returns the hyperbolic cosine of the operand.
+func (calc *Calculator) Cosh(operand float64) (float64, error) {
+	return checkResult(math.Cosh(operand))
+}
+
+// Tanh returns the hyperbolic tangent of the operand.
+func (calc *Calculator) Tanh(operand float64) (float64, error) {
+	return math.Tanh(operand), nil
+}
+
+// Asinh returns the inverse hyperbolic sine of the operand.
+func (calc *Calculator) Asinh(operand float64) (float64, error) {
+	return math.Asinh(operand), nil
+}
+
+// Acosh returns the inverse hyperbolic cosine of an operand greater than or equal to 1.
+func (calc *Calculator) Acosh(operand float64) (float64, error) {
+	if operand < 1 {
+		return 0, &DomainError{Operation: "acosh", Operand: operand, Reason: "operand must be at least 1"}
+	}
+	return math.Acosh(operand), nil
+}
+
+// Atanh returns the inverse hyperbolic tangent of an operand strictly between -1 and 1.
+func (calc *Calculator) Atanh(operand float64) (float64, error) {
+	if operand <= -1 || operand >= 1 {
+		return 0, &DomainError{Operation: "atanh", Operand: operand, Reason: "operand must be strictly between -1 and 1"}
+	}
+	return math.Atanh(operand), nil
+}
+
+// Floor returns the greatest integer less than or equal to the operand.
+func (calc *Calculator) Floor(operand float64) (float64, error) {
+	return math.Floor(operand), nil
+}
+
+// Ceil returns the least integer greater than or equal to the operand.
+func (calc *Calculator) Ceil(operand float64) (float64, error) {
+	return math.Ceil(operand), nil
+}
+
+// Abs returns the absolute value of the operand.
+func (calc *Calculator) Abs(operand float64) (float64, error) {
+	return math.Abs(operand), nil
+}
+
+// Factorial returns n! for a non-negative integer operand. 170! is the largest factorial that fits in a float64.
+func (calc *Calculator) Factorial(operand float64) (float64, error) {
+	if operand < 0 || operand != math.Trunc(operand) {
+		return 0, &DomainError{Operation: "factorial", Operand: operand, Reason: "operand must be a non-negative integer"}
+	}
+	if operand > 170 {
+		return 0, ErrOutOfRange
+	}
+
+	result := 1.0
+	for i := 2.0; i <= operand; i++ {
+		result *= i
+	}
+	return result, nil
+}
+
+// Gamma returns the gamma function of the operand, which extends the factorial: Gamma(n) = (n-1)!.
+// It is undefined for zero and the negative integers.
+func (calc *Calculator) Gamma(operand float64) (float64, error) {
+	if operand <= 0 && operand == math.Trunc(operand) {
+		return 0, &DomainError{Operation: "gamma", Operand: operand, Reason: "operand must not be zero or a negative integer"}
+	}
+	return checkResult(math.Gamma(operand))
+}
@@ -0,0 +1,262 @@
+package calculator
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// Adjust with a small epsilon to account for floating point imprecision
+const scientificEpsilon = 0.00001
+
+func TestSqrt(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Sqrt(16)
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if result != 4 {
+		t.Errorf("Expected 4 but got %f", result)
+	}
+}
+
+func TestSqrtNegativeIsDomainError(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	_, err := calc.Sqrt(-1)
+	var domainError *DomainError
+	if !errors.As(err, &domainError) {
+		t.Errorf("Expected DomainError but got %v", err)
+	}
+}
+
+func TestLogarithms(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Ln(math.E)
+	if err != nil || math.Abs(result-1) > scientificEpsilon {
+		t.Errorf("Expected 1 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Log10(1000)
+	if err != nil || result != 3 {
+		t.Errorf("Expected 3 but got %f (%v)", result, err)
+	}
+
+	for _, operand := range []float64{0, -1} {
+		_, err = calc.Ln(operand)
+		if err == nil {
+			t.Errorf("Expected error for ln(%f) but got nil", operand)
+		}
+		_, err = calc.Log10(operand)
+		if err == nil {
+			t.Errorf("Expected error for log10(%f) but got nil", operand)
+		}
+	}
+}
+
+func TestExpOutOfRange(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	_, err := calc.Exp(1000)
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestTrigonometryRadians(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Sin(math.Pi/2, Radians)
+	if err != nil || math.Abs(result-1) > scientificEpsilon {
+		t.Errorf("Expected 1 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Cos(math.Pi, Radians)
+	if err != nil || math.Abs(result+1) > scientificEpsilon {
+		t.Errorf("Expected -1 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Tan(math.Pi/4, Radians)
+	if err != nil || math.Abs(result-1) > scientificEpsilon {
+		t.Errorf("Expected 1 but got %f (%v)", result, err)
+	}
+}
+
+func TestTrigonometryDegreesIsExact(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, _ := calc.Sin(180, Degrees)
+	if result != 0 {
+		t.Errorf("Expected 0 but got %g", result)
+	}
+
+	result, _ = calc.Cos(-90, Degrees)
+	if result != 0 {
+		t.Errorf("Expected 0 but got %g", result)
+	}
+
+	result, _ = calc.Sin(-90, Degrees)
+	if result != -1 {
+		t.Errorf("Expected -1 but got %g", result)
+	}
+
+	result, err := calc.Sin(30, Degrees)
+	if err != nil || math.Abs(result-0.5) > scientificEpsilon {
+		t.Errorf("Expected 0.5 but got %f (%v)", result, err)
+	}
+}
+
+func TestTanNinetyDegreesIsDomainError(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	_, err := calc.Tan(270, Degrees)
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+
+	result, err := calc.Tan(180, Degrees)
+	if err != nil || result != 0 {
+		t.Errorf("Expected 0 but got %f (%v)", result, err)
+	}
+}
+
+func TestInverseTrigonometry(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Asin(1, Degrees)
+	if err != nil || math.Abs(result-90) > scientificEpsilon {
+		t.Errorf("Expected 90 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Acos(1, Radians)
+	if err != nil || result != 0 {
+		t.Errorf("Expected 0 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Atan(1, Degrees)
+	if err != nil || math.Abs(result-45) > scientificEpsilon {
+		t.Errorf("Expected 45 but got %f (%v)", result, err)
+	}
+
+	_, err = calc.Asin(2, Radians)
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+
+	_, err = calc.Acos(-1.5, Radians)
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestHyperbolic(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Sinh(0)
+	if err != nil || result != 0 {
+		t.Errorf("Expected 0 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Cosh(0)
+	if err != nil || result != 1 {
+		t.Errorf("Expected 1 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Tanh(0)
+	if err != nil || result != 0 {
+		t.Errorf("Expected 0 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Asinh(0)
+	if err != nil || result != 0 {
+		t.Errorf("Expected 0 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Acosh(1)
+	if err != nil || result != 0 {
+		t.Errorf("Expected 0 but got %f (%v)", result, err)
+	}
+
+	_, err = calc.Acosh(0.5)
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+
+	_, err = calc.Atanh(1)
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestRounding(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, _ := calc.Floor(-2.5)
+	if result != -3 {
+		t.Errorf("Expected -3 but got %f", result)
+	}
+
+	result, _ = calc.Ceil(-2.5)
+	if result != -2 {
+		t.Errorf("Expected -2 but got %f", result)
+	}
+
+	result, _ = calc.Abs(-2.5)
+	if result != 2.5 {
+		t.Errorf("Expected 2.5 but got %f", result)
+	}
+}
+
+func TestFactorial(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Factorial(0)
+	if err != nil || result != 1 {
+		t.Errorf("Expected 1 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Factorial(10)
+	if err != nil || result != 3628800 {
+		t.Errorf("Expected 3628800 but got %f (%v)", result, err)
+	}
+
+	for _, operand := range []float64{-1, 2.5, 171} {
+		_, err = calc.Factorial(operand)
+		if err == nil {
+			t.Errorf("Expected error for %f! but got nil", operand)
+		}
+	}
+}
+
+func TestGamma(t *testing.T) {
+
+	calc := setupCalculatorWithLocalStorage()
+
+	result, err := calc.Gamma(5)
+	if err != nil || math.Abs(result-24) > scientificEpsilon {
+		t.Errorf("Expected 24 but got %f (%v)", result, err)
+	}
+
+	result, err = calc.Gamma(0.5)
+	if err != nil || math.Abs(result-math.Sqrt(math.Pi)) > scientificEpsilon {
+		t.Errorf("Expected √π but got %f (%v)", result, err)
+	}
+
+	_, err = calc.Gamma(-2)
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
@@ -1,37 +1,90 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"overengineered_calculator/api"
 	"overengineered_calculator/calculator"
 	"overengineered_calculator/setup"
-	"overengineered_calculator/storage"
+	"syscall"
+	"time"
 )
 
 func main() {
 
-	// Initialize Firestore
-	firestoreClient, err := setup.InitFirestoreEmulator()
+	// Subcommands run instead of the server, e.g. "verify", see runVerify and runRole
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerify(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		os.Exit(runRole(os.Args[2:]))
+	}
+
+	// Initialize the storage backend selected by the environment, see setup.LoadConfig
+	config, err := setup.LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	calculatorStorage, closeStorage, err := setup.InitStorage(config)
 	if err != nil {
-		log.Fatalf("Firestore initialization failed: %v", err)
+		log.Fatalf("Storage initialization failed: %v", err)
 	}
-	defer firestoreClient.Close()
+	defer closeStorage()
 
-	// Initialize Calculator with Firestore storage for API
-	firestoreStorage := storage.NewFirestoreStorage(firestoreClient)
+	// Load the token signing keys, falling back to a random key for development
+	options := []api.Option{api.WithPasswordPolicy(config.PasswordPolicy)}
+	keys, err := setup.InitKeys(config)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if keys != nil {
+		options = append(options, api.WithKeySet(keys))
+	} else {
+		fmt.Println("Warning: neither JWT_KEYS_FILE nor JWT_SECRET is set, tokens are signed with a random key")
+	}
+
+	// Initialize Calculator with the storage for API
 	calc := calculator.NewCalculator()
-	api := api.NewAPI(calc, firestoreStorage)
+	api := api.NewAPI(calc, calculatorStorage, options...)
 
 	// Create HTTP request multiplexer
 	multiplexer := http.NewServeMux()
 	api.RegisterRoutes(multiplexer)
 	handlerWithCors := setup.EnableCORS(multiplexer)
 
+	// The context is cancelled on SIGINT or SIGTERM. Every request context derives from it, so in-flight
+	// storage operations are cancelled on shutdown instead of running until their deadline.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:        ":8080",
+		Handler:     handlerWithCors,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	// Shut down gracefully, waiting for in-flight requests before main returns
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		fmt.Println("Shutting down server...")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
 	fmt.Println("Starting server on :8080...")
-	err = http.ListenAndServe(":8080", handlerWithCors)
-	if err != nil {
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
+	<-shutdownDone
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"overengineered_calculator/setup"
+	"overengineered_calculator/storage"
+	"strings"
+)
+
+// runRole implements the role subcommand, which sets the role of a user with the storage backend from the
+// environment, like the server. It is how the first admin is made, as only admins can manage other users.
+// The new role applies when the user next logs in or refreshes their token.
+//
+//	overengineered_calculator role -user alice -role admin
+func runRole(args []string) int {
+	flags := flag.NewFlagSet("role", flag.ContinueOnError)
+	user := flags.String("user", "", "user whose role is set (required)")
+	role := flags.String("role", "", "new role: "+strings.Join(storage.Roles, ", ")+" (required)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *user == "" || *role == "" {
+		fmt.Fprintln(os.Stderr, "role needs a -user and a -role")
+		flags.Usage()
+		return 2
+	}
+
+	config, err := setup.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 2
+	}
+	calculatorStorage, closeStorage, err := setup.InitStorage(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Storage initialization failed: %v\n", err)
+		return 2
+	}
+	defer closeStorage()
+
+	err = calculatorStorage.SetUserRole(context.Background(), *user, *role)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not set the role: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s now has the role %s\n", *user, *role)
+	return 0
+}
@@ -70,8 +70,9 @@ func InitFirestoreEmulator() (*firestore.Client, error) {
 func EnableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		writer.Header().Set("Access-Control-Allow-Origin", "*")
-		writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+		writer.Header().Set("Access-Control-Expose-Headers", "Deprecation, Sunset, Link")
 
 		if request.Method == "OPTIONS" {
 			writer.WriteHeader(http.StatusOK)
@@ -0,0 +1,37 @@
+package storage_test
+
+import (
+	"overengineered_calculator/storage"
+	"overengineered_calculator/storage/storagetest"
+	"testing"
+)
+
+func TestLocalStorageConformance(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.Storage {
+		return storage.NewLocalStorage()
+	})
+}
+
+func TestSQLiteStorageConformance(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.Storage {
+		return storage.SetupSQLiteStorage(t)
+	})
+}
+
+func TestPostgresStorageConformance(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.Storage {
+		return storage.SetupPostgresStorage(t)
+	})
+}
+
+func TestFirestoreStorageConformance(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.Storage {
+		return storage.SetupFirestoreStorage(t)
+	})
+}
+
+func TestDeadlineStorageConformance(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.Storage {
+		return storage.WithDeadlines(storage.NewLocalStorage(), storage.DefaultDeadlines())
+	})
+}
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Deadlines holds the maximum duration of each storage operation. A zero duration means no deadline
+// other than the one of the caller's context.
+type Deadlines struct {
+	SaveOperation    time.Duration // Also used for SaveOperations
+	GetHistory       time.Duration // Also used for QueryHistory
+	ResetHistory     time.Duration
+	RegisterUser     time.Duration
+	AuthenticateUser time.Duration
+	Users            time.Duration // Used for GetUser, ListUsers and SetUserRole
+	Tokens           time.Duration // Used for the refresh tokens, the revoked access tokens and the API keys
+}
+
+// DefaultDeadlines returns a deadline of 5 seconds for every operation.
+func DefaultDeadlines() Deadlines {
+	return Deadlines{
+		SaveOperation:    5 * time.Second,
+		GetHistory:       5 * time.Second,
+		ResetHistory:     5 * time.Second,
+		RegisterUser:     5 * time.Second,
+		AuthenticateUser: 5 * time.Second,
+		Users:            5 * time.Second,
+		Tokens:           5 * time.Second,
+	}
+}
+
+// deadlineStorage applies per-operation deadlines to another storage and reports exceeded deadlines as ErrTimeout.
+type deadlineStorage struct {
+	storage   Storage
+	deadlines Deadlines
+}
+
+// WithDeadlines wraps the storage so every operation runs with its deadline from deadlines. The caller's
+// context is still respected, so a cancelled request cancels the operation as well.
+func WithDeadlines(storage Storage, deadlines Deadlines) Storage {
+	return &deadlineStorage{
+		storage:   storage,
+		deadlines: deadlines,
+	}
+}
+
+// Helper function to derive the context of an operation with the given deadline
+func withDeadline(ctx context.Context, deadline time.Duration) (context.Context, context.CancelFunc) {
+	if deadline <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, deadline)
+}
+
+func (storage *deadlineStorage) SaveOperation(ctx context.Context, entry HistoryEntry) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.SaveOperation)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.SaveOperation(ctx, entry))
+}
+
+func (storage *deadlineStorage) SaveOperations(ctx context.Context, entries []HistoryEntry) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.SaveOperation)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.SaveOperations(ctx, entries))
+}
+
+func (storage *deadlineStorage) GetHistory(ctx context.Context, owner string) ([]HistoryEntry, error) {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.GetHistory)
+	defer cancel()
+
+	history, err := storage.storage.GetHistory(ctx, owner)
+	return history, wrapTimeout(ctx, err)
+}
+
+func (storage *deadlineStorage) QueryHistory(ctx context.Context, query HistoryQuery) (HistoryPage, error) {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.GetHistory)
+	defer cancel()
+
+	page, err := storage.storage.QueryHistory(ctx, query)
+	return page, wrapTimeout(ctx, err)
+}
+
+func (storage *deadlineStorage) ResetHistory(ctx context.Context, owner string) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.ResetHistory)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.ResetHistory(ctx, owner))
+}
+
+func (storage *deadlineStorage) RegisterUser(ctx context.Context, username string, password string) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.RegisterUser)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.RegisterUser(ctx, username, password))
+}
+
+func (storage *deadlineStorage) AuthenticateUser(ctx context.Context, username string, password string) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.AuthenticateUser)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.AuthenticateUser(ctx, username, password))
+}
+
+func (storage *deadlineStorage) GetUser(ctx context.Context, username string) (User, error) {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Users)
+	defer cancel()
+
+	user, err := storage.storage.GetUser(ctx, username)
+	return user, wrapTimeout(ctx, err)
+}
+
+func (storage *deadlineStorage) ListUsers(ctx context.Context) ([]User, error) {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Users)
+	defer cancel()
+
+	users, err := storage.storage.ListUsers(ctx)
+	return users, wrapTimeout(ctx, err)
+}
+
+func (storage *deadlineStorage) SetUserRole(ctx context.Context, username string, role string) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Users)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.SetUserRole(ctx, username, role))
+}
+
+func (storage *deadlineStorage) SaveRefreshToken(ctx context.Context, token RefreshToken) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.SaveRefreshToken(ctx, token))
+}
+
+func (storage *deadlineStorage) GetRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	token, err := storage.storage.GetRefreshToken(ctx, id)
+	return token, wrapTimeout(ctx, err)
+}
+
+func (storage *deadlineStorage) UseRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	token, err := storage.storage.UseRefreshToken(ctx, id)
+	return token, wrapTimeout(ctx, err)
+}
+
+func (storage *deadlineStorage) RevokeRefreshTokens(ctx context.Context, family string) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.RevokeRefreshTokens(ctx, family))
+}
+
+func (storage *deadlineStorage) RevokeAccessToken(ctx context.Context, id string, expiresAt time.Time) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.RevokeAccessToken(ctx, id, expiresAt))
+}
+
+func (storage *deadlineStorage) IsAccessTokenRevoked(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	revoked, err := storage.storage.IsAccessTokenRevoked(ctx, id)
+	return revoked, wrapTimeout(ctx, err)
+}
+
+func (storage *deadlineStorage) CreateAPIKey(ctx context.Context, key APIKey) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.CreateAPIKey(ctx, key))
+}
+
+func (storage *deadlineStorage) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	key, err := storage.storage.GetAPIKey(ctx, id)
+	return key, wrapTimeout(ctx, err)
+}
+
+func (storage *deadlineStorage) ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	keys, err := storage.storage.ListAPIKeys(ctx, owner)
+	return keys, wrapTimeout(ctx, err)
+}
+
+func (storage *deadlineStorage) DeleteAPIKey(ctx context.Context, owner string, id string) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.DeleteAPIKey(ctx, owner, id))
+}
+
+func (storage *deadlineStorage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	ctx, cancel := withDeadline(ctx, storage.deadlines.Tokens)
+	defer cancel()
+
+	return wrapTimeout(ctx, storage.storage.TouchAPIKey(ctx, id, usedAt))
+}
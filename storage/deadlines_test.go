@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Storage that blocks every operation until its context is done, like a database that does not respond
+type blockingStorage struct{}
+
+func (storage blockingStorage) SaveOperation(ctx context.Context, entry HistoryEntry) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) SaveOperations(ctx context.Context, entries []HistoryEntry) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) GetHistory(ctx context.Context, owner string) ([]HistoryEntry, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (storage blockingStorage) QueryHistory(ctx context.Context, query HistoryQuery) (HistoryPage, error) {
+	<-ctx.Done()
+	return HistoryPage{}, ctx.Err()
+}
+
+func (storage blockingStorage) ResetHistory(ctx context.Context, owner string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) RegisterUser(ctx context.Context, username string, password string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) AuthenticateUser(ctx context.Context, username string, password string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) GetUser(ctx context.Context, username string) (User, error) {
+	<-ctx.Done()
+	return User{}, ctx.Err()
+}
+
+func (storage blockingStorage) ListUsers(ctx context.Context) ([]User, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (storage blockingStorage) SetUserRole(ctx context.Context, username string, role string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) SaveRefreshToken(ctx context.Context, token RefreshToken) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) GetRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+	<-ctx.Done()
+	return RefreshToken{}, ctx.Err()
+}
+
+func (storage blockingStorage) UseRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+	<-ctx.Done()
+	return RefreshToken{}, ctx.Err()
+}
+
+func (storage blockingStorage) RevokeRefreshTokens(ctx context.Context, family string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) RevokeAccessToken(ctx context.Context, id string, expiresAt time.Time) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) IsAccessTokenRevoked(ctx context.Context, id string) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func (storage blockingStorage) CreateAPIKey(ctx context.Context, key APIKey) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+	<-ctx.Done()
+	return APIKey{}, ctx.Err()
+}
+
+func (storage blockingStorage) ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (storage blockingStorage) DeleteAPIKey(ctx context.Context, owner string, id string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (storage blockingStorage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWithDeadlinesReturnsTimeout(t *testing.T) {
+	storage := WithDeadlines(blockingStorage{}, Deadlines{GetHistory: 10 * time.Millisecond})
+
+	_, err := storage.GetHistory(context.Background(), "alice")
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout but got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the error to wrap context.DeadlineExceeded but got %v", err)
+	}
+}
+
+func TestWithDeadlinesUsesDeadlinePerOperation(t *testing.T) {
+	storage := WithDeadlines(blockingStorage{}, Deadlines{
+		SaveOperation: 10 * time.Millisecond,
+		ResetHistory:  time.Hour,
+	})
+
+	err := storage.SaveOperation(context.Background(), HistoryEntry{})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout but got %v", err)
+	}
+
+	// The long deadline of ResetHistory must not apply, so cancelling the caller's context ends the operation
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = storage.ResetHistory(ctx, "alice")
+	if err == nil || time.Since(start) > time.Minute {
+		t.Errorf("Expected the operation to stop with the caller's context but got %v", err)
+	}
+}
+
+func TestWithDeadlinesPropagatesCancellation(t *testing.T) {
+	storage := WithDeadlines(blockingStorage{}, DefaultDeadlines())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	// A cancelled request, e.g. a client that disconnected, is not a timeout
+	err := storage.AuthenticateUser(ctx, "alice", "secret")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+	if errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected a cancellation not to be reported as ErrTimeout")
+	}
+}
+
+func TestWithDeadlinesKeepsOtherErrors(t *testing.T) {
+	storage := WithDeadlines(NewLocalStorage(), DefaultDeadlines())
+
+	storage.RegisterUser(context.Background(), "alice", "secret")
+	err := storage.RegisterUser(context.Background(), "alice", "secret")
+	if !errors.Is(err, ErrConflict) || errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrConflict but got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// General kinds of storage errors. Callers check them with errors.Is, e.g. errors.Is(err, storage.ErrConflict).
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	ErrTimeout  = errors.New("storage operation timed out")
+)
+
+// Specific errors returned by the backends. They wrap one of the general kinds above.
+var (
+	ErrUserExists   = &storageError{message: "user already exists", kind: ErrConflict}
+	ErrUserNotFound = &storageError{message: "user not found", kind: ErrNotFound}
+
+	ErrTokenNotFound = &storageError{message: "token not found", kind: ErrNotFound}
+	ErrTokenUsed     = &storageError{message: "token already used", kind: ErrConflict}
+
+	ErrAPIKeyNotFound = &storageError{message: "API key not found", kind: ErrNotFound}
+
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidRole        = errors.New("invalid role")
+)
+
+// storageError is an error with its own message that is also of a general kind
+type storageError struct {
+	message string
+	kind    error
+}
+
+func (err *storageError) Error() string {
+	return err.message
+}
+
+func (err *storageError) Unwrap() error {
+	return err.kind
+}
+
+// timeoutError is returned when an operation exceeded its deadline. It wraps both ErrTimeout and the
+// backend's error, so errors.Is(err, context.DeadlineExceeded) keeps working.
+type timeoutError struct {
+	err error
+}
+
+func (err *timeoutError) Error() string {
+	return ErrTimeout.Error() + ": " + err.err.Error()
+}
+
+func (err *timeoutError) Unwrap() []error {
+	return []error{ErrTimeout, err.err}
+}
+
+// Helper function to turn an error caused by an exceeded deadline of ctx into an ErrTimeout. Backends report
+// deadlines differently (e.g. Firestore returns a gRPC status), so the context itself is checked.
+func wrapTimeout(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(err, ErrTimeout) {
+		return &timeoutError{err: err}
+	}
+	return err
+}
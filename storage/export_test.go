@@ -0,0 +1,8 @@
+package storage
+
+// Exported for the conformance tests in the storage_test package, which cannot access unexported identifiers
+var (
+	SetupSQLiteStorage    = setupSQLiteStorage
+	SetupPostgresStorage  = setupPostgresStorage
+	SetupFirestoreStorage = setupFirestoreStorage
+)
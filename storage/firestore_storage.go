@@ -2,11 +2,14 @@ package storage
 
 import (
 	"context"
-	"errors"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // FirestoreStorage is used to store history in a Firestore database.
@@ -20,63 +23,171 @@ func NewFirestoreStorage(client *firestore.Client) *FirestoreStorage {
 	}
 }
 
-// Save the history entry to Firestore database
-func (storage *FirestoreStorage) SaveOperation(entry HistoryEntry) error {
+// Largest number of writes Firestore accepts in a single commit
+const firestoreMaxWrites = 500
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// Save the history entry to Firestore database
+func (storage *FirestoreStorage) SaveOperation(ctx context.Context, entry HistoryEntry) error {
 
-	_, _, err := storage.client.Collection("calculations").Add(ctx, map[string]interface{}{
-		"operand1":  entry.Operand1,
-		"operand2":  entry.Operand2,
-		"operation": entry.Operation,
-		"result":    entry.Result,
-		"timestamp": entry.Timestamp,
-	})
+	_, _, err := storage.client.Collection("calculations").Add(ctx, firestoreHistoryData(entry))
 	return err
 }
 
-// The function GetHistory retrieves the history of calculations from the Firestore database sorted by newest operations
-// first. It returns a slice of HistoryEntry structs.
-func (storage *FirestoreStorage) GetHistory() ([]HistoryEntry, error) {
+// Save the history entries to Firestore database. The entries are written in a single transaction, unless
+// there are more than Firestore accepts in one commit, in which case each chunk is written in its own transaction.
+func (storage *FirestoreStorage) SaveOperations(ctx context.Context, entries []HistoryEntry) error {
 
-	var history []HistoryEntry
+	collection := storage.client.Collection("calculations")
+	for start := 0; start < len(entries); start += firestoreMaxWrites {
+		chunk := entries[start:min(start+firestoreMaxWrites, len(entries))]
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+		// The document references are created outside the transaction, so a retried transaction
+		// writes the same documents instead of duplicating them
+		refs := make([]*firestore.DocumentRef, len(chunk))
+		for i := range chunk {
+			refs[i] = collection.NewDoc()
+		}
 
-	// Query the Firestore database by "timestamp". Probably add pagination given a real application
-	iter := storage.client.Collection("calculations").OrderBy("timestamp", firestore.Desc).Documents(ctx)
+		err := storage.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			for i, entry := range chunk {
+				if err := tx.Create(refs[i], firestoreHistoryData(entry)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper function to convert a history entry to the fields of its Firestore document
+func firestoreHistoryData(entry HistoryEntry) map[string]interface{} {
+	return map[string]interface{}{
+		"operand1":   entry.Operand1,
+		"operand2":   entry.Operand2,
+		"operation":  entry.Operation,
+		"result":     entry.Result,
+		"timestamp":  entry.Timestamp,
+		"owner":      entry.Owner,
+		"expression": entry.Expression,
+		"angleMode":  entry.AngleMode,
+
+		"mode":          entry.Mode,
+		"exactOperand1": entry.ExactOperand1,
+		"exactOperand2": entry.ExactOperand2,
+		"exactResult":   entry.ExactResult,
+	}
+}
 
+// The function GetHistory retrieves the owner's history of calculations from the Firestore database sorted by newest
+// operations first. It returns a slice of HistoryEntry structs. Use QueryHistory to read the history in pages.
+func (storage *FirestoreStorage) GetHistory(ctx context.Context, owner string) ([]HistoryEntry, error) {
+
+	// Filtering on owner while ordering by timestamp uses the composite index in firestore.indexes.json.
+	iter := storage.client.Collection("calculations").
+		Where("owner", "==", owner).
+		OrderBy("timestamp", firestore.Desc).
+		OrderBy(firestore.DocumentID, firestore.Desc).
+		Documents(ctx)
+
+	return readFirestoreHistory(iter)
+}
+
+// Query a page of the owner's history from the Firestore database. Filtering on operations and ranges while
+// sorting requires the composite indexes in firestore.indexes.json.
+func (storage *FirestoreStorage) QueryHistory(ctx context.Context, query HistoryQuery) (HistoryPage, error) {
+
+	query, err := normalizeHistoryQuery(query)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	cursor, err := decodePageToken(query)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+
+	firestoreQuery := storage.client.Collection("calculations").Where("owner", "==", query.Owner)
+	if len(query.Operations) > 0 {
+		firestoreQuery = firestoreQuery.Where("operation", "in", query.Operations)
+	}
+	if !query.From.IsZero() {
+		firestoreQuery = firestoreQuery.Where("timestamp", ">=", query.From)
+	}
+	if !query.To.IsZero() {
+		firestoreQuery = firestoreQuery.Where("timestamp", "<", query.To)
+	}
+	if query.MinResult != nil {
+		firestoreQuery = firestoreQuery.Where("result", ">=", *query.MinResult)
+	}
+	if query.MaxResult != nil {
+		firestoreQuery = firestoreQuery.Where("result", "<=", *query.MaxResult)
+	}
+
+	direction := firestore.Desc
+	if query.Ascending {
+		direction = firestore.Asc
+	}
+	firestoreQuery = firestoreQuery.
+		OrderBy(string(query.SortBy), direction).
+		OrderBy(firestore.DocumentID, direction)
+
+	// Continue after the last entry of the previous page. Ties on the sort field are broken by the document ID.
+	if cursor != nil {
+		var value interface{} = cursor.Timestamp
+		if query.SortBy == SortByResult {
+			value = cursor.Result
+		}
+		firestoreQuery = firestoreQuery.StartAfter(value, cursor.ID)
+	}
+
+	entries, err := readFirestoreHistory(firestoreQuery.Limit(query.Limit + 1).Documents(ctx))
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	return newHistoryPage(query, entries), nil
+}
+
+// Helper function to read the history entries of a query, using the document IDs as entry IDs
+func readFirestoreHistory(iter *firestore.DocumentIterator) ([]HistoryEntry, error) {
+	defer iter.Stop()
+
+	history := []HistoryEntry{}
 	for {
 		document, err := iter.Next()
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			return nil, err
+		}
 
 		var entry HistoryEntry
 		err = document.DataTo(&entry)
 		if err != nil {
 			return nil, err
 		}
+		entry.ID = document.Ref.ID
 		history = append(history, entry)
 	}
 
 	return history, nil
 }
 
-// Reset the history in the Firestore database
-func (storage *FirestoreStorage) ResetHistory() error {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// Reset the owner's history in the Firestore database
+func (storage *FirestoreStorage) ResetHistory(ctx context.Context, owner string) error {
 
-	iter := storage.client.Collection("calculations").Documents(ctx)
+	iter := storage.client.Collection("calculations").Where("owner", "==", owner).Documents(ctx)
 	for {
 		doc, err := iter.Next()
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			return err
+		}
 		_, err = doc.Ref.Delete(ctx)
 		if err != nil {
 			return err
@@ -86,10 +197,7 @@ func (storage *FirestoreStorage) ResetHistory() error {
 }
 
 // RegisterUser stores the username and hashed password in Firestore.
-func (storage *FirestoreStorage) RegisterUser(username string, password string) error {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (storage *FirestoreStorage) RegisterUser(ctx context.Context, username string, password string) error {
 
 	// Hash the password
 	hashedPassword, err := hashPassword(password)
@@ -97,18 +205,17 @@ func (storage *FirestoreStorage) RegisterUser(username string, password string)
 		return err
 	}
 
-	// Check if the user already exists
+	// Store the username and hash of the password. Create fails if the document already exists,
+	// so two concurrent registrations of the same username cannot both succeed.
 	docRef := storage.client.Collection("users").Doc(username)
-	doc, err := docRef.Get(ctx)
-	if err == nil && doc.Exists() {
-		return errors.New("user already exists")
-	}
-
-	// Store the username and hash of the password
-	_, err = docRef.Set(ctx, map[string]interface{}{
+	_, err = docRef.Create(ctx, map[string]interface{}{
 		"username": username,
 		"password": hashedPassword,
+		"role":     RoleUser,
 	})
+	if status.Code(err) == codes.AlreadyExists {
+		return ErrUserExists
+	}
 	if err != nil {
 		return err
 	}
@@ -117,17 +224,17 @@ func (storage *FirestoreStorage) RegisterUser(username string, password string)
 }
 
 // AuthenticateUser retrieves the stored hashed password and checks it against the hash of the provided password.
-func (storage *FirestoreStorage) AuthenticateUser(username string, password string) error {
-
-	// Create context with a 5 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (storage *FirestoreStorage) AuthenticateUser(ctx context.Context, username string, password string) error {
 
 	// Retrieve the user from Firestore
 	docRef := storage.client.Collection("users").Doc(username)
 	doc, err := docRef.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		checkPasswordHash(password, dummyPasswordHash())
+		return ErrUserNotFound
+	}
 	if err != nil {
-		return errors.New("user not found")
+		return err
 	}
 
 	// Get the stored hash og the password
@@ -144,19 +251,322 @@ func (storage *FirestoreStorage) AuthenticateUser(username string, password stri
 	// Check if the provided password matches the stored hash
 	correctPassword := checkPasswordHash(password, user.Password)
 	if !correctPassword {
-		return errors.New("invalid credentials")
+		return ErrInvalidCredentials
 	}
 
 	return nil
 }
 
-// HashPassword hashes a plaintext password using bcrypt with a cost of 14.
-// The cost increases the work factor with 2^cost, making it slower to brute force.
+// Helper function to read a user document without the password. Users registered before roles have no role field.
+func firestoreUser(doc *firestore.DocumentSnapshot) (User, error) {
+	var data struct {
+		Role string `firestore:"role"`
+	}
+	err := doc.DataTo(&data)
+	if err != nil {
+		return User{}, err
+	}
+	if data.Role == "" {
+		data.Role = RoleUser
+	}
+	return User{Username: doc.Ref.ID, Role: data.Role}, nil
+}
+
+// Get the user from Firestore without the password
+func (storage *FirestoreStorage) GetUser(ctx context.Context, username string) (User, error) {
+
+	doc, err := storage.client.Collection("users").Doc(username).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return firestoreUser(doc)
+}
+
+// List the users of Firestore without their passwords, sorted by username as the username is the document ID
+func (storage *FirestoreStorage) ListUsers(ctx context.Context) ([]User, error) {
+
+	iter := storage.client.Collection("users").OrderBy(firestore.DocumentID, firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	users := []User{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		user, err := firestoreUser(doc)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// Set the role of the user in Firestore. Update fails if the document does not exist.
+func (storage *FirestoreStorage) SetUserRole(ctx context.Context, username string, role string) error {
+	if !validRole(role) {
+		return ErrInvalidRole
+	}
+
+	_, err := storage.client.Collection("users").Doc(username).Update(ctx, []firestore.Update{{Path: "role", Value: role}})
+	if status.Code(err) == codes.NotFound {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// Fields of a refresh token document, keyed by the ID of the token
+type firestoreRefreshToken struct {
+	Family    string    `firestore:"family"`
+	Owner     string    `firestore:"owner"`
+	ExpiresAt time.Time `firestore:"expiresAt"`
+	Used      bool      `firestore:"used"`
+}
+
+// Save the refresh token to Firestore. Expired tokens are deleted by the TTL policy on expiresAt in
+// firestore.indexes.json, so unlike the SQL backends the owner's expired tokens are not deleted here.
+func (storage *FirestoreStorage) SaveRefreshToken(ctx context.Context, token RefreshToken) error {
+
+	_, err := storage.client.Collection("refreshTokens").Doc(token.ID).Create(ctx, firestoreRefreshToken{
+		Family:    token.Family,
+		Owner:     token.Owner,
+		ExpiresAt: token.ExpiresAt,
+		Used:      token.Used,
+	})
+	return err
+}
+
+// Get the refresh token from Firestore
+func (storage *FirestoreStorage) GetRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+
+	doc, err := storage.client.Collection("refreshTokens").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return RefreshToken{}, ErrTokenNotFound
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	var data firestoreRefreshToken
+	err = doc.DataTo(&data)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return RefreshToken{ID: id, Family: data.Family, Owner: data.Owner, ExpiresAt: data.ExpiresAt, Used: data.Used}, nil
+}
+
+// Mark the refresh token in Firestore as used. The token is read and updated in a transaction,
+// so of two concurrent uses of the same token only one succeeds.
+func (storage *FirestoreStorage) UseRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+
+	docRef := storage.client.Collection("refreshTokens").Doc(id)
+	var token RefreshToken
+	err := storage.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrTokenNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var data firestoreRefreshToken
+		err = doc.DataTo(&data)
+		if err != nil {
+			return err
+		}
+		token = RefreshToken{ID: id, Family: data.Family, Owner: data.Owner, ExpiresAt: data.ExpiresAt, Used: data.Used}
+		if token.Used {
+			return ErrTokenUsed
+		}
+		return tx.Update(docRef, []firestore.Update{{Path: "used", Value: true}})
+	})
+	if err == ErrTokenNotFound {
+		return RefreshToken{}, err
+	}
+	return token, err
+}
+
+// Delete the refresh tokens of the family from Firestore
+func (storage *FirestoreStorage) RevokeRefreshTokens(ctx context.Context, family string) error {
+
+	iter := storage.client.Collection("refreshTokens").Where("family", "==", family).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		_, err = doc.Ref.Delete(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add the access token to the revoked tokens in Firestore. Revocations are deleted by the TTL policy on expiresAt.
+func (storage *FirestoreStorage) RevokeAccessToken(ctx context.Context, id string, expiresAt time.Time) error {
+
+	_, err := storage.client.Collection("revokedTokens").Doc(id).Set(ctx, map[string]interface{}{
+		"expiresAt": expiresAt,
+	})
+	return err
+}
+
+// Check whether the access token is revoked in Firestore
+func (storage *FirestoreStorage) IsAccessTokenRevoked(ctx context.Context, id string) (bool, error) {
+
+	_, err := storage.client.Collection("revokedTokens").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Document of an API key in the apiKeys collection, whose document ID is the key ID
+type firestoreAPIKey struct {
+	Hash       string    `firestore:"hash"`
+	Owner      string    `firestore:"owner"`
+	Name       string    `firestore:"name"`
+	Scopes     []string  `firestore:"scopes"`
+	CreatedAt  time.Time `firestore:"createdAt"`
+	LastUsedAt time.Time `firestore:"lastUsedAt"`
+}
+
+// Helper function to read an API key document
+func firestoreAPIKeyOf(doc *firestore.DocumentSnapshot) (APIKey, error) {
+	var data firestoreAPIKey
+	if err := doc.DataTo(&data); err != nil {
+		return APIKey{}, err
+	}
+	return APIKey{
+		ID:         doc.Ref.ID,
+		Hash:       data.Hash,
+		Owner:      data.Owner,
+		Name:       data.Name,
+		Scopes:     data.Scopes,
+		CreatedAt:  data.CreatedAt,
+		LastUsedAt: data.LastUsedAt,
+	}, nil
+}
+
+// Save the API key to Firestore
+func (storage *FirestoreStorage) CreateAPIKey(ctx context.Context, key APIKey) error {
+
+	_, err := storage.client.Collection("apiKeys").Doc(key.ID).Create(ctx, firestoreAPIKey{
+		Hash:       key.Hash,
+		Owner:      key.Owner,
+		Name:       key.Name,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+	})
+	return err
+}
+
+// Get the API key from Firestore
+func (storage *FirestoreStorage) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+
+	doc, err := storage.client.Collection("apiKeys").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	return firestoreAPIKeyOf(doc)
+}
+
+// List the API keys of the owner in Firestore, oldest first. The query uses the owner and createdAt index in
+// firestore.indexes.json.
+func (storage *FirestoreStorage) ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error) {
+
+	iter := storage.client.Collection("apiKeys").
+		Where("owner", "==", owner).
+		OrderBy("createdAt", firestore.Asc).
+		OrderBy(firestore.DocumentID, firestore.Asc).
+		Documents(ctx)
+
+	keys := []APIKey{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		key, err := firestoreAPIKeyOf(doc)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Delete the API key of the owner from Firestore. The key is read and deleted in a transaction, so a key of
+// another owner is never deleted.
+func (storage *FirestoreStorage) DeleteAPIKey(ctx context.Context, owner string, id string) error {
+
+	docRef := storage.client.Collection("apiKeys").Doc(id)
+	return storage.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrAPIKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		key, err := firestoreAPIKeyOf(doc)
+		if err != nil {
+			return err
+		}
+		if key.Owner != owner {
+			return ErrAPIKeyNotFound
+		}
+		return tx.Delete(docRef)
+	})
+}
+
+// Set the last-used time of the API key in Firestore
+func (storage *FirestoreStorage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+
+	_, err := storage.client.Collection("apiKeys").Doc(id).Update(ctx, []firestore.Update{{Path: "lastUsedAt", Value: usedAt}})
+	if status.Code(err) == codes.NotFound {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
+
+// The bcrypt cost used when hashing passwords. The cost increases the work factor with 2^cost,
+// making it slower to brute force. Tests lower it to keep them fast.
+var passwordHashCost = 14
+
+// HashPassword hashes a plaintext password using bcrypt with the passwordHashCost.
+// It is shared by the storage backends that persist users.
 func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
 	return string(bytes), err
 }
 
+// Hash that the password of a login is compared with when the user does not exist. Unknown users then take as
+// long as wrong passwords, so the response time does not tell which usernames exist.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("the password of a user that does not exist")
+	return hash
+})
+
 // CheckPasswordHash compares a plaintext password with a hashed password using bcrypt.
 func checkPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Project used for the tests against the Firestore emulator
+const firestoreTestProject = "overengineered-calculator-test"
+
+// Helper function to create a Firestore storage against the emulator in FIRESTORE_EMULATOR_HOST, e.g. "localhost:8081".
+// The emulator is cleared before each test. The tests are skipped when the variable is not set.
+func setupFirestoreStorage(t *testing.T) *FirestoreStorage {
+	emulatorHost := os.Getenv("FIRESTORE_EMULATOR_HOST")
+	if emulatorHost == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+
+	// Delete all documents of the test project through the emulator's REST API
+	request, _ := http.NewRequest("DELETE", "http://"+emulatorHost+"/emulator/v1/projects/"+firestoreTestProject+"/databases/(default)/documents", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	response.Body.Close()
+
+	client, err := firestore.NewClient(context.Background(), firestoreTestProject)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	// Keep password hashing fast in tests
+	passwordHashCost = bcrypt.MinCost
+	t.Cleanup(func() { passwordHashCost = 14 })
+
+	return NewFirestoreStorage(client)
+}
@@ -1,47 +1,160 @@
 package storage
 
 import (
-	"errors"
-	"fmt"
+	"context"
+	"crypto/subtle"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 )
 
-// Used to store history in memory for unit tests
+// Used to store history in memory for unit tests. It is safe for concurrent use, and every method
+// returns the context's error without doing anything if the context is already done.
 type localStorage struct {
+	mutex   sync.Mutex
 	history []HistoryEntry
 	users   map[string]*User
+	lastID  int64 // IDs are assigned in insertion order
+
+	refreshTokens map[string]RefreshToken // Keyed by ID
+	revokedTokens map[string]time.Time    // Expiry of the revoked access tokens, keyed by ID
+	apiKeys       map[string]APIKey       // Keyed by ID
 }
 
 func NewLocalStorage() *localStorage {
 	return &localStorage{
 		history: []HistoryEntry{},
 		users:   make(map[string]*User),
+
+		refreshTokens: make(map[string]RefreshToken),
+		revokedTokens: make(map[string]time.Time),
+		apiKeys:       make(map[string]APIKey),
 	}
 }
 
 // Save the history entry to the localStorage
-func (storage *localStorage) SaveOperation(entry HistoryEntry) error {
+func (storage *localStorage) SaveOperation(ctx context.Context, entry HistoryEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	storage.lastID++
+	entry.ID = strconv.FormatInt(storage.lastID, 10)
 	storage.history = append(storage.history, entry)
 	return nil
 }
 
-// Get the history from the localStorage
-func (storage *localStorage) GetHistory() ([]HistoryEntry, error) {
-	if len(storage.history) == 0 {
-		return nil, errors.New("no history found")
+// Save the history entries to the localStorage at once, so no other operation sees only some of them
+func (storage *localStorage) SaveOperations(ctx context.Context, entries []HistoryEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	for _, entry := range entries {
+		storage.lastID++
+		entry.ID = strconv.FormatInt(storage.lastID, 10)
+		storage.history = append(storage.history, entry)
+	}
+	return nil
+}
+
+// Get the history of the owner from the localStorage sorted by newest operations first, like the database backends.
+// Entries with the same timestamp are returned in reverse insertion order.
+func (storage *localStorage) GetHistory(ctx context.Context, owner string) ([]HistoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	history := []HistoryEntry{}
+	for i := len(storage.history) - 1; i >= 0; i-- {
+		if storage.history[i].Owner == owner {
+			history = append(history, storage.history[i])
+		}
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Timestamp.After(history[j].Timestamp)
+	})
+	return history, nil
+}
+
+// Query a page of the owner's history from the localStorage by filtering and sorting all entries in memory
+func (storage *localStorage) QueryHistory(ctx context.Context, query HistoryQuery) (HistoryPage, error) {
+	if err := ctx.Err(); err != nil {
+		return HistoryPage{}, err
+	}
+
+	query, err := normalizeHistoryQuery(query)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	cursor, _, err := decodeNumericPageToken(query)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+
+	storage.mutex.Lock()
+	var entries []HistoryEntry
+	for _, entry := range storage.history {
+		if matchesHistoryQuery(query, entry) {
+			entries = append(entries, entry)
+		}
 	}
-	return storage.history, nil
+	storage.mutex.Unlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return historyLess(query, entries[i], entries[j])
+	})
+
+	// Skip the entries up to and including the cursor
+	if cursor != nil {
+		position := sort.Search(len(entries), func(i int) bool {
+			return historyLess(query, HistoryEntry{Timestamp: cursor.Timestamp, Result: cursor.Result, ID: cursor.ID}, entries[i])
+		})
+		entries = entries[position:]
+	}
+
+	if len(entries) > query.Limit+1 {
+		entries = entries[:query.Limit+1]
+	}
+	return newHistoryPage(query, entries), nil
 }
 
-// Reset the history in the localStorage
-func (storage *localStorage) ResetHistory() error {
-	storage.history = []HistoryEntry{}
+// Reset the history of the owner in the localStorage, keeping the history of other users
+func (storage *localStorage) ResetHistory(ctx context.Context, owner string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	remaining := []HistoryEntry{}
+	for _, entry := range storage.history {
+		if entry.Owner != owner {
+			remaining = append(remaining, entry)
+		}
+	}
+
+	storage.history = remaining
 	return nil
 }
 
-func (storage *localStorage) RegisterUser(username string, password string) error {
+func (storage *localStorage) RegisterUser(ctx context.Context, username string, password string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
 
-	if storage.users[username].Username != "" {
-		return errors.New("user already exists")
+	if storage.users[username] != nil {
+		return ErrUserExists
 	}
 
 	newUser := NewUser(username, password)
@@ -50,17 +163,279 @@ func (storage *localStorage) RegisterUser(username string, password string) erro
 	return nil
 }
 
-func (userStorage *localStorage) AuthenticateUser(username string, password string) error {
-
+func (userStorage *localStorage) AuthenticateUser(ctx context.Context, username string, password string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	userStorage.mutex.Lock()
 	user := userStorage.users[username]
+	userStorage.mutex.Unlock()
+
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	// Compare in constant time, so the response time does not tell how much of the password matched
+	if subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// Get the user from the localStorage without the password
+func (storage *localStorage) GetUser(ctx context.Context, username string) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	user := storage.users[username]
+	if user == nil {
+		return User{}, ErrUserNotFound
+	}
+	return User{Username: user.Username, Role: user.Role}, nil
+}
+
+// List the users of the localStorage without their passwords
+func (storage *localStorage) ListUsers(ctx context.Context) ([]User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
 
+	users := []User{}
+	for _, user := range storage.users {
+		users = append(users, User{Username: user.Username, Role: user.Role})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+// Set the role of the user in the localStorage
+func (storage *localStorage) SetUserRole(ctx context.Context, username string, role string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !validRole(role) {
+		return ErrInvalidRole
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	user := storage.users[username]
 	if user == nil {
-		return fmt.Errorf("user %s not found", username)
+		return ErrUserNotFound
+	}
+	user.Role = role
+	return nil
+}
+
+// Save the refresh token to the localStorage, dropping the expired tokens of the owner
+func (storage *localStorage) SaveRefreshToken(ctx context.Context, token RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	now := time.Now()
+	for id, stored := range storage.refreshTokens {
+		if stored.Owner == token.Owner && stored.ExpiresAt.Before(now) {
+			delete(storage.refreshTokens, id)
+		}
+	}
+	storage.refreshTokens[token.ID] = token
+	return nil
+}
+
+// Get the refresh token from the localStorage
+func (storage *localStorage) GetRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return RefreshToken{}, err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	token, found := storage.refreshTokens[id]
+	if !found {
+		return RefreshToken{}, ErrTokenNotFound
+	}
+	return token, nil
+}
+
+// Mark the refresh token in the localStorage as used, returning it as it was before
+func (storage *localStorage) UseRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return RefreshToken{}, err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	token, found := storage.refreshTokens[id]
+	if !found {
+		return RefreshToken{}, ErrTokenNotFound
+	}
+	if token.Used {
+		return token, ErrTokenUsed
+	}
+
+	used := token
+	used.Used = true
+	storage.refreshTokens[id] = used
+	return token, nil
+}
+
+// Delete the refresh tokens of the family from the localStorage
+func (storage *localStorage) RevokeRefreshTokens(ctx context.Context, family string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	for id, token := range storage.refreshTokens {
+		if token.Family == family {
+			delete(storage.refreshTokens, id)
+		}
+	}
+	return nil
+}
+
+// Add the access token to the revoked tokens in the localStorage, dropping the revocations that have expired
+func (storage *localStorage) RevokeAccessToken(ctx context.Context, id string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	now := time.Now()
+	for revokedID, revokedUntil := range storage.revokedTokens {
+		if revokedUntil.Before(now) {
+			delete(storage.revokedTokens, revokedID)
+		}
+	}
+	storage.revokedTokens[id] = expiresAt
+	return nil
+}
+
+// Check whether the access token is revoked in the localStorage
+func (storage *localStorage) IsAccessTokenRevoked(ctx context.Context, id string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	_, revoked := storage.revokedTokens[id]
+	return revoked, nil
+}
+
+// Save the API key to the localStorage
+func (storage *localStorage) CreateAPIKey(ctx context.Context, key APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	key.Scopes = append([]string(nil), key.Scopes...)
+	storage.apiKeys[key.ID] = key
+	return nil
+}
+
+// Get the API key from the localStorage
+func (storage *localStorage) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return APIKey{}, err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	key, found := storage.apiKeys[id]
+	if !found {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// List the API keys of the owner in the localStorage, oldest first
+func (storage *localStorage) ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	keys := []APIKey{}
+	for _, key := range storage.apiKeys {
+		if key.Owner == owner {
+			keys = append(keys, key)
+		}
 	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Delete the API key of the owner from the localStorage
+func (storage *localStorage) DeleteAPIKey(ctx context.Context, owner string, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	key, found := storage.apiKeys[id]
+	if !found || key.Owner != owner {
+		return ErrAPIKeyNotFound
+	}
+	delete(storage.apiKeys, id)
+	return nil
+}
 
-	if user.Password != password {
-		return fmt.Errorf("wrong password for username: %s", username)
+// Set the last-used time of the API key in the localStorage
+func (storage *localStorage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
 
+	key, found := storage.apiKeys[id]
+	if !found {
+		return ErrAPIKeyNotFound
+	}
+	key.LastUsedAt = usedAt
+	storage.apiKeys[id] = key
 	return nil
 }
+
+// Helper function reporting whether entry a comes before entry b in the order of the query.
+// Entries with the same sort value are ordered by their numeric ID in the same direction.
+func historyLess(query HistoryQuery, a HistoryEntry, b HistoryEntry) bool {
+	var less, greater bool
+	if query.SortBy == SortByResult {
+		less, greater = a.Result < b.Result, a.Result > b.Result
+	} else {
+		less, greater = a.Timestamp.Before(b.Timestamp), a.Timestamp.After(b.Timestamp)
+	}
+
+	if !less && !greater {
+		aID, _ := strconv.ParseInt(a.ID, 10, 64)
+		bID, _ := strconv.ParseInt(b.ID, 10, 64)
+		less, greater = aID < bID, aID > bID
+	}
+
+	if query.Ascending {
+		return less
+	}
+	return greater
+}
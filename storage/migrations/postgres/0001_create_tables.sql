@@ -0,0 +1,24 @@
+-- Calculation history, scoped to the owner (username)
+CREATE TABLE calculations (
+	id             BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	owner          TEXT             NOT NULL,
+	operand1       DOUBLE PRECISION NOT NULL,
+	operand2       DOUBLE PRECISION NOT NULL,
+	operation      TEXT             NOT NULL,
+	result         DOUBLE PRECISION NOT NULL,
+	timestamp      TIMESTAMPTZ      NOT NULL,
+	expression     TEXT             NOT NULL DEFAULT '',
+	angle_mode     TEXT             NOT NULL DEFAULT '',
+	mode           TEXT             NOT NULL DEFAULT '',
+	exact_operand1 TEXT             NOT NULL DEFAULT '',
+	exact_operand2 TEXT             NOT NULL DEFAULT '',
+	exact_result   TEXT             NOT NULL DEFAULT ''
+);
+
+-- Matches the owner filter and newest-first ordering of GetHistory
+CREATE INDEX calculations_owner_timestamp ON calculations (owner, timestamp DESC, id DESC);
+
+CREATE TABLE users (
+	username TEXT PRIMARY KEY,
+	password TEXT NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Supports sorting and filtering the owner's history by result
+CREATE INDEX calculations_owner_result ON calculations (owner, result, id);
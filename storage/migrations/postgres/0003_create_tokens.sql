@@ -0,0 +1,17 @@
+-- Refresh tokens by the SHA-256 hash of the token. Tokens of a family are revoked together.
+CREATE TABLE refresh_tokens (
+	id         TEXT        PRIMARY KEY,
+	family     TEXT        NOT NULL,
+	owner      TEXT        NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used       BOOLEAN     NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX refresh_tokens_family ON refresh_tokens (family);
+CREATE INDEX refresh_tokens_owner_expires_at ON refresh_tokens (owner, expires_at);
+
+-- Access tokens revoked by logout, kept until they expire
+CREATE TABLE revoked_tokens (
+	id         TEXT        PRIMARY KEY,
+	expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Role of the user: user, admin or read-only
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
@@ -0,0 +1,13 @@
+-- API keys by their public ID. Only the SHA-256 hash of the secret part is stored.
+CREATE TABLE api_keys (
+	id           TEXT        PRIMARY KEY,
+	hash         TEXT        NOT NULL,
+	owner        TEXT        NOT NULL,
+	name         TEXT        NOT NULL,
+	scopes       TEXT[]      NOT NULL,
+	created_at   TIMESTAMPTZ NOT NULL,
+	last_used_at TIMESTAMPTZ
+);
+
+-- Matches the owner filter and oldest-first ordering of ListAPIKeys
+CREATE INDEX api_keys_owner_created_at ON api_keys (owner, created_at, id);
@@ -0,0 +1,534 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStorage is used to store history in a PostgreSQL database through a connection pool.
+type PostgresStorage struct {
+	pool *pgxpool.Pool
+}
+
+// The versioned schema migrations, named <version>_<description>.sql, e.g. 0001_create_tables.sql
+//
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// Arbitrary key of the advisory lock that prevents several servers from migrating at the same time
+const postgresMigrationLock = 4210
+
+// NewPostgresStorage applies any pending schema migrations before returning the storage, see MigratePostgres.
+func NewPostgresStorage(pool *pgxpool.Pool) (*PostgresStorage, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := MigratePostgres(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostgresStorage{
+		pool: pool,
+	}, nil
+}
+
+// A schema migration read from the embedded migrations directory
+type postgresMigration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// Helper function to read the embedded migrations sorted by version
+func loadPostgresMigrations() ([]postgresMigration, error) {
+	files, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []postgresMigration
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "migrations/postgres/")
+		prefix, _, found := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil {
+			return nil, fmt.Errorf("migration %s must be named <version>_<description>.sql", name)
+		}
+
+		content, err := postgresMigrations.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, postgresMigration{version: version, name: name, sql: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].version)
+		}
+	}
+	return migrations, nil
+}
+
+// MigratePostgres applies the embedded migrations that have not been applied yet. Each migration runs in its own
+// transaction together with its row in the schema_migrations table, so a failed migration leaves no trace.
+func MigratePostgres(ctx context.Context, pool *pgxpool.Pool) error {
+
+	migrations, err := loadPostgresMigrations()
+	if err != nil {
+		return err
+	}
+
+	// Hold a session level advisory lock on a single connection while migrating
+	connection, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer connection.Release()
+
+	_, err = connection.Exec(ctx, "SELECT pg_advisory_lock($1)", postgresMigrationLock)
+	if err != nil {
+		return err
+	}
+	defer connection.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", postgresMigrationLock)
+
+	_, err = connection.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT        NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = connection.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= current {
+			continue
+		}
+
+		err = pgx.BeginFunc(ctx, connection, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, migration.sql)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.version, migration.name)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %v", migration.name, err)
+		}
+	}
+
+	return nil
+}
+
+// Statement inserting a history entry, see postgresHistoryArgs for the arguments
+const postgresInsertHistory = `
+	INSERT INTO calculations (owner, operand1, operand2, operation, result, timestamp, expression,
+		angle_mode, mode, exact_operand1, exact_operand2, exact_result)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+// Helper function to get the arguments of postgresInsertHistory for the entry
+func postgresHistoryArgs(entry HistoryEntry) []any {
+	return []any{
+		entry.Owner, entry.Operand1, entry.Operand2, entry.Operation, entry.Result, entry.Timestamp,
+		entry.Expression, entry.AngleMode, entry.Mode, entry.ExactOperand1, entry.ExactOperand2, entry.ExactResult,
+	}
+}
+
+// Save the history entry to the PostgreSQL database
+func (storage *PostgresStorage) SaveOperation(ctx context.Context, entry HistoryEntry) error {
+
+	_, err := storage.pool.Exec(ctx, postgresInsertHistory, postgresHistoryArgs(entry)...)
+	return err
+}
+
+// Save the history entries to the PostgreSQL database. The inserts are sent in one round trip as a batch,
+// inside a transaction so either all or none of the entries are saved.
+func (storage *PostgresStorage) SaveOperations(ctx context.Context, entries []HistoryEntry) error {
+
+	batch := &pgx.Batch{}
+	for _, entry := range entries {
+		batch.Queue(postgresInsertHistory, postgresHistoryArgs(entry)...)
+	}
+
+	return pgx.BeginFunc(ctx, storage.pool, func(tx pgx.Tx) error {
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+// The function GetHistory retrieves the owner's history of calculations from the PostgreSQL database sorted by newest
+// operations first. Entries with the same timestamp are returned in reverse insertion order.
+func (storage *PostgresStorage) GetHistory(ctx context.Context, owner string) ([]HistoryEntry, error) {
+
+	rows, err := storage.pool.Query(ctx,
+		"SELECT "+historyColumns+" FROM calculations WHERE owner = $1 ORDER BY timestamp DESC, id DESC",
+		owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanPostgresHistory(rows)
+}
+
+// Query a page of the owner's history from the PostgreSQL database
+func (storage *PostgresStorage) QueryHistory(ctx context.Context, query HistoryQuery) (HistoryPage, error) {
+
+	query, err := normalizeHistoryQuery(query)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	cursor, cursorID, err := decodeNumericPageToken(query)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+
+	statement, args := buildHistorySQL(query, cursor, cursorID,
+		func(n int) string { return "$" + strconv.Itoa(n) },
+		func(timestamp time.Time) any { return timestamp },
+	)
+	rows, err := storage.pool.Query(ctx, statement, args...)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+
+	entries, err := scanPostgresHistory(rows)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	return newHistoryPage(query, entries), nil
+}
+
+// Helper function to scan and close the rows of a query selecting the historyColumns
+func scanPostgresHistory(rows pgx.Rows) ([]HistoryEntry, error) {
+	defer rows.Close()
+
+	var history []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		var id int64
+
+		err := rows.Scan(&id, &entry.Owner, &entry.Operand1, &entry.Operand2, &entry.Operation, &entry.Result, &entry.Timestamp,
+			&entry.Expression, &entry.AngleMode, &entry.Mode, &entry.ExactOperand1, &entry.ExactOperand2, &entry.ExactResult)
+		if err != nil {
+			return nil, err
+		}
+		entry.ID = strconv.FormatInt(id, 10)
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
+}
+
+// Reset the owner's history in the PostgreSQL database. The owner's rows are locked and deleted in one transaction,
+// so a concurrent reset of the same history waits for this one instead of interleaving with it.
+func (storage *PostgresStorage) ResetHistory(ctx context.Context, owner string) error {
+
+	return pgx.BeginFunc(ctx, storage.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT id FROM calculations WHERE owner = $1 FOR UPDATE", owner)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM calculations WHERE owner = $1", owner)
+		return err
+	})
+}
+
+// RegisterUser stores the username and bcrypt hash of the password in the PostgreSQL database.
+func (storage *PostgresStorage) RegisterUser(ctx context.Context, username string, password string) error {
+
+	// Hash the password
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// The primary key on username makes the insert a no-op if the user already exists
+	tag, err := storage.pool.Exec(ctx,
+		"INSERT INTO users (username, password) VALUES ($1, $2) ON CONFLICT (username) DO NOTHING",
+		username, hashedPassword,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserExists
+	}
+
+	return nil
+}
+
+// AuthenticateUser retrieves the stored hashed password and checks it against the hash of the provided password.
+func (storage *PostgresStorage) AuthenticateUser(ctx context.Context, username string, password string) error {
+
+	var hashedPassword string
+	err := storage.pool.QueryRow(ctx, "SELECT password FROM users WHERE username = $1", username).Scan(&hashedPassword)
+	if errors.Is(err, pgx.ErrNoRows) {
+		checkPasswordHash(password, dummyPasswordHash())
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// Check if the provided password matches the stored hash
+	correctPassword := checkPasswordHash(password, hashedPassword)
+	if !correctPassword {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// Get the user from the PostgreSQL database without the password
+func (storage *PostgresStorage) GetUser(ctx context.Context, username string) (User, error) {
+
+	user := User{Username: username}
+	err := storage.pool.QueryRow(ctx, "SELECT role FROM users WHERE username = $1", username).Scan(&user.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+// List the users of the PostgreSQL database without their passwords
+func (storage *PostgresStorage) ListUsers(ctx context.Context) ([]User, error) {
+
+	rows, err := storage.pool.Query(ctx, "SELECT username, role FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.Username, &user.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// Set the role of the user in the PostgreSQL database
+func (storage *PostgresStorage) SetUserRole(ctx context.Context, username string, role string) error {
+	if !validRole(role) {
+		return ErrInvalidRole
+	}
+
+	tag, err := storage.pool.Exec(ctx, "UPDATE users SET role = $1 WHERE username = $2", role, username)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// Save the refresh token to the PostgreSQL database, deleting the expired tokens of the owner
+func (storage *PostgresStorage) SaveRefreshToken(ctx context.Context, token RefreshToken) error {
+
+	return pgx.BeginFunc(ctx, storage.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM refresh_tokens WHERE owner = $1 AND expires_at < now()", token.Owner)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			"INSERT INTO refresh_tokens (id, family, owner, expires_at, used) VALUES ($1, $2, $3, $4, $5)",
+			token.ID, token.Family, token.Owner, token.ExpiresAt, token.Used,
+		)
+		return err
+	})
+}
+
+// Get the refresh token from the PostgreSQL database
+func (storage *PostgresStorage) GetRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+
+	token := RefreshToken{ID: id}
+	err := storage.pool.QueryRow(ctx,
+		"SELECT family, owner, expires_at, used FROM refresh_tokens WHERE id = $1", id,
+	).Scan(&token.Family, &token.Owner, &token.ExpiresAt, &token.Used)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RefreshToken{}, ErrTokenNotFound
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return token, nil
+}
+
+// Mark the refresh token in the PostgreSQL database as used. The update only matches an unused token,
+// so of two concurrent uses of the same token only one succeeds.
+func (storage *PostgresStorage) UseRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+
+	token := RefreshToken{ID: id}
+	err := storage.pool.QueryRow(ctx,
+		"UPDATE refresh_tokens SET used = TRUE WHERE id = $1 AND NOT used RETURNING family, owner, expires_at",
+		id,
+	).Scan(&token.Family, &token.Owner, &token.ExpiresAt)
+	if err == nil {
+		return token, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return RefreshToken{}, err
+	}
+
+	// The token is either unknown or was used before
+	err = storage.pool.QueryRow(ctx,
+		"SELECT family, owner, expires_at, used FROM refresh_tokens WHERE id = $1", id,
+	).Scan(&token.Family, &token.Owner, &token.ExpiresAt, &token.Used)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RefreshToken{}, ErrTokenNotFound
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return token, ErrTokenUsed
+}
+
+// Delete the refresh tokens of the family from the PostgreSQL database
+func (storage *PostgresStorage) RevokeRefreshTokens(ctx context.Context, family string) error {
+
+	_, err := storage.pool.Exec(ctx, "DELETE FROM refresh_tokens WHERE family = $1", family)
+	return err
+}
+
+// Add the access token to the revoked tokens in the PostgreSQL database, deleting the revocations that have expired
+func (storage *PostgresStorage) RevokeAccessToken(ctx context.Context, id string, expiresAt time.Time) error {
+
+	return pgx.BeginFunc(ctx, storage.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM revoked_tokens WHERE expires_at < now()")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			"INSERT INTO revoked_tokens (id, expires_at) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING",
+			id, expiresAt,
+		)
+		return err
+	})
+}
+
+// Check whether the access token is revoked in the PostgreSQL database
+func (storage *PostgresStorage) IsAccessTokenRevoked(ctx context.Context, id string) (bool, error) {
+
+	var revoked bool
+	err := storage.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE id = $1)", id).Scan(&revoked)
+	return revoked, err
+}
+
+// Columns of an API key in the order scanned by scanPostgresAPIKey
+const postgresAPIKeyColumns = "id, hash, owner, name, scopes, created_at, last_used_at"
+
+// Helper function to scan an API key selected with the postgresAPIKeyColumns. A key that was never used has
+// NULL as last-used time.
+func scanPostgresAPIKey(row pgx.Row) (APIKey, error) {
+	var key APIKey
+	var lastUsedAt *time.Time
+
+	err := row.Scan(&key.ID, &key.Hash, &key.Owner, &key.Name, &key.Scopes, &key.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if lastUsedAt != nil {
+		key.LastUsedAt = *lastUsedAt
+	}
+	return key, nil
+}
+
+// Save the API key to the PostgreSQL database
+func (storage *PostgresStorage) CreateAPIKey(ctx context.Context, key APIKey) error {
+
+	var lastUsedAt *time.Time
+	if !key.LastUsedAt.IsZero() {
+		lastUsedAt = &key.LastUsedAt
+	}
+	_, err := storage.pool.Exec(ctx,
+		"INSERT INTO api_keys ("+postgresAPIKeyColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		key.ID, key.Hash, key.Owner, key.Name, key.Scopes, key.CreatedAt, lastUsedAt,
+	)
+	return err
+}
+
+// Get the API key from the PostgreSQL database
+func (storage *PostgresStorage) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+
+	row := storage.pool.QueryRow(ctx, "SELECT "+postgresAPIKeyColumns+" FROM api_keys WHERE id = $1", id)
+	key, err := scanPostgresAPIKey(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// List the API keys of the owner in the PostgreSQL database, oldest first
+func (storage *PostgresStorage) ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error) {
+
+	rows, err := storage.pool.Query(ctx,
+		"SELECT "+postgresAPIKeyColumns+" FROM api_keys WHERE owner = $1 ORDER BY created_at, id", owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanPostgresAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Delete the API key of the owner from the PostgreSQL database
+func (storage *PostgresStorage) DeleteAPIKey(ctx context.Context, owner string, id string) error {
+
+	tag, err := storage.pool.Exec(ctx, "DELETE FROM api_keys WHERE id = $1 AND owner = $2", id, owner)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Set the last-used time of the API key in the PostgreSQL database
+func (storage *PostgresStorage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+
+	tag, err := storage.pool.Exec(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", usedAt, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
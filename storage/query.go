@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Number of entries per page when a query has no limit, and the largest limit a query may ask for
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 1000
+)
+
+// SortField is the field the history is sorted by. Entries with equal values are ordered by their ID.
+type SortField string
+
+const (
+	SortByTimestamp SortField = "timestamp"
+	SortByResult    SortField = "result"
+)
+
+// Largest number of distinct operations a query may filter by, as Firestore allows at most 30 values in an "in" filter
+const MaxHistoryOperations = 30
+
+// ErrInvalidPageToken is returned when a page token is malformed or was issued for a query with another sort order.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// ErrTooManyOperations is returned when a query filters by more than MaxHistoryOperations distinct operations
+var ErrTooManyOperations = fmt.Errorf("at most %d operations can be filtered", MaxHistoryOperations)
+
+// HistoryQuery selects a page of the owner's history. The zero values of the filters mean no filtering,
+// and the default order is newest first like GetHistory.
+type HistoryQuery struct {
+	Owner string
+
+	Operations []string  // Only entries with one of these operations, e.g. "Add"
+	From       time.Time // Only entries at or after this time
+	To         time.Time // Only entries before this time
+	MinResult  *float64  // Only entries with a result of at least this value
+	MaxResult  *float64  // Only entries with a result of at most this value
+
+	SortBy    SortField // SortByTimestamp (default) or SortByResult
+	Ascending bool      // Sort in ascending order instead of descending
+
+	Limit     int    // Maximum number of entries in the page. Defaults to DefaultHistoryLimit
+	PageToken string // NextPageToken of the previous page, or empty for the first page
+}
+
+// HistoryPage is a page of history entries. NextPageToken is empty on the last page.
+type HistoryPage struct {
+	Entries       []HistoryEntry
+	NextPageToken string
+}
+
+// historyCursor is the position after the last entry of a page, encoded in the page token
+type historyCursor struct {
+	SortBy     SortField `json:"s"`
+	Ascending  bool      `json:"a"`
+	Timestamp  time.Time `json:"t"`
+	Result     float64   `json:"-"`
+	ResultText string    `json:"r"` // Result as text, as JSON has no NaN or infinity
+	ID         string    `json:"i"`
+}
+
+// Helper function to validate a query and fill in the defaults
+func normalizeHistoryQuery(query HistoryQuery) (HistoryQuery, error) {
+	if query.SortBy == "" {
+		query.SortBy = SortByTimestamp
+	}
+	if query.SortBy != SortByTimestamp && query.SortBy != SortByResult {
+		return query, errors.New("invalid sort field")
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultHistoryLimit
+	}
+	if query.Limit > MaxHistoryLimit {
+		query.Limit = MaxHistoryLimit
+	}
+
+	// Repeated operations are filtered once, so only distinct operations count towards the limit of every backend
+	var operations []string
+	for _, operation := range query.Operations {
+		if !slices.Contains(operations, operation) {
+			operations = append(operations, operation)
+		}
+	}
+	if len(operations) > MaxHistoryOperations {
+		return query, ErrTooManyOperations
+	}
+	query.Operations = operations
+	return query, nil
+}
+
+// Helper function to encode the position after the entry as a page token
+func encodePageToken(query HistoryQuery, entry HistoryEntry) string {
+	cursor, _ := json.Marshal(historyCursor{
+		SortBy:     query.SortBy,
+		Ascending:  query.Ascending,
+		Timestamp:  entry.Timestamp,
+		ResultText: strconv.FormatFloat(entry.Result, 'g', -1, 64),
+		ID:         entry.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(cursor)
+}
+
+// Helper function to decode the page token of the query. It returns nil for the first page.
+func decodePageToken(query HistoryQuery) (*historyCursor, error) {
+	if query.PageToken == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(query.PageToken)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	var cursor historyCursor
+	err = json.Unmarshal(data, &cursor)
+	if err != nil || cursor.ID == "" {
+		return nil, ErrInvalidPageToken
+	}
+	cursor.Result, err = strconv.ParseFloat(cursor.ResultText, 64)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	// A token only makes sense for the order it was created with
+	if cursor.SortBy != query.SortBy || cursor.Ascending != query.Ascending {
+		return nil, ErrInvalidPageToken
+	}
+	return &cursor, nil
+}
+
+// Helper function to decode a page token for the backends that use numeric IDs
+func decodeNumericPageToken(query HistoryQuery) (*historyCursor, int64, error) {
+	cursor, err := decodePageToken(query)
+	if err != nil || cursor == nil {
+		return cursor, 0, err
+	}
+
+	id, err := strconv.ParseInt(cursor.ID, 10, 64)
+	if err != nil {
+		return nil, 0, ErrInvalidPageToken
+	}
+	return cursor, id, nil
+}
+
+// Helper function to build a page from the entries of a query that fetched up to Limit+1 entries.
+// The extra entry only tells that there is a next page and is not returned.
+func newHistoryPage(query HistoryQuery, entries []HistoryEntry) HistoryPage {
+	page := HistoryPage{Entries: entries}
+	if page.Entries == nil {
+		page.Entries = []HistoryEntry{}
+	}
+
+	if len(entries) > query.Limit {
+		page.Entries = entries[:query.Limit]
+		page.NextPageToken = encodePageToken(query, page.Entries[query.Limit-1])
+	}
+	return page
+}
+
+// Helper function reporting whether the entry matches the filters of the query
+func matchesHistoryQuery(query HistoryQuery, entry HistoryEntry) bool {
+	if entry.Owner != query.Owner {
+		return false
+	}
+
+	if len(query.Operations) > 0 {
+		found := false
+		for _, operation := range query.Operations {
+			if entry.Operation == operation {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !query.From.IsZero() && entry.Timestamp.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !entry.Timestamp.Before(query.To) {
+		return false
+	}
+	if query.MinResult != nil && entry.Result < *query.MinResult {
+		return false
+	}
+	if query.MaxResult != nil && entry.Result > *query.MaxResult {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Columns of the calculations table in the order scanned by the SQL backends
+const historyColumns = `id, owner, operand1, operand2, operation, result, timestamp, expression,
+	angle_mode, mode, exact_operand1, exact_operand2, exact_result`
+
+// Helper function to build the SELECT statement of a history query for the SQL backends. The placeholder function
+// returns the placeholder of the nth argument (starting at 1), e.g. "?" or "$1", and timestamp converts a time to the
+// stored representation. The statement fetches Limit+1 rows, so newHistoryPage can tell if there is a next page.
+func buildHistorySQL(query HistoryQuery, cursor *historyCursor, cursorID int64, placeholder func(n int) string, timestamp func(time.Time) any) (string, []any) {
+	var conditions []string
+	var args []any
+
+	// Helper function to add an argument and return its placeholder
+	arg := func(value any) string {
+		args = append(args, value)
+		return placeholder(len(args))
+	}
+
+	conditions = append(conditions, "owner = "+arg(query.Owner))
+
+	if len(query.Operations) > 0 {
+		placeholders := make([]string, len(query.Operations))
+		for i, operation := range query.Operations {
+			placeholders[i] = arg(operation)
+		}
+		conditions = append(conditions, "operation IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "timestamp >= "+arg(timestamp(query.From)))
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "timestamp < "+arg(timestamp(query.To)))
+	}
+	if query.MinResult != nil {
+		conditions = append(conditions, "result >= "+arg(*query.MinResult))
+	}
+	if query.MaxResult != nil {
+		conditions = append(conditions, "result <= "+arg(*query.MaxResult))
+	}
+
+	column, direction, comparison := "timestamp", "DESC", "<"
+	if query.SortBy == SortByResult {
+		column = "result"
+	}
+	if query.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	// Continue after the last entry of the previous page. Ties on the sort column are broken by the id.
+	if cursor != nil {
+		var value any = timestamp(cursor.Timestamp)
+		if query.SortBy == SortByResult {
+			value = cursor.Result
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", column, comparison, arg(value), arg(cursorID)))
+	}
+
+	statement := fmt.Sprintf("SELECT %s FROM calculations WHERE %s ORDER BY %s %s, id %s LIMIT %s",
+		historyColumns, strings.Join(conditions, " AND "), column, direction, direction, arg(query.Limit+1))
+	return statement, args
+}
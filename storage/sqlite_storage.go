@@ -0,0 +1,620 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLiteStorage is used to store history in a SQLite database, e.g. for local development
+// and on-prem deployments without access to Firestore.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// Schema of the SQLite database. The timestamp is stored as Unix nanoseconds so that ordering is exact,
+// and the indexes match the owner filter together with the orders supported by QueryHistory. SQLite stores
+// NaN as NULL, so the operands and the result are nullable and NULL is read back as NaN.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS calculations (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner          TEXT    NOT NULL,
+	operand1       REAL,
+	operand2       REAL,
+	operation      TEXT    NOT NULL,
+	result         REAL,
+	timestamp      INTEGER NOT NULL,
+	expression     TEXT    NOT NULL DEFAULT '',
+	angle_mode     TEXT    NOT NULL DEFAULT '',
+	mode           TEXT    NOT NULL DEFAULT '',
+	exact_operand1 TEXT    NOT NULL DEFAULT '',
+	exact_operand2 TEXT    NOT NULL DEFAULT '',
+	exact_result   TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS calculations_owner_timestamp ON calculations (owner, timestamp DESC);
+CREATE INDEX IF NOT EXISTS calculations_owner_result ON calculations (owner, result);
+
+CREATE TABLE IF NOT EXISTS users (
+	username TEXT PRIMARY KEY,
+	password TEXT NOT NULL,
+	role     TEXT NOT NULL DEFAULT 'user'
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id         TEXT    PRIMARY KEY,
+	family     TEXT    NOT NULL,
+	owner      TEXT    NOT NULL,
+	expires_at INTEGER NOT NULL,
+	used       INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family ON refresh_tokens (family);
+CREATE INDEX IF NOT EXISTS refresh_tokens_owner_expires_at ON refresh_tokens (owner, expires_at);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	id         TEXT    PRIMARY KEY,
+	expires_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+	id           TEXT    PRIMARY KEY,
+	hash         TEXT    NOT NULL,
+	owner        TEXT    NOT NULL,
+	name         TEXT    NOT NULL,
+	scopes       TEXT    NOT NULL,
+	created_at   INTEGER NOT NULL,
+	last_used_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_owner_created_at ON api_keys (owner, created_at);
+`
+
+// NewSQLiteStorage creates the tables if they do not exist yet. The database must be opened with a
+// SQLite driver registered as "sqlite", see setup.InitSQLite.
+func NewSQLiteStorage(db *sql.DB) (*SQLiteStorage, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, sqliteSchema)
+	if err != nil {
+		return nil, err
+	}
+	err = addSQLiteColumns(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	err = migrateSQLiteNumberColumns(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLiteStorage{
+		db: db,
+	}, nil
+}
+
+// Columns added to the schema after its tables were first created. CREATE TABLE IF NOT EXISTS does not add
+// them to the tables of existing databases, so addSQLiteColumns does.
+var sqliteAddedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+}
+
+// Helper function to add the sqliteAddedColumns that an existing database does not have yet
+func addSQLiteColumns(ctx context.Context, db *sql.DB) error {
+	for _, added := range sqliteAddedColumns {
+		var exists bool
+		err := db.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)", added.table, added.column,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		_, err = db.ExecContext(ctx, "ALTER TABLE "+added.table+" ADD COLUMN "+added.column+" "+added.definition)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper function to make the operands and the result of a calculations table created before they could be NaN
+// nullable. SQLite cannot drop the NOT NULL constraint of a column, so the table is created again from the
+// schema and the history is copied to it.
+func migrateSQLiteNumberColumns(ctx context.Context, db *sql.DB) error {
+	var notNull bool
+	err := db.QueryRowContext(ctx,
+		`SELECT "notnull" FROM pragma_table_info('calculations') WHERE name = 'result'`,
+	).Scan(&notNull)
+	if err != nil || !notNull {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The indexes keep their names when the table is renamed, so they are dropped for the schema to create them again
+	statements := []string{
+		"DROP INDEX calculations_owner_timestamp",
+		"DROP INDEX calculations_owner_result",
+		"ALTER TABLE calculations RENAME TO calculations_old",
+		sqliteSchema,
+		"INSERT INTO calculations (" + historyColumns + ") SELECT " + historyColumns + " FROM calculations_old",
+		"DROP TABLE calculations_old",
+	}
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Helper function to convert a float to a SQLite argument. NaN is stored as NULL, as SQLite would do anyway.
+func sqliteFloat(value float64) any {
+	if math.IsNaN(value) {
+		return nil
+	}
+	return value
+}
+
+// Helper function to convert a scanned SQLite float back, with NULL as NaN
+func sqliteFloatValue(value sql.NullFloat64) float64 {
+	if !value.Valid {
+		return math.NaN()
+	}
+	return value.Float64
+}
+
+// Statement inserting a history entry, see sqliteHistoryArgs for the arguments
+const sqliteInsertHistory = `
+	INSERT INTO calculations (owner, operand1, operand2, operation, result, timestamp, expression,
+		angle_mode, mode, exact_operand1, exact_operand2, exact_result)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// Helper function to get the arguments of sqliteInsertHistory for the entry
+func sqliteHistoryArgs(entry HistoryEntry) []any {
+	return []any{
+		entry.Owner, sqliteFloat(entry.Operand1), sqliteFloat(entry.Operand2), entry.Operation, sqliteFloat(entry.Result),
+		entry.Timestamp.UnixNano(),
+		entry.Expression, entry.AngleMode, entry.Mode, entry.ExactOperand1, entry.ExactOperand2, entry.ExactResult,
+	}
+}
+
+// Save the history entry to the SQLite database
+func (storage *SQLiteStorage) SaveOperation(ctx context.Context, entry HistoryEntry) error {
+
+	_, err := storage.db.ExecContext(ctx, sqliteInsertHistory, sqliteHistoryArgs(entry)...)
+	return err
+}
+
+// Save the history entries to the SQLite database in a single transaction
+func (storage *SQLiteStorage) SaveOperations(ctx context.Context, entries []HistoryEntry) error {
+
+	tx, err := storage.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statement, err := tx.PrepareContext(ctx, sqliteInsertHistory)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, entry := range entries {
+		_, err = statement.ExecContext(ctx, sqliteHistoryArgs(entry)...)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// The function GetHistory retrieves the owner's history of calculations from the SQLite database sorted by newest
+// operations first. Entries with the same timestamp are returned in reverse insertion order.
+func (storage *SQLiteStorage) GetHistory(ctx context.Context, owner string) ([]HistoryEntry, error) {
+
+	rows, err := storage.db.QueryContext(ctx,
+		"SELECT "+historyColumns+" FROM calculations WHERE owner = ? ORDER BY timestamp DESC, id DESC",
+		owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanSQLiteHistory(rows)
+}
+
+// Query a page of the owner's history from the SQLite database
+func (storage *SQLiteStorage) QueryHistory(ctx context.Context, query HistoryQuery) (HistoryPage, error) {
+
+	query, err := normalizeHistoryQuery(query)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	cursor, cursorID, err := decodeNumericPageToken(query)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+
+	statement, args := buildHistorySQL(query, cursor, cursorID,
+		func(n int) string { return "?" },
+		func(timestamp time.Time) any { return timestamp.UnixNano() },
+	)
+	rows, err := storage.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+
+	entries, err := scanSQLiteHistory(rows)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	return newHistoryPage(query, entries), nil
+}
+
+// Helper function to scan and close the rows of a query selecting the historyColumns
+func scanSQLiteHistory(rows *sql.Rows) ([]HistoryEntry, error) {
+	defer rows.Close()
+
+	var history []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		var id, timestamp int64
+		var operand1, operand2, result sql.NullFloat64
+
+		err := rows.Scan(&id, &entry.Owner, &operand1, &operand2, &entry.Operation, &result, &timestamp,
+			&entry.Expression, &entry.AngleMode, &entry.Mode, &entry.ExactOperand1, &entry.ExactOperand2, &entry.ExactResult)
+		if err != nil {
+			return nil, err
+		}
+		entry.ID = strconv.FormatInt(id, 10)
+		entry.Operand1 = sqliteFloatValue(operand1)
+		entry.Operand2 = sqliteFloatValue(operand2)
+		entry.Result = sqliteFloatValue(result)
+		entry.Timestamp = time.Unix(0, timestamp).UTC()
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
+}
+
+// Reset the owner's history in the SQLite database
+func (storage *SQLiteStorage) ResetHistory(ctx context.Context, owner string) error {
+
+	_, err := storage.db.ExecContext(ctx, "DELETE FROM calculations WHERE owner = ?", owner)
+	return err
+}
+
+// RegisterUser stores the username and bcrypt hash of the password in the SQLite database.
+func (storage *SQLiteStorage) RegisterUser(ctx context.Context, username string, password string) error {
+
+	// Hash the password
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// The primary key on username makes the insert a no-op if the user already exists
+	result, err := storage.db.ExecContext(ctx,
+		"INSERT INTO users (username, password) VALUES (?, ?) ON CONFLICT (username) DO NOTHING",
+		username, hashedPassword,
+	)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrUserExists
+	}
+
+	return nil
+}
+
+// AuthenticateUser retrieves the stored hashed password and checks it against the hash of the provided password.
+func (storage *SQLiteStorage) AuthenticateUser(ctx context.Context, username string, password string) error {
+
+	var hashedPassword string
+	err := storage.db.QueryRowContext(ctx, "SELECT password FROM users WHERE username = ?", username).Scan(&hashedPassword)
+	if errors.Is(err, sql.ErrNoRows) {
+		checkPasswordHash(password, dummyPasswordHash())
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// Check if the provided password matches the stored hash
+	correctPassword := checkPasswordHash(password, hashedPassword)
+	if !correctPassword {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// Get the user from the SQLite database without the password
+func (storage *SQLiteStorage) GetUser(ctx context.Context, username string) (User, error) {
+
+	user := User{Username: username}
+	err := storage.db.QueryRowContext(ctx, "SELECT role FROM users WHERE username = ?", username).Scan(&user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+// List the users of the SQLite database without their passwords
+func (storage *SQLiteStorage) ListUsers(ctx context.Context) ([]User, error) {
+
+	rows, err := storage.db.QueryContext(ctx, "SELECT username, role FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.Username, &user.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// Set the role of the user in the SQLite database
+func (storage *SQLiteStorage) SetUserRole(ctx context.Context, username string, role string) error {
+	if !validRole(role) {
+		return ErrInvalidRole
+	}
+
+	result, err := storage.db.ExecContext(ctx, "UPDATE users SET role = ? WHERE username = ?", role, username)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// Save the refresh token to the SQLite database, deleting the expired tokens of the owner
+func (storage *SQLiteStorage) SaveRefreshToken(ctx context.Context, token RefreshToken) error {
+
+	tx, err := storage.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE owner = ? AND expires_at < ?", token.Owner, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (id, family, owner, expires_at, used) VALUES (?, ?, ?, ?, ?)",
+		token.ID, token.Family, token.Owner, token.ExpiresAt.UnixNano(), token.Used,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Get the refresh token from the SQLite database
+func (storage *SQLiteStorage) GetRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+
+	token := RefreshToken{ID: id}
+	var expiresAt int64
+	err := storage.db.QueryRowContext(ctx,
+		"SELECT family, owner, expires_at, used FROM refresh_tokens WHERE id = ?", id,
+	).Scan(&token.Family, &token.Owner, &expiresAt, &token.Used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, ErrTokenNotFound
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	token.ExpiresAt = time.Unix(0, expiresAt).UTC()
+	return token, nil
+}
+
+// Mark the refresh token in the SQLite database as used. The update only matches an unused token,
+// so of two concurrent uses of the same token only one succeeds.
+func (storage *SQLiteStorage) UseRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+
+	token := RefreshToken{ID: id}
+	var expiresAt int64
+	err := storage.db.QueryRowContext(ctx,
+		"UPDATE refresh_tokens SET used = 1 WHERE id = ? AND used = 0 RETURNING family, owner, expires_at",
+		id,
+	).Scan(&token.Family, &token.Owner, &expiresAt)
+	if err == nil {
+		token.ExpiresAt = time.Unix(0, expiresAt).UTC()
+		return token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, err
+	}
+
+	// The token is either unknown or was used before
+	err = storage.db.QueryRowContext(ctx,
+		"SELECT family, owner, expires_at, used FROM refresh_tokens WHERE id = ?", id,
+	).Scan(&token.Family, &token.Owner, &expiresAt, &token.Used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, ErrTokenNotFound
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	token.ExpiresAt = time.Unix(0, expiresAt).UTC()
+	return token, ErrTokenUsed
+}
+
+// Delete the refresh tokens of the family from the SQLite database
+func (storage *SQLiteStorage) RevokeRefreshTokens(ctx context.Context, family string) error {
+
+	_, err := storage.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE family = ?", family)
+	return err
+}
+
+// Add the access token to the revoked tokens in the SQLite database, deleting the revocations that have expired
+func (storage *SQLiteStorage) RevokeAccessToken(ctx context.Context, id string, expiresAt time.Time) error {
+
+	tx, err := storage.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO revoked_tokens (id, expires_at) VALUES (?, ?) ON CONFLICT (id) DO NOTHING",
+		id, expiresAt.UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Check whether the access token is revoked in the SQLite database
+func (storage *SQLiteStorage) IsAccessTokenRevoked(ctx context.Context, id string) (bool, error) {
+
+	var revoked bool
+	err := storage.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE id = ?)", id).Scan(&revoked)
+	return revoked, err
+}
+
+// Columns of an API key in the order scanned by scanSQLiteAPIKey
+const sqliteAPIKeyColumns = "id, hash, owner, name, scopes, created_at, last_used_at"
+
+// Helper function to scan an API key selected with the sqliteAPIKeyColumns. The scopes are stored space separated,
+// and a key that was never used has 0 as last-used time.
+func scanSQLiteAPIKey(row interface{ Scan(...any) error }) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	var createdAt, lastUsedAt int64
+
+	err := row.Scan(&key.ID, &key.Hash, &key.Owner, &key.Name, &scopes, &createdAt, &lastUsedAt)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.CreatedAt = time.Unix(0, createdAt).UTC()
+	if lastUsedAt != 0 {
+		key.LastUsedAt = time.Unix(0, lastUsedAt).UTC()
+	}
+	return key, nil
+}
+
+// Save the API key to the SQLite database
+func (storage *SQLiteStorage) CreateAPIKey(ctx context.Context, key APIKey) error {
+
+	var lastUsedAt int64
+	if !key.LastUsedAt.IsZero() {
+		lastUsedAt = key.LastUsedAt.UnixNano()
+	}
+	_, err := storage.db.ExecContext(ctx,
+		"INSERT INTO api_keys ("+sqliteAPIKeyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		key.ID, key.Hash, key.Owner, key.Name, strings.Join(key.Scopes, " "), key.CreatedAt.UnixNano(), lastUsedAt,
+	)
+	return err
+}
+
+// Get the API key from the SQLite database
+func (storage *SQLiteStorage) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+
+	row := storage.db.QueryRowContext(ctx, "SELECT "+sqliteAPIKeyColumns+" FROM api_keys WHERE id = ?", id)
+	key, err := scanSQLiteAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// List the API keys of the owner in the SQLite database, oldest first
+func (storage *SQLiteStorage) ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error) {
+
+	rows, err := storage.db.QueryContext(ctx,
+		"SELECT "+sqliteAPIKeyColumns+" FROM api_keys WHERE owner = ? ORDER BY created_at, id", owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanSQLiteAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Delete the API key of the owner from the SQLite database
+func (storage *SQLiteStorage) DeleteAPIKey(ctx context.Context, owner string, id string) error {
+
+	result, err := storage.db.ExecContext(ctx, "DELETE FROM api_keys WHERE id = ? AND owner = ?", id, owner)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Set the last-used time of the API key in the SQLite database
+func (storage *SQLiteStorage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+
+	result, err := storage.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", usedAt.UnixNano(), id)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	_ "modernc.org/sqlite"
+)
+
+// Helper function to create a SQLite storage backed by an in-memory database
+func setupSQLiteStorage(t *testing.T) *SQLiteStorage {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	db.SetMaxOpenConns(1) // Every connection to ":memory:" would otherwise get its own database
+	t.Cleanup(func() { db.Close() })
+
+	// Keep password hashing fast in tests
+	passwordHashCost = bcrypt.MinCost
+	t.Cleanup(func() { passwordHashCost = 14 })
+
+	storage, err := NewSQLiteStorage(db)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	return storage
+}
+
+func TestSQLiteStorageSaveAndGetHistory(t *testing.T) {
+	storage := setupSQLiteStorage(t)
+
+	timestamp := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	entry := HistoryEntry{
+		Operand1:      1,
+		Operand2:      3,
+		Operation:     "Divide",
+		Result:        1.0 / 3,
+		Timestamp:     timestamp,
+		Owner:         "alice",
+		Mode:          "rational",
+		ExactOperand1: "1",
+		ExactOperand2: "3",
+		ExactResult:   "1/3",
+	}
+
+	err := storage.SaveOperation(context.Background(), entry)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	history, err := storage.GetHistory(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("Expected 1 history entry but got %d", len(history))
+	}
+	if history[0].ID != "1" {
+		t.Errorf("Expected ID 1 but got %q", history[0].ID)
+	}
+	entry.ID = history[0].ID
+	if history[0] != entry {
+		t.Errorf("Expected %+v but got %+v", entry, history[0])
+	}
+}
+
+func TestSQLiteStorageHistoryNewestFirst(t *testing.T) {
+	storage := setupSQLiteStorage(t)
+
+	start := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	storage.SaveOperation(context.Background(), HistoryEntry{Operation: "Add", Owner: "alice", Timestamp: start})
+	storage.SaveOperation(context.Background(), HistoryEntry{Operation: "Multiply", Owner: "alice", Timestamp: start.Add(2 * time.Second)})
+	storage.SaveOperation(context.Background(), HistoryEntry{Operation: "Subtract", Owner: "alice", Timestamp: start.Add(time.Second)})
+
+	history, err := storage.GetHistory(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	expected := []string{"Multiply", "Subtract", "Add"}
+	if len(history) != len(expected) {
+		t.Fatalf("Expected %d history entries but got %d", len(expected), len(history))
+	}
+	for i, operation := range expected {
+		if history[i].Operation != operation {
+			t.Errorf("Expected %s at position %d but got %s", operation, i, history[i].Operation)
+		}
+	}
+}
+
+func TestSQLiteStorageResetHistoryOnlyAffectsOwner(t *testing.T) {
+	storage := setupSQLiteStorage(t)
+
+	storage.SaveOperation(context.Background(), HistoryEntry{Operation: "Add", Owner: "alice", Timestamp: time.Now()})
+	storage.SaveOperation(context.Background(), HistoryEntry{Operation: "Subtract", Owner: "bob", Timestamp: time.Now()})
+
+	err := storage.ResetHistory(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	history, err := storage.GetHistory(context.Background(), "alice")
+	if err != nil || len(history) != 0 {
+		t.Errorf("Expected no history for alice but got %+v (%v)", history, err)
+	}
+
+	history, err = storage.GetHistory(context.Background(), "bob")
+	if err != nil || len(history) != 1 {
+		t.Errorf("Expected bob's history to be kept but got %+v (%v)", history, err)
+	}
+}
+
+func TestSQLiteStorageRegisterAndAuthenticate(t *testing.T) {
+	storage := setupSQLiteStorage(t)
+
+	err := storage.RegisterUser(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	// The password must be stored as a bcrypt hash, not in plain text
+	var storedPassword string
+	storage.db.QueryRow("SELECT password FROM users WHERE username = ?", "alice").Scan(&storedPassword)
+	if storedPassword == "secret" || !checkPasswordHash("secret", storedPassword) {
+		t.Errorf("Expected a bcrypt hash of the password but got %q", storedPassword)
+	}
+
+	err = storage.RegisterUser(context.Background(), "alice", "other")
+	if err == nil || err.Error() != "user already exists" {
+		t.Errorf("Expected user already exists but got %v", err)
+	}
+
+	err = storage.AuthenticateUser(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+
+	err = storage.AuthenticateUser(context.Background(), "alice", "wrong")
+	if err == nil {
+		t.Errorf("Expected an error for a wrong password")
+	}
+
+	err = storage.AuthenticateUser(context.Background(), "bob", "secret")
+	if err == nil {
+		t.Errorf("Expected an error for an unknown user")
+	}
+}
+
+func TestSQLiteStorageAddsColumnsToExistingDatabase(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	// A users table created before roles were added
+	_, err = db.Exec("CREATE TABLE users (username TEXT PRIMARY KEY, password TEXT NOT NULL)")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	_, err = db.Exec("INSERT INTO users (username, password) VALUES ('alice', 'hash')")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	storage, err := NewSQLiteStorage(db)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	user, err := storage.GetUser(context.Background(), "alice")
+	if err != nil || user.Role != RoleUser {
+		t.Errorf("Expected alice with the user role but got %+v, %v", user, err)
+	}
+
+	// Opening the database again must not add the columns twice
+	_, err = NewSQLiteStorage(db)
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+}
+
+func TestSQLiteStorageMigratesNumberColumnsToNullable(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	// A calculations table created before NaN could be stored
+	_, err = db.Exec(`
+		CREATE TABLE calculations (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			owner          TEXT    NOT NULL,
+			operand1       REAL    NOT NULL,
+			operand2       REAL    NOT NULL,
+			operation      TEXT    NOT NULL,
+			result         REAL    NOT NULL,
+			timestamp      INTEGER NOT NULL,
+			expression     TEXT    NOT NULL DEFAULT '',
+			angle_mode     TEXT    NOT NULL DEFAULT '',
+			mode           TEXT    NOT NULL DEFAULT '',
+			exact_operand1 TEXT    NOT NULL DEFAULT '',
+			exact_operand2 TEXT    NOT NULL DEFAULT '',
+			exact_result   TEXT    NOT NULL DEFAULT ''
+		);
+		CREATE INDEX calculations_owner_timestamp ON calculations (owner, timestamp DESC);
+		CREATE INDEX calculations_owner_result ON calculations (owner, result);
+		INSERT INTO calculations (owner, operand1, operand2, operation, result, timestamp) VALUES ('alice', 1, 2, 'Add', 3, 1);`)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	storage, err := NewSQLiteStorage(db)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	err = storage.SaveOperation(context.Background(), HistoryEntry{
+		Operation: "Add", Operand1: math.Inf(1), Operand2: math.Inf(-1), Result: math.NaN(), Owner: "alice", Timestamp: time.Unix(0, 2),
+	})
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	history, err := storage.GetHistory(context.Background(), "alice")
+	if err != nil || len(history) != 2 {
+		t.Fatalf("Expected 2 history entries but got %+v, %v", history, err)
+	}
+	if !math.IsNaN(history[0].Result) || history[1].Result != 3 || history[1].ID != "1" {
+		t.Errorf("Expected the NaN result and the copied entry but got %+v", history)
+	}
+
+	// Opening the database again must not copy the table again
+	_, err = NewSQLiteStorage(db)
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+}
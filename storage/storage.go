@@ -1,37 +1,118 @@
 package storage
 
 import (
+	"context"
 	"time"
 )
 
 // HistoryEntry represents a calculator operation in history.
 type HistoryEntry struct {
+	ID        string    // Identifier assigned by the storage when the entry is saved
 	Operand1  float64   // Left operand in expression
 	Operand2  float64   // Right operand in expression
 	Operation string    // +, -, *, /, %, ^
 	Result    float64   // Result after applying the operation
 	Timestamp time.Time // When the operation was performed
+	Owner     string    // Username of the user who performed the operation
+
+	Expression string // Infix expression for "Evaluate" operations (operands are unused)
+	AngleMode  string // "degrees" or "radians" for trigonometric operations
+
+	// Operations in an exact precision mode store the lossless string representations of the numbers
+	// below, while the float64 fields above hold their closest approximation.
+	Mode          string // Precision mode, e.g. "decimal". Empty for regular float64 operations
+	ExactOperand1 string
+	ExactOperand2 string
+	ExactResult   string
 }
 
 type User struct {
 	Username string
 	Password string
+	Role     string `json:"-"` // RoleUser, RoleAdmin or RoleReadOnly. Set by the storage, never by the client
+}
+
+// Roles of the users. New users get RoleUser, and other roles are given with SetUserRole.
+const (
+	RoleUser     = "user"      // Calculates and manages the own history
+	RoleAdmin    = "admin"     // Also manages the other users
+	RoleReadOnly = "read-only" // Only reads the own history
+)
+
+// Roles lists the valid roles
+var Roles = []string{RoleUser, RoleAdmin, RoleReadOnly}
+
+// RefreshToken is a refresh token issued at login. Only the hash of the token is stored, so the stored tokens
+// cannot be used to refresh. Each token is used once: refreshing returns a new token of the same family.
+type RefreshToken struct {
+	ID        string    // SHA-256 hash of the token
+	Family    string    // Shared by the tokens rotated from the same login, so they can be revoked together
+	Owner     string    // Username of the user the token was issued to
+	ExpiresAt time.Time // When the token can no longer be used
+	Used      bool      // Whether the token was already exchanged for a new one
+}
+
+// APIKey is a key with which a program calls the API as its owner without logging in. Only the hash of the
+// secret part of the key is stored.
+type APIKey struct {
+	ID         string    // Public part of the key, which identifies it
+	Hash       string    // SHA-256 hash of the secret part of the key
+	Owner      string    // Username of the user the key acts as
+	Name       string    // Given by the owner, e.g. "nightly batch"
+	Scopes     []string  // What the key may be used for, e.g. "calculate"
+	CreatedAt  time.Time // When the key was created
+	LastUsedAt time.Time // When the key was last used. Zero if it was never used
 }
 
 func NewUser(username string, password string) *User {
 	return &User{
 		Username: username,
 		Password: password,
+		Role:     RoleUser,
 	}
 }
 
+// Storage is implemented by the storage backends. Every method stops when ctx is cancelled, e.g. when the client
+// disconnects, and the errors can be checked with errors.Is against ErrNotFound, ErrConflict and ErrTimeout.
+// Use WithDeadlines to limit how long each operation may take.
 type Storage interface {
-	// Operations methods related to calculator history
-	SaveOperation(entry HistoryEntry) error
-	GetHistory() ([]HistoryEntry, error)
-	ResetHistory() error
+	// Operations methods related to calculator history. History is scoped to the owner (username).
+	SaveOperation(ctx context.Context, entry HistoryEntry) error
+	SaveOperations(ctx context.Context, entries []HistoryEntry) error // Saves all entries in a single write, or none of them
+	GetHistory(ctx context.Context, owner string) ([]HistoryEntry, error)
+	QueryHistory(ctx context.Context, query HistoryQuery) (HistoryPage, error)
+	ResetHistory(ctx context.Context, owner string) error
 
 	// User related methods
-	RegisterUser(username string, password string) error
-	AuthenticateUser(username string, password string) error
+	RegisterUser(ctx context.Context, username string, password string) error
+	AuthenticateUser(ctx context.Context, username string, password string) error
+	GetUser(ctx context.Context, username string) (User, error) // Returns the user without the password
+	ListUsers(ctx context.Context) ([]User, error)              // Returns the users without passwords, sorted by username
+	SetUserRole(ctx context.Context, username string, role string) error
+
+	// Token related methods. Refresh tokens are keyed by their ID, and revoked access tokens are kept by their
+	// ID (the "jti" claim) until they expire.
+	SaveRefreshToken(ctx context.Context, token RefreshToken) error
+	GetRefreshToken(ctx context.Context, id string) (RefreshToken, error) // Returns the token without using it
+	UseRefreshToken(ctx context.Context, id string) (RefreshToken, error) // Marks the token used. Returns ErrTokenUsed with the token if it already was
+	RevokeRefreshTokens(ctx context.Context, family string) error         // Deletes every token of the family
+	RevokeAccessToken(ctx context.Context, id string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, id string) (bool, error)
+
+	// API key related methods. Keys are found by their ID, and listed and deleted by their owner.
+	CreateAPIKey(ctx context.Context, key APIKey) error
+	GetAPIKey(ctx context.Context, id string) (APIKey, error)
+	ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error)    // Sorted by creation time, oldest first
+	DeleteAPIKey(ctx context.Context, owner string, id string) error    // Returns ErrAPIKeyNotFound if the owner has no such key
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error // Sets the last-used time of the key
+}
+
+// Helper function reporting whether the role is one of Roles
+func validRole(role string) bool {
+	for _, valid := range Roles {
+		if role == valid {
+			return true
+		}
+	}
+	return false
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"testing"
 )
 
@@ -18,7 +19,7 @@ func TestLocalStorageSave(t *testing.T) {
 		Result:    8,
 	}
 
-	err := storage.SaveOperation(entry)
+	err := storage.SaveOperation(context.Background(), entry)
 	if err != nil {
 		t.Errorf("Expected nil but got %s", err)
 	}
@@ -54,9 +55,9 @@ func TestLocalStorageGetHistory(t *testing.T) {
 		Operation: "Add",
 		Result:    8,
 	}
-	storage.SaveOperation(entry)
+	storage.SaveOperation(context.Background(), entry)
 
-	history, err := storage.GetHistory()
+	history, err := storage.GetHistory(context.Background(), "")
 	if err != nil {
 		t.Errorf("Expected nil but got %s", err)
 	}
@@ -92,9 +93,9 @@ func TestLocalStorageResetHistory(t *testing.T) {
 		Operation: "Add",
 		Result:    8,
 	}
-	storage.SaveOperation(entry)
+	storage.SaveOperation(context.Background(), entry)
 
-	err := storage.ResetHistory()
+	err := storage.ResetHistory(context.Background(), "")
 	if err != nil {
 		t.Errorf("Expected nil but got %s", err)
 	}
@@ -115,10 +116,10 @@ func TestLocalStorageResetHistoryManyEntries(t *testing.T) {
 			Operation: "Add",
 			Result:    8, // Just a placeholder value
 		}
-		storage.SaveOperation(entry)
+		storage.SaveOperation(context.Background(), entry)
 	}
 
-	err := storage.ResetHistory()
+	err := storage.ResetHistory(context.Background(), "")
 	if err != nil {
 		t.Errorf("Expected nil but got %s", err)
 	}
@@ -131,7 +132,7 @@ func TestLocalStorageResetHistoryManyEntries(t *testing.T) {
 func TestLocalStorageResetHistoryEmpty(t *testing.T) {
 	storage := setupLocalStorage()
 
-	err := storage.ResetHistory()
+	err := storage.ResetHistory(context.Background(), "")
 	if err != nil {
 		t.Errorf("Expected nil but got %s", err)
 	}
@@ -140,3 +141,53 @@ func TestLocalStorageResetHistoryEmpty(t *testing.T) {
 		t.Errorf("Expected 0 history entry but got %d", len(storage.history))
 	}
 }
+
+func TestLocalStorageHistoryIsolatedBetweenUsers(t *testing.T) {
+	storage := setupLocalStorage()
+
+	storage.SaveOperation(context.Background(), HistoryEntry{Operand1: 1, Operand2: 2, Operation: "Add", Result: 3, Owner: "alice"})
+	storage.SaveOperation(context.Background(), HistoryEntry{Operand1: 5, Operand2: 3, Operation: "Subtract", Result: 2, Owner: "bob"})
+	storage.SaveOperation(context.Background(), HistoryEntry{Operand1: 2, Operand2: 2, Operation: "Multiply", Result: 4, Owner: "alice"})
+
+	history, err := storage.GetHistory(context.Background(), "alice")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 history entries but got %d", len(history))
+	}
+	for _, entry := range history {
+		if entry.Owner != "alice" {
+			t.Errorf("Expected only entries owned by alice but got %+v", entry)
+		}
+	}
+
+	history, err = storage.GetHistory(context.Background(), "bob")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+	if len(history) != 1 || history[0].Operation != "Subtract" {
+		t.Errorf("Expected bob's Subtract entry but got %+v", history)
+	}
+}
+
+func TestLocalStorageResetHistoryOnlyAffectsOwner(t *testing.T) {
+	storage := setupLocalStorage()
+
+	storage.SaveOperation(context.Background(), HistoryEntry{Operand1: 1, Operand2: 2, Operation: "Add", Result: 3, Owner: "alice"})
+	storage.SaveOperation(context.Background(), HistoryEntry{Operand1: 5, Operand2: 3, Operation: "Subtract", Result: 2, Owner: "bob"})
+
+	err := storage.ResetHistory(context.Background(), "alice")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+
+	if history, err := storage.GetHistory(context.Background(), "alice"); err != nil || len(history) != 0 {
+		t.Errorf("Expected no history for alice but got %+v (%v)", history, err)
+	}
+
+	history, err := storage.GetHistory(context.Background(), "bob")
+	if err != nil || len(history) != 1 {
+		t.Errorf("Expected bob's history to be kept but got %+v (%v)", history, err)
+	}
+}
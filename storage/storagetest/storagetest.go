@@ -0,0 +1,977 @@
+// The package storagetest contains a conformance suite that every storage.Storage implementation must pass,
+// so that the backends behave the same regardless of which one the server is configured with.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"overengineered_calculator/storage"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory returns a new, empty storage for a single test. It should register any cleanup with t.Cleanup
+// and call t.Skip if the backend is not available, e.g. when a database server is not running.
+type Factory func(t *testing.T) storage.Storage
+
+// RunSuite runs the conformance tests against storages created by newStorage. Usage:
+//
+//	func TestSQLiteStorageConformance(t *testing.T) {
+//		storagetest.RunSuite(t, func(t *testing.T) storage.Storage { ... })
+//	}
+func RunSuite(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, storage storage.Storage)
+	}{
+		{"SaveAndGetHistory", testSaveAndGetHistory},
+		{"EmptyHistory", testEmptyHistory},
+		{"HistoryNewestFirst", testHistoryNewestFirst},
+		{"HistoryIsolatedBetweenOwners", testHistoryIsolatedBetweenOwners},
+		{"ResetHistory", testResetHistory},
+		{"ResetEmptyHistory", testResetEmptyHistory},
+		{"RegisterAndAuthenticate", testRegisterAndAuthenticate},
+		{"DuplicateRegistration", testDuplicateRegistration},
+		{"WrongPassword", testWrongPassword},
+		{"UnknownUser", testUnknownUser},
+		{"GetUser", testGetUser},
+		{"ListUsers", testListUsers},
+		{"SetUserRole", testSetUserRole},
+		{"ConcurrentSaves", testConcurrentSaves},
+		{"ConcurrentRegistration", testConcurrentRegistration},
+		{"CancelledContext", testCancelledContext},
+		{"SaveOperations", testSaveOperations},
+		{"SaveOperationsEmpty", testSaveOperationsEmpty},
+		{"SaveOperationsCancelledContext", testSaveOperationsCancelledContext},
+		{"SaveNonFiniteNumbers", testSaveNonFiniteNumbers},
+		{"QueryHistoryPagination", testQueryHistoryPagination},
+		{"QueryHistoryPaginationWithEqualTimestamps", testQueryHistoryPaginationWithEqualTimestamps},
+		{"QueryHistoryFilters", testQueryHistoryFilters},
+		{"QueryHistorySortByResult", testQueryHistorySortByResult},
+		{"QueryHistoryInvalidPageToken", testQueryHistoryInvalidPageToken},
+		{"QueryHistoryPaginationWithNonFiniteResults", testQueryHistoryPaginationWithNonFiniteResults},
+		{"QueryHistoryTooManyOperations", testQueryHistoryTooManyOperations},
+		{"GetRefreshToken", testGetRefreshToken},
+		{"UseRefreshToken", testUseRefreshToken},
+		{"RefreshTokenUsedTwice", testRefreshTokenUsedTwice},
+		{"UnknownRefreshToken", testUnknownRefreshToken},
+		{"RevokeRefreshTokens", testRevokeRefreshTokens},
+		{"ConcurrentRefreshTokenUse", testConcurrentRefreshTokenUse},
+		{"RevokeAccessToken", testRevokeAccessToken},
+		{"CreateAndGetAPIKey", testCreateAndGetAPIKey},
+		{"UnknownAPIKey", testUnknownAPIKey},
+		{"ListAPIKeys", testListAPIKeys},
+		{"DeleteAPIKey", testDeleteAPIKey},
+		{"TouchAPIKey", testTouchAPIKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newStorage(t))
+		})
+	}
+}
+
+// Timestamps are whole seconds, so they survive backends that store less than nanosecond precision
+var start = time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+
+// Helper function to save an entry and fail the test on error
+func save(t *testing.T, storage storage.Storage, entry storage.HistoryEntry) {
+	t.Helper()
+	err := storage.SaveOperation(context.Background(), entry)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+}
+
+// Helper function to get the history of the owner and fail the test on error
+func history(t *testing.T, storage storage.Storage, owner string) []storage.HistoryEntry {
+	t.Helper()
+	history, err := storage.GetHistory(context.Background(), owner)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	return history
+}
+
+func testSaveAndGetHistory(t *testing.T, store storage.Storage) {
+	entry := storage.HistoryEntry{
+		Operand1:      1,
+		Operand2:      3,
+		Operation:     "Divide",
+		Result:        1.0 / 3,
+		Timestamp:     start,
+		Owner:         "alice",
+		Expression:    "",
+		AngleMode:     "",
+		Mode:          "rational",
+		ExactOperand1: "1",
+		ExactOperand2: "3",
+		ExactResult:   "1/3",
+	}
+	save(t, store, entry)
+
+	entries := history(t, store, "alice")
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 history entry but got %d", len(entries))
+	}
+
+	// The ID is assigned by the backend, and backends may return the timestamp in another location,
+	// so compare them separately
+	actual := entries[0]
+	if actual.ID == "" {
+		t.Errorf("Expected the saved entry to have an ID")
+	}
+	entry.ID = actual.ID
+	if !actual.Timestamp.Equal(entry.Timestamp) {
+		t.Errorf("Expected timestamp %v but got %v", entry.Timestamp, actual.Timestamp)
+	}
+	actual.Timestamp = entry.Timestamp
+	if actual != entry {
+		t.Errorf("Expected %+v but got %+v", entry, actual)
+	}
+}
+
+func testEmptyHistory(t *testing.T, store storage.Storage) {
+	entries := history(t, store, "alice")
+	if len(entries) != 0 {
+		t.Errorf("Expected an empty history but got %+v", entries)
+	}
+}
+
+func testHistoryNewestFirst(t *testing.T, store storage.Storage) {
+	save(t, store, storage.HistoryEntry{Operation: "Add", Owner: "alice", Timestamp: start})
+	save(t, store, storage.HistoryEntry{Operation: "Multiply", Owner: "alice", Timestamp: start.Add(2 * time.Second)})
+	save(t, store, storage.HistoryEntry{Operation: "Subtract", Owner: "alice", Timestamp: start.Add(time.Second)})
+
+	entries := history(t, store, "alice")
+
+	expected := []string{"Multiply", "Subtract", "Add"}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d history entries but got %d", len(expected), len(entries))
+	}
+	for i, operation := range expected {
+		if entries[i].Operation != operation {
+			t.Errorf("Expected %s at position %d but got %s", operation, i, entries[i].Operation)
+		}
+	}
+}
+
+func testHistoryIsolatedBetweenOwners(t *testing.T, store storage.Storage) {
+	save(t, store, storage.HistoryEntry{Operation: "Add", Owner: "alice", Timestamp: start})
+	save(t, store, storage.HistoryEntry{Operation: "Subtract", Owner: "bob", Timestamp: start})
+
+	entries := history(t, store, "alice")
+	if len(entries) != 1 || entries[0].Operation != "Add" {
+		t.Errorf("Expected only alice's Add entry but got %+v", entries)
+	}
+
+	entries = history(t, store, "bob")
+	if len(entries) != 1 || entries[0].Operation != "Subtract" {
+		t.Errorf("Expected only bob's Subtract entry but got %+v", entries)
+	}
+}
+
+func testResetHistory(t *testing.T, store storage.Storage) {
+	for i := 0; i < 10; i++ {
+		save(t, store, storage.HistoryEntry{Operation: "Add", Owner: "alice", Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+	save(t, store, storage.HistoryEntry{Operation: "Subtract", Owner: "bob", Timestamp: start})
+
+	err := store.ResetHistory(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	if entries := history(t, store, "alice"); len(entries) != 0 {
+		t.Errorf("Expected an empty history after reset but got %d entries", len(entries))
+	}
+	if entries := history(t, store, "bob"); len(entries) != 1 {
+		t.Errorf("Expected bob's history to be kept but got %d entries", len(entries))
+	}
+}
+
+func testResetEmptyHistory(t *testing.T, store storage.Storage) {
+	err := store.ResetHistory(context.Background(), "alice")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+}
+
+func testRegisterAndAuthenticate(t *testing.T, store storage.Storage) {
+	err := store.RegisterUser(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	err = store.AuthenticateUser(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+}
+
+func testDuplicateRegistration(t *testing.T, store storage.Storage) {
+	err := store.RegisterUser(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	err = store.RegisterUser(context.Background(), "alice", "other")
+	if !errors.Is(err, storage.ErrUserExists) || !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("Expected user already exists but got %v", err)
+	}
+
+	// The original password must still be valid
+	err = store.AuthenticateUser(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+}
+
+func testWrongPassword(t *testing.T, store storage.Storage) {
+	err := store.RegisterUser(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	err = store.AuthenticateUser(context.Background(), "alice", "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("Expected invalid credentials but got %v", err)
+	}
+}
+
+func testUnknownUser(t *testing.T, store storage.Storage) {
+	err := store.AuthenticateUser(context.Background(), "nobody", "secret")
+	if !errors.Is(err, storage.ErrUserNotFound) || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected user not found but got %v", err)
+	}
+}
+
+func testGetUser(t *testing.T, store storage.Storage) {
+	err := store.RegisterUser(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	// New users get the user role, and the password is not returned
+	user, err := store.GetUser(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	if user != (storage.User{Username: "alice", Role: storage.RoleUser}) {
+		t.Errorf("Expected alice with the user role but got %+v", user)
+	}
+
+	_, err = store.GetUser(context.Background(), "nobody")
+	if !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("Expected user not found but got %v", err)
+	}
+}
+
+func testListUsers(t *testing.T, store storage.Storage) {
+	users, err := store.ListUsers(context.Background())
+	if err != nil || len(users) != 0 {
+		t.Fatalf("Expected no users but got %+v, %v", users, err)
+	}
+
+	for _, username := range []string{"carol", "alice", "bob"} {
+		err := store.RegisterUser(context.Background(), username, "secret")
+		if err != nil {
+			t.Fatalf("Expected nil but got %s", err)
+		}
+	}
+
+	users, err = store.ListUsers(context.Background())
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	expected := []storage.User{
+		{Username: "alice", Role: storage.RoleUser},
+		{Username: "bob", Role: storage.RoleUser},
+		{Username: "carol", Role: storage.RoleUser},
+	}
+	if fmt.Sprint(users) != fmt.Sprint(expected) {
+		t.Errorf("Expected %+v but got %+v", expected, users)
+	}
+}
+
+func testSetUserRole(t *testing.T, store storage.Storage) {
+	err := store.RegisterUser(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	err = store.SetUserRole(context.Background(), "alice", storage.RoleAdmin)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	user, err := store.GetUser(context.Background(), "alice")
+	if err != nil || user.Role != storage.RoleAdmin {
+		t.Errorf("Expected the admin role but got %+v, %v", user, err)
+	}
+
+	// The password is kept
+	err = store.AuthenticateUser(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+
+	err = store.SetUserRole(context.Background(), "alice", "superuser")
+	if !errors.Is(err, storage.ErrInvalidRole) {
+		t.Errorf("Expected invalid role but got %v", err)
+	}
+	err = store.SetUserRole(context.Background(), "nobody", storage.RoleAdmin)
+	if !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("Expected user not found but got %v", err)
+	}
+}
+
+func testConcurrentSaves(t *testing.T, store storage.Storage) {
+	const workers = 10
+	const savesPerWorker = 10
+
+	var wait sync.WaitGroup
+	errs := make(chan error, workers*savesPerWorker)
+	for worker := 0; worker < workers; worker++ {
+		wait.Add(1)
+		go func(worker int) {
+			defer wait.Done()
+			owner := fmt.Sprintf("user%d", worker%2)
+			for i := 0; i < savesPerWorker; i++ {
+				errs <- store.SaveOperation(context.Background(), storage.HistoryEntry{
+					Operand1:  float64(worker),
+					Operand2:  float64(i),
+					Operation: "Add",
+					Result:    float64(worker + i),
+					Owner:     owner,
+					Timestamp: start.Add(time.Duration(worker*savesPerWorker+i) * time.Second),
+				})
+			}
+		}(worker)
+	}
+	wait.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Expected nil but got %s", err)
+		}
+	}
+
+	total := len(history(t, store, "user0")) + len(history(t, store, "user1"))
+	if total != workers*savesPerWorker {
+		t.Errorf("Expected %d history entries but got %d", workers*savesPerWorker, total)
+	}
+}
+
+func testConcurrentRegistration(t *testing.T, store storage.Storage) {
+	const workers = 5
+
+	var wait sync.WaitGroup
+	errs := make(chan error, workers)
+	for worker := 0; worker < workers; worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			errs <- store.RegisterUser(context.Background(), "alice", "secret")
+		}()
+	}
+	wait.Wait()
+	close(errs)
+
+	// Exactly one of the registrations of the same username must succeed
+	registered := 0
+	for err := range errs {
+		if err == nil {
+			registered++
+		}
+	}
+	if registered != 1 {
+		t.Errorf("Expected exactly 1 successful registration but got %d", registered)
+	}
+}
+
+func testCancelledContext(t *testing.T, store storage.Storage) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// An operation with a cancelled context must fail without saving anything. The error itself is backend
+	// specific, e.g. Firestore reports a gRPC status instead of context.Canceled.
+	err := store.SaveOperation(ctx, storage.HistoryEntry{Operation: "Add", Owner: "alice", Timestamp: start})
+	if err == nil {
+		t.Errorf("Expected an error for a cancelled context")
+	}
+
+	if entries := history(t, store, "alice"); len(entries) != 0 {
+		t.Errorf("Expected an empty history but got %+v", entries)
+	}
+}
+
+func testSaveOperations(t *testing.T, store storage.Storage) {
+	var entries []storage.HistoryEntry
+	for i := 0; i < 3; i++ {
+		entries = append(entries, storage.HistoryEntry{
+			Operation: "Add",
+			Operand1:  float64(i),
+			Result:    float64(i),
+			Owner:     "alice",
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	entries = append(entries, storage.HistoryEntry{Operation: "Add", Result: 10, Owner: "bob", Timestamp: start})
+
+	err := store.SaveOperations(context.Background(), entries)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	saved := history(t, store, "alice")
+	if len(saved) != 3 {
+		t.Fatalf("Expected 3 history entries but got %d", len(saved))
+	}
+	for i, entry := range saved {
+		if entry.ID == "" {
+			t.Errorf("Expected the saved entry to have an ID")
+		}
+		if entry.Result != float64(2-i) {
+			t.Errorf("Expected result %v at position %d but got %v", 2-i, i, entry.Result)
+		}
+	}
+	if len(history(t, store, "bob")) != 1 {
+		t.Errorf("Expected the entry of bob to be saved in his history")
+	}
+}
+
+func testSaveNonFiniteNumbers(t *testing.T, store storage.Storage) {
+	inf, nan := math.Inf(1), math.NaN()
+
+	// inf + -inf is NaN, and a NaN in a batch must not fail the other entries
+	save(t, store, storage.HistoryEntry{Operation: "Add", Operand1: inf, Operand2: -inf, Result: nan, Owner: "alice", Timestamp: start})
+	err := store.SaveOperations(context.Background(), []storage.HistoryEntry{
+		{Operation: "Add", Operand1: nan, Operand2: 1, Result: nan, Owner: "alice", Timestamp: start.Add(time.Second)},
+		{Operation: "Multiply", Operand1: inf, Operand2: 2, Result: inf, Owner: "alice", Timestamp: start.Add(2 * time.Second)},
+		{Operation: "Subtract", Operand1: -inf, Operand2: 1, Result: -inf, Owner: "alice", Timestamp: start.Add(3 * time.Second)},
+	})
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	// Newest first
+	expected := [][3]float64{{-inf, 1, -inf}, {inf, 2, inf}, {nan, 1, nan}, {inf, -inf, nan}}
+	same := func(a float64, b float64) bool {
+		return a == b || (math.IsNaN(a) && math.IsNaN(b))
+	}
+	saved := history(t, store, "alice")
+	if len(saved) != len(expected) {
+		t.Fatalf("Expected %d history entries but got %d", len(expected), len(saved))
+	}
+	for i, entry := range saved {
+		if !same(entry.Operand1, expected[i][0]) || !same(entry.Operand2, expected[i][1]) || !same(entry.Result, expected[i][2]) {
+			t.Errorf("Expected %v at position %d but got %+v", expected[i], i, entry)
+		}
+	}
+
+	page, err := store.QueryHistory(context.Background(), storage.HistoryQuery{Owner: "alice"})
+	if err != nil || len(page.Entries) != len(expected) {
+		t.Fatalf("Expected %d entries but got %+v (%v)", len(expected), page.Entries, err)
+	}
+	if !math.IsNaN(page.Entries[3].Result) {
+		t.Errorf("Expected NaN but got %v", page.Entries[3].Result)
+	}
+}
+
+func testSaveOperationsEmpty(t *testing.T, store storage.Storage) {
+	err := store.SaveOperations(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	if entries := history(t, store, "alice"); len(entries) != 0 {
+		t.Errorf("Expected an empty history but got %+v", entries)
+	}
+}
+
+func testSaveOperationsCancelledContext(t *testing.T, store storage.Storage) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// None of the entries may be saved when the batch fails
+	err := store.SaveOperations(ctx, []storage.HistoryEntry{
+		{Operation: "Add", Owner: "alice", Timestamp: start},
+		{Operation: "Subtract", Owner: "alice", Timestamp: start},
+	})
+	if err == nil {
+		t.Errorf("Expected an error for a cancelled context")
+	}
+
+	if entries := history(t, store, "alice"); len(entries) != 0 {
+		t.Errorf("Expected an empty history but got %+v", entries)
+	}
+}
+
+// Helper function to query all pages of the query and fail the test on error
+func queryAllPages(t *testing.T, store storage.Storage, query storage.HistoryQuery) (entries []storage.HistoryEntry, pages int) {
+	t.Helper()
+	for {
+		page, err := store.QueryHistory(context.Background(), query)
+		if err != nil {
+			t.Fatalf("Expected nil but got %s", err)
+		}
+		if len(page.Entries) > query.Limit {
+			t.Fatalf("Expected at most %d entries in a page but got %d", query.Limit, len(page.Entries))
+		}
+
+		entries = append(entries, page.Entries...)
+		pages++
+		if page.NextPageToken == "" {
+			return entries, pages
+		}
+		if pages > 100 {
+			t.Fatalf("Expected the pagination to end")
+		}
+		query.PageToken = page.NextPageToken
+	}
+}
+
+func testQueryHistoryPagination(t *testing.T, store storage.Storage) {
+	for i := 0; i < 25; i++ {
+		save(t, store, storage.HistoryEntry{Operation: "Add", Result: float64(i), Owner: "alice", Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+	save(t, store, storage.HistoryEntry{Operation: "Add", Owner: "bob", Timestamp: start})
+
+	entries, pages := queryAllPages(t, store, storage.HistoryQuery{Owner: "alice", Limit: 10})
+	if pages != 3 {
+		t.Errorf("Expected 3 pages but got %d", pages)
+	}
+	if len(entries) != 25 {
+		t.Fatalf("Expected 25 history entries but got %d", len(entries))
+	}
+
+	// Newest first by default, so the results count down from 24
+	for i, entry := range entries {
+		if entry.Result != float64(24-i) {
+			t.Errorf("Expected result %d at position %d but got %g", 24-i, i, entry.Result)
+		}
+	}
+}
+
+func testQueryHistoryPaginationWithEqualTimestamps(t *testing.T, store storage.Storage) {
+	for i := 0; i < 5; i++ {
+		save(t, store, storage.HistoryEntry{Operation: "Add", Result: float64(i), Owner: "alice", Timestamp: start})
+	}
+
+	// Every entry must be returned exactly once, even though the page boundaries fall between equal timestamps
+	entries, _ := queryAllPages(t, store, storage.HistoryQuery{Owner: "alice", Limit: 2})
+	if len(entries) != 5 {
+		t.Fatalf("Expected 5 history entries but got %d", len(entries))
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[entry.ID] {
+			t.Errorf("Expected entry %s to be returned once", entry.ID)
+		}
+		seen[entry.ID] = true
+	}
+}
+
+func testQueryHistoryFilters(t *testing.T, store storage.Storage) {
+	operations := []string{"Add", "Subtract", "Multiply", "Divide"}
+	for i := 0; i < 12; i++ {
+		save(t, store, storage.HistoryEntry{
+			Operation: operations[i%len(operations)],
+			Result:    float64(i),
+			Owner:     "alice",
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	minResult, maxResult := 3.0, 8.0
+	tests := []struct {
+		name     string
+		query    storage.HistoryQuery
+		expected []float64 // Results, newest first
+	}{
+		{"Operations", storage.HistoryQuery{Operations: []string{"Add", "Divide"}}, []float64{11, 8, 7, 4, 3, 0}},
+		{"From", storage.HistoryQuery{From: start.Add(9 * time.Minute)}, []float64{11, 10, 9}},
+		{"To", storage.HistoryQuery{To: start.Add(2 * time.Minute)}, []float64{1, 0}},
+		{"ResultRange", storage.HistoryQuery{MinResult: &minResult, MaxResult: &maxResult}, []float64{8, 7, 6, 5, 4, 3}},
+		{"Combined", storage.HistoryQuery{Operations: []string{"Add"}, From: start.Add(time.Minute), MaxResult: &maxResult}, []float64{8, 4}},
+	}
+
+	for _, test := range tests {
+		test.query.Owner = "alice"
+		test.query.Limit = 4
+		entries, _ := queryAllPages(t, store, test.query)
+
+		var results []float64
+		for _, entry := range entries {
+			results = append(results, entry.Result)
+		}
+		if fmt.Sprint(results) != fmt.Sprint(test.expected) {
+			t.Errorf("%s: expected results %v but got %v", test.name, test.expected, results)
+		}
+	}
+}
+
+func testQueryHistorySortByResult(t *testing.T, store storage.Storage) {
+	for i, result := range []float64{5, -2, 9, 0, 5, 3} {
+		save(t, store, storage.HistoryEntry{Operation: "Add", Result: result, Owner: "alice", Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	entries, _ := queryAllPages(t, store, storage.HistoryQuery{Owner: "alice", SortBy: storage.SortByResult, Ascending: true, Limit: 4})
+
+	var results []float64
+	for _, entry := range entries {
+		results = append(results, entry.Result)
+	}
+	if fmt.Sprint(results) != fmt.Sprint([]float64{-2, 0, 3, 5, 5, 9}) {
+		t.Errorf("Expected results sorted ascending but got %v", results)
+	}
+}
+
+func testQueryHistoryInvalidPageToken(t *testing.T, store storage.Storage) {
+	for i := 0; i < 3; i++ {
+		save(t, store, storage.HistoryEntry{Operation: "Add", Owner: "alice", Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	_, err := store.QueryHistory(context.Background(), storage.HistoryQuery{Owner: "alice", PageToken: "not a token"})
+	if !errors.Is(err, storage.ErrInvalidPageToken) {
+		t.Errorf("Expected ErrInvalidPageToken but got %v", err)
+	}
+
+	// A token can only be used with the sort order it was created for
+	page, err := store.QueryHistory(context.Background(), storage.HistoryQuery{Owner: "alice", Limit: 1})
+	if err != nil || page.NextPageToken == "" {
+		t.Fatalf("Expected a next page but got %+v (%v)", page, err)
+	}
+	_, err = store.QueryHistory(context.Background(), storage.HistoryQuery{Owner: "alice", Ascending: true, PageToken: page.NextPageToken})
+	if !errors.Is(err, storage.ErrInvalidPageToken) {
+		t.Errorf("Expected ErrInvalidPageToken but got %v", err)
+	}
+}
+
+func testQueryHistoryPaginationWithNonFiniteResults(t *testing.T, store storage.Storage) {
+	results := []float64{math.NaN(), math.Inf(1), math.Inf(-1)}
+	for i, result := range results {
+		save(t, store, storage.HistoryEntry{Owner: "alice", Operation: "Add", Result: result, Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	// The page token holds the result of the last entry, which must not end the history early
+	var seen int
+	query := storage.HistoryQuery{Owner: "alice", Limit: 1}
+	for page := 0; page < len(results)+1; page++ {
+		result, err := store.QueryHistory(context.Background(), query)
+		if err != nil {
+			t.Fatalf("Expected nil but got %s", err)
+		}
+		seen += len(result.Entries)
+		if result.NextPageToken == "" {
+			break
+		}
+		query.PageToken = result.NextPageToken
+	}
+	if seen != len(results) {
+		t.Errorf("Expected %d entries but got %d", len(results), seen)
+	}
+}
+
+func testQueryHistoryTooManyOperations(t *testing.T, store storage.Storage) {
+	save(t, store, storage.HistoryEntry{Owner: "alice", Operation: "Add", Result: 3, Timestamp: start})
+
+	// Repeated operations count once, so this is a filter by a single operation
+	repeated := make([]string, storage.MaxHistoryOperations+10)
+	for i := range repeated {
+		repeated[i] = "Add"
+	}
+	page, err := store.QueryHistory(context.Background(), storage.HistoryQuery{Owner: "alice", Operations: repeated})
+	if err != nil || len(page.Entries) != 1 {
+		t.Fatalf("Expected 1 entry but got %+v (%v)", page.Entries, err)
+	}
+
+	distinct := make([]string, storage.MaxHistoryOperations+1)
+	for i := range distinct {
+		distinct[i] = fmt.Sprintf("Operation%d", i)
+	}
+	_, err = store.QueryHistory(context.Background(), storage.HistoryQuery{Owner: "alice", Operations: distinct})
+	if !errors.Is(err, storage.ErrTooManyOperations) {
+		t.Errorf("Expected ErrTooManyOperations but got %v", err)
+	}
+}
+
+// Helper function to save a refresh token of the family that expires in an hour and fail the test on error
+func saveRefreshToken(t *testing.T, store storage.Storage, id string, family string) storage.RefreshToken {
+	t.Helper()
+	token := storage.RefreshToken{
+		ID:        id,
+		Family:    family,
+		Owner:     "alice",
+		ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second).UTC(),
+	}
+	err := store.SaveRefreshToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	return token
+}
+
+func testGetRefreshToken(t *testing.T, store storage.Storage) {
+	saved := saveRefreshToken(t, store, "token1", "family1")
+
+	token, err := store.GetRefreshToken(context.Background(), "token1")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	if token.ID != saved.ID || token.Family != saved.Family || token.Owner != saved.Owner ||
+		!token.ExpiresAt.Equal(saved.ExpiresAt) || token.Used {
+		t.Errorf("Expected %+v but got %+v", saved, token)
+	}
+
+	// Getting the token does not use it
+	if _, err := store.UseRefreshToken(context.Background(), "token1"); err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	token, err = store.GetRefreshToken(context.Background(), "token1")
+	if err != nil || !token.Used {
+		t.Errorf("Expected the used token but got %+v (%v)", token, err)
+	}
+
+	_, err = store.GetRefreshToken(context.Background(), "unknown")
+	if !errors.Is(err, storage.ErrTokenNotFound) || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected token not found but got %v", err)
+	}
+}
+
+func testUseRefreshToken(t *testing.T, store storage.Storage) {
+	saved := saveRefreshToken(t, store, "token1", "family1")
+
+	token, err := store.UseRefreshToken(context.Background(), "token1")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	if token.ID != saved.ID || token.Family != saved.Family || token.Owner != saved.Owner ||
+		!token.ExpiresAt.Equal(saved.ExpiresAt) || token.Used {
+		t.Errorf("Expected %+v but got %+v", saved, token)
+	}
+}
+
+func testRefreshTokenUsedTwice(t *testing.T, store storage.Storage) {
+	saveRefreshToken(t, store, "token1", "family1")
+
+	_, err := store.UseRefreshToken(context.Background(), "token1")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	// The second use returns the token, so the caller can revoke its family
+	token, err := store.UseRefreshToken(context.Background(), "token1")
+	if !errors.Is(err, storage.ErrTokenUsed) || !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("Expected token already used but got %v", err)
+	}
+	if token.Family != "family1" || !token.Used {
+		t.Errorf("Expected the used token of family1 but got %+v", token)
+	}
+}
+
+func testUnknownRefreshToken(t *testing.T, store storage.Storage) {
+	_, err := store.UseRefreshToken(context.Background(), "unknown")
+	if !errors.Is(err, storage.ErrTokenNotFound) || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected token not found but got %v", err)
+	}
+}
+
+func testRevokeRefreshTokens(t *testing.T, store storage.Storage) {
+	saveRefreshToken(t, store, "token1", "family1")
+	saveRefreshToken(t, store, "token2", "family1")
+	saveRefreshToken(t, store, "token3", "family2")
+
+	err := store.RevokeRefreshTokens(context.Background(), "family1")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	for _, id := range []string{"token1", "token2"} {
+		_, err = store.UseRefreshToken(context.Background(), id)
+		if !errors.Is(err, storage.ErrTokenNotFound) {
+			t.Errorf("Expected token not found for %s but got %v", id, err)
+		}
+	}
+
+	// Tokens of other families are kept
+	_, err = store.UseRefreshToken(context.Background(), "token3")
+	if err != nil {
+		t.Errorf("Expected nil but got %s", err)
+	}
+}
+
+func testConcurrentRefreshTokenUse(t *testing.T, store storage.Storage) {
+	const workers = 5
+	saveRefreshToken(t, store, "token1", "family1")
+
+	var wait sync.WaitGroup
+	errs := make(chan error, workers)
+	for worker := 0; worker < workers; worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			_, err := store.UseRefreshToken(context.Background(), "token1")
+			errs <- err
+		}()
+	}
+	wait.Wait()
+	close(errs)
+
+	// Exactly one of the uses of the same token must succeed
+	used := 0
+	for err := range errs {
+		if err == nil {
+			used++
+		} else if !errors.Is(err, storage.ErrTokenUsed) {
+			t.Errorf("Expected token already used but got %v", err)
+		}
+	}
+	if used != 1 {
+		t.Errorf("Expected exactly 1 successful use but got %d", used)
+	}
+}
+
+func testRevokeAccessToken(t *testing.T, store storage.Storage) {
+	revoked, err := store.IsAccessTokenRevoked(context.Background(), "access1")
+	if err != nil || revoked {
+		t.Fatalf("Expected the token not to be revoked but got %v, %v", revoked, err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	err = store.RevokeAccessToken(context.Background(), "access1", expiresAt)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	// Revoking twice, e.g. when logging out again, is not an error
+	err = store.RevokeAccessToken(context.Background(), "access1", expiresAt)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	revoked, err = store.IsAccessTokenRevoked(context.Background(), "access1")
+	if err != nil || !revoked {
+		t.Errorf("Expected the token to be revoked but got %v, %v", revoked, err)
+	}
+	revoked, err = store.IsAccessTokenRevoked(context.Background(), "access2")
+	if err != nil || revoked {
+		t.Errorf("Expected other tokens not to be revoked but got %v, %v", revoked, err)
+	}
+}
+
+// Helper function to create an API key of the owner and fail the test on error
+func createAPIKey(t *testing.T, store storage.Storage, id string, owner string, createdAt time.Time) storage.APIKey {
+	t.Helper()
+	key := storage.APIKey{
+		ID:        id,
+		Hash:      "hash of " + id,
+		Owner:     owner,
+		Name:      "key " + id,
+		Scopes:    []string{"calculate", "history:read"},
+		CreatedAt: createdAt,
+	}
+	err := store.CreateAPIKey(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	return key
+}
+
+// Helper function reporting whether two API keys are equal, regardless of the location of their times
+func equalAPIKeys(a storage.APIKey, b storage.APIKey) bool {
+	return a.ID == b.ID && a.Hash == b.Hash && a.Owner == b.Owner && a.Name == b.Name &&
+		fmt.Sprint(a.Scopes) == fmt.Sprint(b.Scopes) &&
+		a.CreatedAt.Equal(b.CreatedAt) && a.LastUsedAt.Equal(b.LastUsedAt)
+}
+
+func testCreateAndGetAPIKey(t *testing.T, store storage.Storage) {
+	created := createAPIKey(t, store, "key1", "alice", start)
+
+	// A key that was never used has no last-used time
+	key, err := store.GetAPIKey(context.Background(), "key1")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	if !equalAPIKeys(key, created) || !key.LastUsedAt.IsZero() {
+		t.Errorf("Expected %+v but got %+v", created, key)
+	}
+}
+
+func testUnknownAPIKey(t *testing.T, store storage.Storage) {
+	_, err := store.GetAPIKey(context.Background(), "unknown")
+	if !errors.Is(err, storage.ErrAPIKeyNotFound) || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected API key not found but got %v", err)
+	}
+}
+
+func testListAPIKeys(t *testing.T, store storage.Storage) {
+	keys, err := store.ListAPIKeys(context.Background(), "alice")
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("Expected no API keys but got %+v, %v", keys, err)
+	}
+
+	second := createAPIKey(t, store, "key2", "alice", start.Add(time.Minute))
+	first := createAPIKey(t, store, "key1", "alice", start)
+	createAPIKey(t, store, "key3", "bob", start)
+
+	// Only the keys of the owner are listed, oldest first
+	keys, err = store.ListAPIKeys(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	if len(keys) != 2 || !equalAPIKeys(keys[0], first) || !equalAPIKeys(keys[1], second) {
+		t.Errorf("Expected %+v but got %+v", []storage.APIKey{first, second}, keys)
+	}
+}
+
+func testDeleteAPIKey(t *testing.T, store storage.Storage) {
+	createAPIKey(t, store, "key1", "alice", start)
+
+	// Keys of other users cannot be deleted
+	err := store.DeleteAPIKey(context.Background(), "bob", "key1")
+	if !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Errorf("Expected API key not found but got %v", err)
+	}
+	_, err = store.GetAPIKey(context.Background(), "key1")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+
+	err = store.DeleteAPIKey(context.Background(), "alice", "key1")
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	_, err = store.GetAPIKey(context.Background(), "key1")
+	if !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Errorf("Expected API key not found but got %v", err)
+	}
+	err = store.DeleteAPIKey(context.Background(), "alice", "key1")
+	if !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Errorf("Expected API key not found but got %v", err)
+	}
+}
+
+func testTouchAPIKey(t *testing.T, store storage.Storage) {
+	createAPIKey(t, store, "key1", "alice", start)
+
+	usedAt := start.Add(time.Hour)
+	err := store.TouchAPIKey(context.Background(), "key1", usedAt)
+	if err != nil {
+		t.Fatalf("Expected nil but got %s", err)
+	}
+	key, err := store.GetAPIKey(context.Background(), "key1")
+	if err != nil || !key.LastUsedAt.Equal(usedAt) {
+		t.Errorf("Expected last use at %v but got %+v, %v", usedAt, key, err)
+	}
+
+	err = store.TouchAPIKey(context.Background(), "unknown", usedAt)
+	if !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Errorf("Expected API key not found but got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"overengineered_calculator/api"
+	"overengineered_calculator/calculator"
+	"overengineered_calculator/setup"
+	"overengineered_calculator/storage"
+)
+
+// runVerify implements the verify subcommand, which replays the history of a user against the current calculator
+// with the storage backend from the environment, like the server. It prints the mismatches and returns the exit
+// status: 0 if every entry verifies, 1 if some differ and 2 if the verification could not run.
+//
+//	overengineered_calculator verify -user alice [-tolerance 1e-9] [-json]
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	user := flags.String("user", "", "user whose history is verified (required)")
+	tolerance := flags.Float64("tolerance", 0, "largest accepted absolute difference between the stored and recomputed result")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *user == "" || *tolerance < 0 {
+		fmt.Fprintln(os.Stderr, "verify needs a -user and a non-negative -tolerance")
+		flags.Usage()
+		return 2
+	}
+
+	config, err := setup.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 2
+	}
+	calculatorStorage, closeStorage, err := setup.InitStorage(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Storage initialization failed: %v\n", err)
+		return 2
+	}
+	defer closeStorage()
+
+	api := api.NewAPI(calculator.NewCalculator(), calculatorStorage)
+	report, err := api.VerifyHistory(context.Background(), storage.HistoryQuery{Owner: *user}, *tolerance)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Verification failed: %v\n", err)
+		return 2
+	}
+
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(report)
+	} else {
+		for _, mismatch := range report.Mismatches {
+			if mismatch.Error != "" {
+				fmt.Printf("%s %s: %s\n", mismatch.ID, mismatch.Formatted, mismatch.Error)
+			} else {
+				fmt.Printf("%s %s: recomputed %s\n", mismatch.ID, mismatch.Formatted, mismatch.Recomputed)
+			}
+		}
+		fmt.Printf("Checked %d entries, %d mismatched\n", report.Checked, report.Mismatched)
+	}
+
+	if report.Mismatched > 0 {
+		return 1
+	}
+	return 0
+}
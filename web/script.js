@@ -28,14 +28,6 @@ const operatorEndpointMap = {
 };
 
 
-const endpointOperatorMap = {
-    'Add': '+',
-    'Subtract': '-',
-    'Multiply': '*',
-    'Divide': '÷',
-    'Modulo': '%',
-    'Power': '^'
-};
 
 
 
@@ -121,8 +113,8 @@ function performCalculation() {
 
     if (!operation) return;
 
-    //const apiUrl = `https://overengineered-calculator-360186502614.europe-west1.run.app/${operation}?operand1=${operand1}&operand2=${operand2}`;
-    const apiUrl = `http://localhost:8080/${operation}?operand1=${operand1}&operand2=${operand2}`; // Local testing
+    //const apiUrl = `https://overengineered-calculator-360186502614.europe-west1.run.app/v1/${operation}?operand1=${operand1}&operand2=${operand2}`;
+    const apiUrl = `http://localhost:8080/v1/${operation}?operand1=${operand1}&operand2=${operand2}`; // Local testing
 
     // Make API request and update display
     fetchApiAndUpdate(apiUrl);
@@ -183,12 +175,12 @@ function toggleHistoryVisibility() {
 // Method to fetch history from the API and update the history list
 function fetchAndDisplayHistory() {
     
-    //const apiUrl = 'https://overengineered-calculator-360186502614.europe-west1.run.app/history';
-    const apiUrl = 'http://localhost:8080/history'; // Local testing
+    //const apiUrl = 'https://overengineered-calculator-360186502614.europe-west1.run.app/v1/history';
+    const apiUrl = 'http://localhost:8080/v1/history'; // Local testing
 
     fetch(apiUrl)
         .then(response => response.json())
-        .then(historyData => updateHistoryList(historyData))
+        .then(historyPage => updateHistoryList(historyPage.entries)) // First page, newest first
         .catch(() => console.error('Error fetching history'));
 }
 
@@ -215,13 +207,6 @@ function updateHistoryList(historyData) {
 
 
 
-// Mapping for API endpoint to selected operator
-function mapEndpointToOperator(endpointName) {
-    return endpointOperatorMap[endpointName];
-}
-
-
-
 // Create a single list item for the history list.
 // Elements are sorted by timestamp in descending order on the backend.
 function createHistoryListItem(entry) {
@@ -237,10 +222,8 @@ function createHistoryListItem(entry) {
 
     const formattedDate = `${day}/${month}/${year} ${hours}.${minutes}`;
 
-    const operatorSymbol = mapEndpointToOperator(entry.Operation);
-
-
-    listItem.textContent = `${formattedDate}: ${entry.Operand1} ${operatorSymbol} ${entry.Operand2} = ${entry.Result}`;
+    // The backend formats the calculation using the symbols of its operation registry
+    listItem.textContent = `${formattedDate}: ${entry.Formatted}`;
 
     return listItem;
 }
\ No newline at end of file